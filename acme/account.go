@@ -0,0 +1,388 @@
+package acme
+
+import (
+	"context"
+	"crypto"
+	"crypto/rsa"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path"
+	"time"
+
+	"golang.org/x/crypto/acme"
+)
+
+// accountVersion is the current version of the account file format.
+const accountVersion = 1
+
+var ErrNoAccountKey = errors.New("account file has no current key")
+
+// Account holds the server-side state of an ACME account.
+type Account struct {
+	URL       string    `json:"url"`
+	Status    string    `json:"status"`
+	Contact   []string  `json:"contact"`
+	OrdersURL string    `json:"orders,omitempty"`
+	CreatedAt time.Time `json:"createdAt"`
+}
+
+// accountFile is the versioned on-disk format of an account, stored as
+// <accountkey>.json. It replaces the bare <accountkey>.key file, which is
+// migrated automatically and then ignored.
+type accountFile struct {
+	Version   int          `json:"version"`
+	Directory string       `json:"directory"`
+	CreatedAt time.Time    `json:"createdAt"`
+	EAB       *eabInfo     `json:"eab,omitempty"`
+	Keys      []accountKey `json:"keys"`
+	Account   *Account     `json:"account,omitempty"`
+}
+
+// accountKey is a PEM encoded account key. Keys replaced by a rollover are
+// kept with the time they were retired. A pending key is being rolled over
+// to and not yet known to the CA.
+type accountKey struct {
+	PEM       string     `json:"pem"`
+	CreatedAt time.Time  `json:"createdAt"`
+	RetiredAt *time.Time `json:"retiredAt,omitempty"`
+	Pending   bool       `json:"pending,omitempty"`
+}
+
+// eabInfo records the external account binding used at registration. The
+// MAC key is never stored.
+type eabInfo struct {
+	KID string `json:"kid"`
+}
+
+// WithExternalAccountBinding binds a newly registered account to an existing
+// account at the CA, as required by some commercial and private CAs. Only the
+// key identifier is stored in the account file.
+func WithExternalAccountBinding(kid string, key []byte) Option {
+	return func(c *Client) {
+		c.eab = &acme.ExternalAccountBinding{KID: kid, Key: key}
+	}
+}
+
+// currentKey returns the key that has not been retired.
+func (f *accountFile) currentKey() (*rsa.PrivateKey, error) {
+	for i := len(f.Keys) - 1; i >= 0; i-- {
+		if f.Keys[i].RetiredAt == nil && !f.Keys[i].Pending {
+			return parseKey([]byte(f.Keys[i].PEM))
+		}
+	}
+	return nil, ErrNoAccountKey
+}
+
+// newAccount converts an account returned by the CA. The creation time is not
+// part of the protocol, so it is supplied by the caller.
+func newAccount(a *acme.Account, created time.Time) *Account {
+	return &Account{
+		URL:       a.URI,
+		Status:    a.Status,
+		Contact:   a.Contact,
+		OrdersURL: a.OrdersURL,
+		CreatedAt: created,
+	}
+}
+
+// loadAccountFile reads the account file from dir. Files written before the
+// format was versioned are migrated in memory from <name>.key and the old
+// account state; the caller is expected to save the result.
+func loadAccountFile(dir, name string) (f *accountFile, migrated bool, err error) {
+	b, err := ioutil.ReadFile(path.Join(dir, name+".json"))
+	if err != nil && !os.IsNotExist(err) {
+		return nil, false, err
+	}
+	f = &accountFile{}
+	if err == nil {
+		if err := json.Unmarshal(b, f); err != nil {
+			return nil, false, err
+		}
+		if f.Version > accountVersion {
+			return nil, false, fmt.Errorf("account file version %d is not supported", f.Version)
+		}
+		if f.Version == accountVersion {
+			return f, false, nil
+		}
+	}
+	k, err := loadKey(dir, name+".key")
+	if err != nil {
+		return nil, false, err
+	}
+	f = &accountFile{
+		Version: accountVersion,
+		Keys: []accountKey{
+			{PEM: string(encodeKey(k))},
+		},
+	}
+	if b != nil {
+		a := &Account{}
+		if err := json.Unmarshal(b, a); err == nil && a.URL != "" {
+			f.Account = a
+			f.CreatedAt = a.CreatedAt
+			f.Keys[0].CreatedAt = a.CreatedAt
+		}
+	}
+	return f, true, nil
+}
+
+// register creates a new account key, registers it with the CA and writes
+// the account file.
+func (c *Client) register(ctx context.Context, email string) error {
+	if err := c.writable(); err != nil {
+		return err
+	}
+	k, err := rsa.GenerateKey(c.rand, 2048)
+	if err != nil {
+		return err
+	}
+	c.setKey(k)
+	account := &acme.Account{ExternalAccountBinding: c.eab}
+	if email != "" {
+		account.Contact = []string{"mailto:" + email}
+	}
+	a, err := c.ca().Register(ctx, account, acme.AcceptTOS)
+	if err != nil {
+		return err
+	}
+	now := c.clock.Now()
+	c.accountFile = &accountFile{
+		Version:   accountVersion,
+		Directory: c.directoryURL(),
+		CreatedAt: now,
+		Keys: []accountKey{
+			{PEM: string(encodeKey(k)), CreatedAt: now},
+		},
+	}
+	if c.eab != nil {
+		c.accountFile.EAB = &eabInfo{KID: c.eab.KID}
+	}
+	if err := c.saveAccount(newAccount(a, now)); err != nil {
+		return err
+	}
+	c.emit(EventAccountRegistered, c.accountName, nil, nil)
+	return nil
+}
+
+// saveAccountFile writes the account file to dir. A read-only client only
+// keeps the account in memory.
+func (c *Client) saveAccountFile() error {
+	if c.readOnly {
+		return nil
+	}
+	if err := ensureDir(c.dir); err != nil {
+		return err
+	}
+	b, err := json.MarshalIndent(c.accountFile, "", "  ")
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(path.Join(c.dir, c.accountName+".json"), b, 0600)
+}
+
+// saveAccount stores the account state and makes it the current one.
+func (c *Client) saveAccount(a *Account) error {
+	c.accountMu.Lock()
+	defer c.accountMu.Unlock()
+	c.accountFile.Account = a
+	if err := c.saveAccountFile(); err != nil {
+		return err
+	}
+	c.account = a
+	return nil
+}
+
+// Account returns the last known state of the account, or nil if it has never
+// been fetched. Use RefreshAccount to query the CA.
+func (c *Client) Account() *Account {
+	return c.account
+}
+
+// RefreshAccount fetches the account from the CA and stores it.
+func (c *Client) RefreshAccount(ctx context.Context) (*Account, error) {
+	a, err := c.ca().GetReg(ctx, "")
+	if err != nil {
+		return nil, err
+	}
+	return c.updated(a)
+}
+
+// UpdateAccount replaces the contacts of the account, e.g. "mailto:a@b.c",
+// and stores the state returned by the CA.
+func (c *Client) UpdateAccount(ctx context.Context, contact ...string) (*Account, error) {
+	if err := c.writable(); err != nil {
+		return nil, err
+	}
+	a, err := c.ca().UpdateReg(ctx, &acme.Account{Contact: contact})
+	if err != nil {
+		return nil, err
+	}
+	return c.updated(a)
+}
+
+// AccountKeyChange replaces the key of the client's account with newKey, or
+// a new key if newKey is nil, with the key-change flow of RFC 8555 §7.3.5.
+// The account keeps its URL, orders and rate limits. The new key is written
+// to the account file as pending before the CA is asked and the old key is
+// kept as retired. If the outcome is unknown, e.g. because the request
+// timed out, the pending key is kept and New settles it with the CA.
+// Requests already in flight finish with the old key.
+func (c *Client) AccountKeyChange(ctx context.Context, newKey *rsa.PrivateKey) error {
+	if err := c.writable(); err != nil {
+		return err
+	}
+	if newKey == nil {
+		k, err := rsa.GenerateKey(c.rand, 2048)
+		if err != nil {
+			return err
+		}
+		newKey = k
+	}
+	c.accountMu.Lock()
+	defer c.accountMu.Unlock()
+	if err := c.settleRollover(ctx); err != nil {
+		return err
+	}
+	f := c.accountFile
+	f.Keys = append(f.Keys, accountKey{PEM: string(encodeKey(newKey)), CreatedAt: c.clock.Now(), Pending: true})
+	if err := c.saveAccountFile(); err != nil {
+		f.Keys = f.Keys[:len(f.Keys)-1]
+		return err
+	}
+	// The rollover runs on a copy of the ACME client, which switches to
+	// newKey on success, so other requests keep signing with the old key
+	// until promoteKey swaps the client.
+	cl := c.ca()
+	err := withKey(cl, cl.Key, cl.KID).AccountKeyRollover(ctx, newKey)
+	if err != nil {
+		// The CA may have switched keys before the error, so only the CA
+		// can tell which key is valid now.
+		sctx, cancel := context.WithTimeout(context.Background(), cleanupTimeout)
+		defer cancel()
+		if serr := c.settleRollover(sctx); serr != nil {
+			c.log.Warnf("keeping pending account key: %s", serr)
+		}
+		return fmt.Errorf("changing account key: %w", err)
+	}
+	if err := c.promoteKey(len(f.Keys)-1, newKey); err != nil {
+		return fmt.Errorf("account key was changed but the account file was not updated: %w", err)
+	}
+	return nil
+}
+
+// pendingKey returns the index of the pending key of the account file, or
+// -1 if there is none.
+func (f *accountFile) pendingKey() int {
+	for i := len(f.Keys) - 1; i >= 0; i-- {
+		if f.Keys[i].Pending {
+			return i
+		}
+	}
+	return -1
+}
+
+// settleRollover resolves a key change whose outcome is unknown: the pending
+// key becomes the current one if the CA knows the account by it, and is
+// dropped if the CA still knows the account by the current key. The caller
+// holds accountMu.
+func (c *Client) settleRollover(ctx context.Context) error {
+	f := c.accountFile
+	i := f.pendingKey()
+	if i < 0 {
+		return nil
+	}
+	k, err := parseKey([]byte(f.Keys[i].PEM))
+	if err != nil {
+		return err
+	}
+	switch err := c.lookupAccount(ctx, k); {
+	case err == nil:
+		return c.promoteKey(i, k)
+	case !errors.Is(err, acme.ErrNoAccount):
+		return fmt.Errorf("looking up account with pending key: %w", err)
+	}
+	current, err := f.currentKey()
+	if err != nil {
+		return err
+	}
+	if err := c.lookupAccount(ctx, current); err != nil {
+		return fmt.Errorf("looking up account with current key: %w", err)
+	}
+	c.log.Infof("dropping pending key of account %s, the key change did not happen", c.accountName)
+	f.Keys = append(f.Keys[:i], f.Keys[i+1:]...)
+	return c.saveAccountFile()
+}
+
+// lookupAccount checks that the CA knows the account by key k.
+func (c *Client) lookupAccount(ctx context.Context, k *rsa.PrivateKey) error {
+	a, err := withKey(c.ca(), k, "").GetReg(ctx, "")
+	if err != nil {
+		return err
+	}
+	if c.account != nil && c.account.URL != "" && a.URI != c.account.URL {
+		return fmt.Errorf("key belongs to account %s, not %s", a.URI, c.account.URL)
+	}
+	return nil
+}
+
+// promoteKey makes the pending key i, which is k, the current key and
+// retires the previous one. The caller holds accountMu.
+func (c *Client) promoteKey(i int, k *rsa.PrivateKey) error {
+	f := c.accountFile
+	now := c.clock.Now()
+	for j := range f.Keys {
+		if j != i && f.Keys[j].RetiredAt == nil && !f.Keys[j].Pending {
+			f.Keys[j].RetiredAt = &now
+		}
+	}
+	f.Keys[i].Pending = false
+	c.setKey(k)
+	if err := c.saveAccountFile(); err != nil {
+		return err
+	}
+	c.log.Infof("changed key of account %s", c.accountName)
+	c.emit(EventAccountKeyChanged, c.accountName, nil, nil)
+	return nil
+}
+
+// withKey returns a copy of the ACME client cl signing with k as the account
+// kid, or looking the account up by k if kid is empty.
+func withKey(cl *acme.Client, k crypto.Signer, kid acme.KeyID) *acme.Client {
+	return &acme.Client{
+		Key:          k,
+		KID:          kid,
+		HTTPClient:   cl.HTTPClient,
+		DirectoryURL: cl.DirectoryURL,
+		RetryBackoff: cl.RetryBackoff,
+		UserAgent:    cl.UserAgent,
+	}
+}
+
+// setKey replaces the ACME client with one signing with k. The shared
+// client is never changed in place, as other requests may be signing with
+// it.
+func (c *Client) setKey(k crypto.Signer) {
+	c.clientMu.Lock()
+	defer c.clientMu.Unlock()
+	var kid acme.KeyID
+	if c.account != nil {
+		kid = acme.KeyID(c.account.URL)
+	}
+	c.client = withKey(c.client, k, kid)
+}
+
+// updated stores a refreshed account, keeping the known creation time.
+func (c *Client) updated(a *acme.Account) (*Account, error) {
+	var created time.Time
+	if c.account != nil {
+		created = c.account.CreatedAt
+	}
+	account := newAccount(a, created)
+	if err := c.saveAccount(account); err != nil {
+		return nil, err
+	}
+	return account, nil
+}
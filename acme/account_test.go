@@ -0,0 +1,119 @@
+package acme
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"testing"
+)
+
+// usesKey reports whether the client signs with k.
+func usesKey(c *Client, k *rsa.PrivateKey) bool {
+	return k.PublicKey.Equal(c.ca().Key.Public())
+}
+
+// savedKey returns the current key of the account file in dir.
+func savedKey(t *testing.T, dir string) *rsa.PrivateKey {
+	t.Helper()
+	f, _, err := loadAccountFile(dir, "account")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if i := f.pendingKey(); i >= 0 {
+		t.Errorf("account file still has pending key %d", i)
+	}
+	k, err := f.currentKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return k
+}
+
+func TestAccountKeyChange(t *testing.T) {
+	tests := []struct {
+		fault   string
+		changed bool
+	}{
+		{"", true},
+		{"lost", true},
+		{"rejected", false},
+	}
+	for _, tt := range tests {
+		t.Run("fault="+tt.fault, func(t *testing.T) {
+			ca := newTestCA(t)
+			ca.keyChangeFault = tt.fault
+			dir := t.TempDir()
+			c := ca.newClient(t, dir)
+			ctx := context.Background()
+			if _, err := c.RefreshAccount(ctx); err != nil {
+				t.Fatal(err)
+			}
+			shared := c.ca()
+			old := shared.Key
+			newKey, err := rsa.GenerateKey(rand.Reader, 2048)
+			if err != nil {
+				t.Fatal(err)
+			}
+			err = c.AccountKeyChange(ctx, newKey)
+			if (err != nil) != (tt.fault != "") {
+				t.Fatalf("AccountKeyChange = %v", err)
+			}
+			if shared.Key != old {
+				t.Error("key of the shared ACME client was changed in place")
+			}
+			want := old.(*rsa.PrivateKey)
+			if tt.changed {
+				want = newKey
+			}
+			if !usesKey(c, want) {
+				t.Errorf("client does not sign with the expected key")
+			}
+			if !savedKey(t, dir).Equal(want) {
+				t.Errorf("account file does not hold the expected key")
+			}
+			// The CA only accepts requests signed with the account's key.
+			if _, err := c.RefreshAccount(ctx); err != nil {
+				t.Errorf("RefreshAccount after key change: %v", err)
+			}
+		})
+	}
+}
+
+func TestNewSettlesPendingKey(t *testing.T) {
+	for _, changed := range []bool{true, false} {
+		ca := newTestCA(t)
+		dir := t.TempDir()
+		c := ca.newClient(t, dir)
+		ctx := context.Background()
+		if _, err := c.RefreshAccount(ctx); err != nil {
+			t.Fatal(err)
+		}
+		old := c.ca().Key.(*rsa.PrivateKey)
+		newKey, err := rsa.GenerateKey(rand.Reader, 2048)
+		if err != nil {
+			t.Fatal(err)
+		}
+		// Leave a pending key behind as an interrupted key change would.
+		c.accountFile.Keys = append(c.accountFile.Keys, accountKey{PEM: string(encodeKey(newKey)), Pending: true})
+		if err := c.saveAccountFile(); err != nil {
+			t.Fatal(err)
+		}
+		want := old
+		if changed {
+			ca.mu.Lock()
+			ca.accounts[ca.lookup(&old.PublicKey)] = &newKey.PublicKey
+			ca.mu.Unlock()
+			want = newKey
+		}
+		c, err = New(ctx, dir, "account", "", WithInsecure(), WithDirectoryURL(ca.URL+"/dir"))
+		if err != nil {
+			t.Fatalf("changed=%v: New = %v", changed, err)
+		}
+		if !usesKey(c, want) {
+			t.Errorf("changed=%v: client does not sign with the expected key", changed)
+		}
+		if !savedKey(t, dir).Equal(want) {
+			t.Errorf("changed=%v: account file does not hold the expected key", changed)
+		}
+	}
+}
@@ -0,0 +1,103 @@
+package acme
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"path"
+	"time"
+)
+
+// ACM imports certificates into AWS Certificate Manager, for CloudFront
+// and load balancers. The credentials need the acm:ImportCertificate
+// permission.
+type ACM struct {
+	AccessKeyID     string
+	SecretAccessKey string
+	SessionToken    string
+	// Region is the region of the certificate; CloudFront only uses
+	// certificates in us-east-1.
+	Region string
+	// CertificateArn is the certificate to replace. If empty, Deploy
+	// imports a new certificate and sets it, so that later renewals
+	// replace the one in use.
+	CertificateArn string
+}
+
+// Deploy imports the certificate name from dir.
+func (a *ACM) Deploy(ctx context.Context, dir, name string) error {
+	leaf, chain, key, err := deployFiles(dir, name)
+	if err != nil {
+		return err
+	}
+	in := map[string]interface{}{
+		"Certificate": leaf,
+		"PrivateKey":  key,
+	}
+	if len(chain) > 0 {
+		in["CertificateChain"] = chain
+	}
+	if a.CertificateArn != "" {
+		in["CertificateArn"] = a.CertificateArn
+	}
+	body, err := json.Marshal(in)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequest("POST", "https://acm."+a.Region+".amazonaws.com/", bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/x-amz-json-1.1")
+	req.Header.Set("X-Amz-Target", "CertificateManager.ImportCertificate")
+	cred := awsCredentials{a.AccessKeyID, a.SecretAccessKey, a.SessionToken}
+	signAWS(req, body, time.Now(), cred, a.Region, "acm")
+	resp, err := http.DefaultClient.Do(req.WithContext(ctx))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	b, err := ioutil.ReadAll(io.LimitReader(resp.Body, 1<<16))
+	if err != nil {
+		return err
+	}
+	var out struct {
+		CertificateArn string `json:"CertificateArn"`
+		Type           string `json:"__type"`
+		Message        string `json:"message"`
+	}
+	json.Unmarshal(b, &out)
+	if resp.StatusCode != http.StatusOK {
+		if out.Type != "" {
+			return fmt.Errorf("acm: %s: %s", out.Type, out.Message)
+		}
+		return fmt.Errorf("acm: unexpected status %s", resp.Status)
+	}
+	a.CertificateArn = out.CertificateArn
+	return nil
+}
+
+// deployFiles returns the PEM encoded leaf certificate, intermediates and
+// key of the certificate name in dir, as expected by upload APIs.
+func deployFiles(dir, name string) (leaf, chain, key []byte, err error) {
+	certs, err := loadChain(dir, name)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	if len(certs) == 0 {
+		return nil, nil, nil, ErrNoCertificate
+	}
+	leaf = pem.EncodeToMemory(&pem.Block{Type: certType, Bytes: certs[0].Raw})
+	for _, c := range certs[1:] {
+		chain = append(chain, pem.EncodeToMemory(&pem.Block{Type: certType, Bytes: c.Raw})...)
+	}
+	if key, err = ioutil.ReadFile(path.Join(dir, name+".key")); err != nil {
+		return nil, nil, nil, err
+	}
+	return leaf, chain, key, nil
+}
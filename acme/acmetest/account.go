@@ -0,0 +1,35 @@
+package acmetest
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+	"io/ioutil"
+	"os"
+	"path"
+)
+
+// KeyPEM encodes an RSA key in the format used by package acme.
+func KeyPEM(k *rsa.PrivateKey) []byte {
+	return pem.EncodeToMemory(&pem.Block{
+		Type:  "RSA PRIVATE KEY",
+		Bytes: x509.MarshalPKCS1PrivateKey(k),
+	})
+}
+
+// WriteAccount creates a fake account key <name>.key in dir, so acme.New
+// loads it instead of registering a new account.
+func WriteAccount(dir, name string) (*rsa.PrivateKey, error) {
+	k, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		return nil, err
+	}
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, err
+	}
+	if err := ioutil.WriteFile(path.Join(dir, name+".key"), KeyPEM(k), 0600); err != nil {
+		return nil, err
+	}
+	return k, nil
+}
@@ -0,0 +1,133 @@
+// Package acmetest provides fixtures for testing code that uses package acme
+// without any network access.
+package acmetest
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"io/ioutil"
+	"math/big"
+	"os"
+	"path"
+	"time"
+)
+
+// Chain is a throwaway certificate chain with a self-signed root.
+type Chain struct {
+	Root         *x509.Certificate
+	Intermediate *x509.Certificate
+	Leaf         *x509.Certificate
+	Key          *rsa.PrivateKey
+}
+
+// NewChain creates a root, an intermediate and a leaf certificate for the
+// provided domain names, valid from now for the provided duration.
+func NewChain(validity time.Duration, domains ...string) (*Chain, error) {
+	now := time.Now()
+	rootKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		return nil, err
+	}
+	root, err := sign(&x509.Certificate{
+		Subject:               pkix.Name{CommonName: "acmetest root"},
+		NotBefore:             now,
+		NotAfter:              now.Add(10 * validity),
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+		KeyUsage:              x509.KeyUsageCertSign,
+	}, nil, rootKey, rootKey)
+	if err != nil {
+		return nil, err
+	}
+	intKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		return nil, err
+	}
+	inter, err := sign(&x509.Certificate{
+		Subject:               pkix.Name{CommonName: "acmetest intermediate"},
+		NotBefore:             now,
+		NotAfter:              now.Add(5 * validity),
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+		KeyUsage:              x509.KeyUsageCertSign,
+	}, root, intKey, rootKey)
+	if err != nil {
+		return nil, err
+	}
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		return nil, err
+	}
+	var cn string
+	if len(domains) > 0 {
+		cn = domains[0]
+	}
+	leaf, err := sign(&x509.Certificate{
+		Subject:     pkix.Name{CommonName: cn},
+		DNSNames:    domains,
+		NotBefore:   now,
+		NotAfter:    now.Add(validity),
+		KeyUsage:    x509.KeyUsageDigitalSignature | x509.KeyUsageKeyEncipherment,
+		ExtKeyUsage: []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+	}, inter, key, intKey)
+	if err != nil {
+		return nil, err
+	}
+	return &Chain{
+		Root:         root,
+		Intermediate: inter,
+		Leaf:         leaf,
+		Key:          key,
+	}, nil
+}
+
+// sign creates a certificate from the template signed by parent. A nil parent
+// creates a self-signed certificate.
+func sign(tmpl, parent *x509.Certificate, key, parentKey *rsa.PrivateKey) (*x509.Certificate, error) {
+	serial, err := rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), 64))
+	if err != nil {
+		return nil, err
+	}
+	tmpl.SerialNumber = serial
+	if parent == nil {
+		parent = tmpl
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, parent, &key.PublicKey, parentKey)
+	if err != nil {
+		return nil, err
+	}
+	return x509.ParseCertificate(der)
+}
+
+// CertPEM returns the leaf and intermediate certificates PEM encoded, in the
+// same form as the bundle written by package acme.
+func (c *Chain) CertPEM() []byte {
+	var b []byte
+	for _, cert := range []*x509.Certificate{c.Leaf, c.Intermediate} {
+		b = append(b, pem.EncodeToMemory(&pem.Block{
+			Type:  "CERTIFICATE",
+			Bytes: cert.Raw,
+		})...)
+	}
+	return b
+}
+
+// KeyPEM returns the leaf private key PEM encoded.
+func (c *Chain) KeyPEM() []byte {
+	return KeyPEM(c.Key)
+}
+
+// WriteFiles writes <name>.crt and <name>.key to dir, laid out like the files
+// created by package acme.
+func (c *Chain) WriteFiles(dir, name string) error {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return err
+	}
+	if err := ioutil.WriteFile(path.Join(dir, name+".crt"), c.CertPEM(), 0644); err != nil {
+		return err
+	}
+	return ioutil.WriteFile(path.Join(dir, name+".key"), c.KeyPEM(), 0600)
+}
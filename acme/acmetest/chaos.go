@@ -0,0 +1,108 @@
+package acmetest
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"math/rand"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// ErrDropped is returned by Chaos for requests whose connection it drops.
+var ErrDropped = errors.New("acmetest: connection dropped")
+
+// Chaos is an http.RoundTripper that injects CA failures at the provided
+// rates, between 0 and 1, for checking that renewal automation copes with
+// CA incidents:
+//
+//	acme.New(ctx, dir, "account", "", acme.WithTransport(&acmetest.Chaos{UnavailableRate: 0.2}))
+//
+// It must never be used in production.
+type Chaos struct {
+	// Next performs the requests that are let through. It defaults to
+	// http.DefaultTransport.
+	Next http.RoundTripper
+
+	// Delay is added to requests at DelayRate.
+	Delay     time.Duration
+	DelayRate float64
+	// DropRate fails requests with ErrDropped before they are sent.
+	DropRate float64
+	// BadNonceRate rejects POST requests with a badNonce problem, which
+	// clients must retry with a fresh nonce.
+	BadNonceRate float64
+	// UnavailableRate answers requests with 503 Service Unavailable and
+	// a Retry-After of one second.
+	UnavailableRate float64
+
+	// Seed makes the injected failures reproducible if non-zero.
+	Seed int64
+
+	mu  sync.Mutex
+	rnd *rand.Rand
+}
+
+// hit reports whether a failure with the provided rate is injected.
+func (c *Chaos) hit(rate float64) bool {
+	if rate <= 0 {
+		return false
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.rnd == nil {
+		seed := c.Seed
+		if seed == 0 {
+			seed = time.Now().UnixNano()
+		}
+		c.rnd = rand.New(rand.NewSource(seed))
+	}
+	return c.rnd.Float64() < rate
+}
+
+// RoundTrip implements http.RoundTripper.
+func (c *Chaos) RoundTrip(req *http.Request) (*http.Response, error) {
+	if c.hit(c.DelayRate) {
+		select {
+		case <-time.After(c.Delay):
+		case <-req.Context().Done():
+			return nil, req.Context().Err()
+		}
+	}
+	if c.hit(c.DropRate) {
+		return nil, ErrDropped
+	}
+	if req.Method == "POST" && c.hit(c.BadNonceRate) {
+		return c.respond(req, http.StatusBadRequest, Problem("badNonce", "injected bad nonce", http.StatusBadRequest)), nil
+	}
+	if c.hit(c.UnavailableRate) {
+		resp := c.respond(req, http.StatusServiceUnavailable, Problem("serverInternal", "injected outage", http.StatusServiceUnavailable))
+		resp.Header.Set("Retry-After", "1")
+		return resp, nil
+	}
+	next := c.Next
+	if next == nil {
+		next = http.DefaultTransport
+	}
+	return next.RoundTrip(req)
+}
+
+// respond builds a problem response to req.
+func (c *Chaos) respond(req *http.Request, status int, body []byte) *http.Response {
+	if req.Body != nil {
+		req.Body.Close()
+	}
+	return &http.Response{
+		Status:        fmt.Sprintf("%d %s", status, http.StatusText(status)),
+		StatusCode:    status,
+		Proto:         "HTTP/1.1",
+		ProtoMajor:    1,
+		ProtoMinor:    1,
+		Header:        http.Header{"Content-Type": {"application/problem+json"}},
+		Body:          ioutil.NopCloser(bytes.NewReader(body)),
+		ContentLength: int64(len(body)),
+		Request:       req,
+	}
+}
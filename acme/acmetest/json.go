@@ -0,0 +1,97 @@
+package acmetest
+
+import (
+	"encoding/json"
+	"strings"
+)
+
+// Directory returns an RFC 8555 directory document for the provided base URL.
+func Directory(base string) []byte {
+	base = strings.TrimSuffix(base, "/")
+	return mustMarshal(map[string]interface{}{
+		"newNonce":   base + "/new-nonce",
+		"newAccount": base + "/new-account",
+		"newOrder":   base + "/new-order",
+		"revokeCert": base + "/revoke-cert",
+		"keyChange":  base + "/key-change",
+		"meta": map[string]interface{}{
+			"termsOfService": base + "/terms",
+		},
+	})
+}
+
+// Account returns an account object with the provided status and contacts.
+func Account(base, status string, contacts ...string) []byte {
+	base = strings.TrimSuffix(base, "/")
+	return mustMarshal(map[string]interface{}{
+		"status":    status,
+		"contact":   contacts,
+		"orders":    base + "/orders/1",
+		"createdAt": "2018-12-12T00:00:00Z",
+	})
+}
+
+// Order returns an order object with the provided status for the domain
+// names, with one authorization URL per domain.
+func Order(base, status string, domains ...string) []byte {
+	base = strings.TrimSuffix(base, "/")
+	ids := make([]map[string]string, len(domains))
+	authzs := make([]string, len(domains))
+	for i, d := range domains {
+		ids[i] = map[string]string{"type": "dns", "value": d}
+		authzs[i] = base + "/authz/" + d
+	}
+	o := map[string]interface{}{
+		"status":         status,
+		"expires":        "2030-01-01T00:00:00Z",
+		"identifiers":    ids,
+		"authorizations": authzs,
+		"finalize":       base + "/finalize/1",
+	}
+	if status == "valid" {
+		o["certificate"] = base + "/cert/1"
+	}
+	return mustMarshal(o)
+}
+
+// Authorization returns an authorization object for the domain with one
+// http-01 and one dns-01 challenge, both sharing the authorization status.
+func Authorization(base, domain, status string) []byte {
+	base = strings.TrimSuffix(base, "/")
+	chal := func(typ string) map[string]string {
+		return map[string]string{
+			"type":   typ,
+			"url":    base + "/chal/" + typ + "/" + domain,
+			"token":  "token-" + domain,
+			"status": status,
+		}
+	}
+	return mustMarshal(map[string]interface{}{
+		"status":     status,
+		"expires":    "2030-01-01T00:00:00Z",
+		"identifier": map[string]string{"type": "dns", "value": domain},
+		"challenges": []map[string]string{chal("http-01"), chal("dns-01")},
+	})
+}
+
+// Problem returns an RFC 7807 problem document. The type is prefixed with
+// the ACME error namespace unless it is already a URN.
+func Problem(typ, detail string, status int) []byte {
+	if !strings.HasPrefix(typ, "urn:") {
+		typ = "urn:ietf:params:acme:error:" + typ
+	}
+	return mustMarshal(map[string]interface{}{
+		"type":   typ,
+		"detail": detail,
+		"status": status,
+	})
+}
+
+// mustMarshal encodes v, which only ever holds plain maps and strings.
+func mustMarshal(v interface{}) []byte {
+	b, err := json.Marshal(v)
+	if err != nil {
+		panic(err)
+	}
+	return b
+}
@@ -0,0 +1,17 @@
+//go:build go1.26
+
+package acmetest
+
+import (
+	"testing"
+	"testing/cryptotest"
+)
+
+// Deterministic makes the keys, CSRs and signatures created by package acme
+// for the rest of test t reproducible from seed, for golden file tests. It
+// replaces the randomness of the whole process, so t must not be parallel.
+// The output for a seed may change with the Go release. It needs Go 1.26
+// or later.
+func Deterministic(t *testing.T, seed uint64) {
+	cryptotest.SetGlobalRandom(t, seed)
+}
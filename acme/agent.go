@@ -0,0 +1,207 @@
+package acme
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+// agentTTL is how long an agent registration is valid; agents re-register
+// at a third of it.
+const agentTTL = 3 * time.Minute
+
+// agentTaskTTL bounds how long an Agent serves a challenge response the
+// client did not report done.
+const agentTaskTTL = time.Hour
+
+// Registration announces an agent to the client; see Agent.
+type Registration struct {
+	Name string `json:"name"`
+	URL  string `json:"url"`
+	// Challenges are the challenge types the agent solves, such as
+	// ChallengeHTTP; ChallengeHTTP only if empty.
+	Challenges []string `json:"challenges,omitempty"`
+}
+
+// registeredAgent is an agent known to the client.
+type registeredAgent struct {
+	url        string
+	challenges []string
+	expires    time.Time
+}
+
+// solves reports whether the agent accepts challenges of type chtype.
+func (a registeredAgent) solves(chtype string) bool {
+	if len(a.challenges) == 0 {
+		return chtype == ChallengeHTTP
+	}
+	for _, t := range a.challenges {
+		if t == chtype {
+			return true
+		}
+	}
+	return false
+}
+
+// AgentRegistryHandler receives the signed registrations of agents. Every
+// http-01 challenge is delegated to all registered agents, so validation
+// succeeds whichever node the CA's request reaches; dns-01 challenges go
+// to a single agent. Requires WithDelegation.
+func (c *Client) AgentRegistryHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		d := c.delegation
+		if d == nil || r.Method != "POST" {
+			http.NotFound(w, r)
+			return
+		}
+		var reg Registration
+		if err := readSigned(r, d.secret, &reg); err != nil {
+			http.Error(w, err.Error(), http.StatusForbidden)
+			return
+		}
+		if reg.Name == "" || reg.URL == "" {
+			http.Error(w, "name and url are required", http.StatusBadRequest)
+			return
+		}
+		d.mu.Lock()
+		if d.agents == nil {
+			d.agents = make(map[string]registeredAgent)
+		}
+		if _, ok := d.agents[reg.Name]; !ok {
+			c.log.Infof("agent %s registered at %s", reg.Name, reg.URL)
+		}
+		d.agents[reg.Name] = registeredAgent{
+			url:        reg.URL,
+			challenges: reg.Challenges,
+			expires:    c.clock.Now().Add(agentTTL),
+		}
+		d.mu.Unlock()
+		w.WriteHeader(http.StatusNoContent)
+	})
+}
+
+// targets returns the URLs a challenge of type chtype is delegated to:
+// agentURL and the registered agents solving chtype.
+func (d *delegation) targets(chtype string, now time.Time) []string {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	var urls []string
+	if d.agentURL != "" {
+		urls = append(urls, d.agentURL)
+	}
+	for name, a := range d.agents {
+		if now.After(a.expires) {
+			delete(d.agents, name)
+			continue
+		}
+		if a.solves(chtype) {
+			urls = append(urls, a.url)
+		}
+	}
+	if chtype != ChallengeHTTP && len(urls) > 1 {
+		urls = urls[:1]
+	}
+	return urls
+}
+
+// Agent runs on edge or load balancer nodes and serves the http-01
+// challenges delegated to it by a client using WithDelegation. It is an
+// http.Handler for both the challenge requests of the CA and the tasks of
+// the client, and Run keeps it registered with the client.
+type Agent struct {
+	// Name identifies the agent; URL is where the client posts tasks to it.
+	Name string
+	URL  string
+	// Registry is the URL of the client's AgentRegistryHandler.
+	Registry string
+	// Secret is the secret shared with the client.
+	Secret []byte
+
+	mu     sync.Mutex
+	tokens map[string]*Task
+}
+
+// ServeHTTP serves the challenge responses and accepts signed tasks posted
+// to any other path.
+func (a *Agent) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if strings.HasPrefix(r.URL.Path, "/.well-known/acme-challenge/") {
+		a.serveChallenge(w, r)
+		return
+	}
+	if r.Method != "POST" {
+		http.NotFound(w, r)
+		return
+	}
+	t, err := ParseTask(r, a.Secret)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusForbidden)
+		return
+	}
+	if t.Challenge.Type != ChallengeHTTP {
+		http.Error(w, ErrUnsupportedChtype.Error(), http.StatusBadRequest)
+		return
+	}
+	now := time.Now()
+	a.mu.Lock()
+	for record, old := range a.tokens {
+		if now.After(old.Expires) {
+			delete(a.tokens, record)
+		}
+	}
+	if t.Done {
+		delete(a.tokens, t.Challenge.Record)
+		a.mu.Unlock()
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+	if t.Expires.IsZero() || t.Expires.After(now.Add(agentTaskTTL)) {
+		t.Expires = now.Add(agentTaskTTL)
+	}
+	if a.tokens == nil {
+		a.tokens = make(map[string]*Task)
+	}
+	a.tokens[t.Challenge.Record] = t
+	a.mu.Unlock()
+	w.WriteHeader(http.StatusAccepted)
+	go Complete(context.Background(), t, a.Secret, nil)
+}
+
+// serveChallenge answers a validation request of the CA.
+func (a *Agent) serveChallenge(w http.ResponseWriter, r *http.Request) {
+	record := "http://" + (&url.URL{Host: r.Host}).Hostname() + r.URL.Path
+	a.mu.Lock()
+	t, ok := a.tokens[record]
+	if ok && time.Now().After(t.Expires) {
+		delete(a.tokens, record)
+		ok = false
+	}
+	a.mu.Unlock()
+	if !ok {
+		http.NotFound(w, r)
+		return
+	}
+	w.Header().Set("Content-Type", "text/plain")
+	io.WriteString(w, t.Challenge.Value)
+}
+
+// Run registers the agent with the client until ctx is done, renewing the
+// registration before it expires.
+func (a *Agent) Run(ctx context.Context) error {
+	reg := Registration{Name: a.Name, URL: a.URL, Challenges: []string{ChallengeHTTP}}
+	for {
+		if err := postSigned(ctx, a.Registry, a.Secret, reg); err != nil && ctx.Err() == nil {
+			logrus.WithField("context", "agent").Warnf("registering with %s: %s", a.Registry, err)
+		}
+		select {
+		case <-time.After(agentTTL / 3):
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
@@ -2,19 +2,40 @@ package acme
 
 import (
 	"context"
+	"crypto/tls"
 	"errors"
 	"fmt"
-	"golang.org/x/crypto/acme"
 	"io"
+	"io/ioutil"
+	"net"
 	"net/http"
 	"os"
-	"time"
+	"strings"
+
+	"golang.org/x/crypto/acme"
 )
 
-var ErrNoChallenges = errors.New("no suitable challenge found")
+// Challenge types accepted by Create. ChallengeAuto uses http-01 unless the
+// name is a wildcard or the domain is behind a CDN, and dns-01 otherwise, or
+// dns-account-01 if the CA offers no dns-01 challenge.
+// ChallengeTLSALPN needs the server on port 443 to use GetCertificate of the
+// same Client, so it cannot be used by RenewAll in a separate process; see
+// NewListener for the first certificate.
+const (
+	ChallengeHTTP       = "http"
+	ChallengeDNS        = "dns"
+	ChallengeDNSAccount = "dns-account"
+	ChallengeTLSALPN    = "tls-alpn"
+	ChallengeAuto       = "auto"
+)
+
+var (
+	ErrNoChallenges      = errors.New("no suitable challenge found")
+	ErrUnsupportedChtype = errors.New("unsupported challenge type")
+)
 
-// http-01 challenge is supported.
-func HttpChallenge(auth *acme.Authorization) (*acme.Challenge, error) {
+// HTTPChallenge returns the http-01 challenge of the authorization.
+func HTTPChallenge(auth *acme.Authorization) (*acme.Challenge, error) {
 	var chal *acme.Challenge
 	for _, c := range auth.Challenges {
 		if c.Type == "http-01" {
@@ -27,8 +48,8 @@ func HttpChallenge(auth *acme.Authorization) (*acme.Challenge, error) {
 	return chal, nil
 }
 
-// dns-01 challenge is supported.
-func DnsChallenge(auth *acme.Authorization) (*acme.Challenge, error) {
+// DNSChallenge returns the dns-01 challenge of the authorization.
+func DNSChallenge(auth *acme.Authorization) (*acme.Challenge, error) {
 	var chal *acme.Challenge
 	for _, c := range auth.Challenges {
 		if c.Type == "dns-01" {
@@ -41,113 +62,259 @@ func DnsChallenge(auth *acme.Authorization) (*acme.Challenge, error) {
 	return chal, nil
 }
 
-
-// Http-01 PerHttpChallenge creates a temporary server that ACME can access to verify
-// ownership of a domain name.
-func (c *Client) PerHttpChallenge(ctx context.Context, chal *acme.Challenge, domain, path string) error {
+// SolveHTTP writes the http-01 response for the challenge below path, waits
+// until it is served for domain and asks the CA to validate it. The response
+// is also served by HTTPHandler; if path is empty, no file is written. The
+// file and the response are removed when SolveHTTP returns.
+func (c *Client) SolveHTTP(ctx context.Context, chal *acme.Challenge, domain, path string) error {
 	c.log.Debugf("attempting HTTP challenge on :http")
-	url := c.client.HTTP01ChallengePath(chal.Token)
-	response, err := c.client.HTTP01ChallengeResponse(chal.Token)
+	url := c.ca().HTTP01ChallengePath(chal.Token)
+	response, err := c.ca().HTTP01ChallengeResponse(chal.Token)
 	if err != nil {
 		return err
 	}
-	file, err := os.Create(path + "/" + chal.Token)
+	c.tokens.put(chal.Token, response)
+	defer c.tokens.remove(chal.Token)
+	cleanup, err := c.presentHTTP(ctx, chal.Token, response)
 	if err != nil {
 		return err
 	}
-	_, err = file.WriteString(response)
-	file.Close()
+	defer cleanup()
+	if path != "" {
+		name := path + "/" + chal.Token
+		file, err := os.Create(name)
+		if err != nil {
+			return err
+		}
+		defer os.Remove(name)
+		_, err = file.WriteString(response)
+		file.Close()
+		if err != nil {
+			return err
+		}
+	}
+	fmt.Print("http://", domain+url, " ", "value: "+response, "\n")
+	for {
+		value, err := fetchHTTP(ctx, "http://"+domain+url)
+		if err == nil && value == response {
+			break
+		}
+		if err := c.wait(ctx); err != nil {
+			return err
+		}
+	}
+	return c.accept(ctx, chal)
+}
+
+// SolveDNS prints the dns-01 TXT record for the challenge, waits until it is
+// visible for domain and asks the CA to validate it. When the order has
+// several challenges for the same record, such as for example.com and
+// *.example.com, all values must be added and are checked together.
+func (c *Client) SolveDNS(ctx context.Context, chal *acme.Challenge, domain string) error {
+	c.log.Debugf("attempting DNS challenge on %s", domain)
+	tok, err := c.ca().DNS01ChallengeRecord(chal.Token)
 	if err != nil {
 		return err
 	}
-	fmt.Print("http://", domain + url, " ", "value: " + response , "\n")
-	var resp = &http.Response{StatusCode:600}
-	var value string
+	done, err := c.waitTXT(ctx, "_acme-challenge."+domain, tok)
+	if err != nil {
+		return err
+	}
+	defer done()
+	return c.accept(ctx, chal)
+}
 
-	for response != value {
-		for resp.StatusCode != 200{
-			resp, err = http.Get("http://" +  domain + url)
-			if resp.StatusCode != 200 {
-				time.Sleep(time.Second *10 )
-			}
-		}
-		defer resp.Body.Close()
+// accept tells the CA the challenge is ready and waits for it to be
+// validated.
+func (c *Client) accept(ctx context.Context, chal *acme.Challenge) error {
+	uri := chal.URI
+	if err := c.validateURL("challenge url", uri); err != nil {
+		return err
+	}
+	chal, err := c.ca().Accept(ctx, chal)
+	for {
 		if err != nil {
 			return err
 		}
-		if value != "" {
-			time.Sleep(time.Second *10 )
+		if err := c.checkChallenge(chal); err != nil {
+			return err
 		}
-		buf := make([]byte, 1*128)
-		for {
-			n, err := resp.Body.Read(buf)
-			if n == 0 {
-				if err != io.EOF {
-					return err
-				}
-				break
+		switch chal.Status {
+		case acme.StatusValid:
+			return nil
+		case acme.StatusInvalid:
+			if chal.Error != nil {
+				return chal.Error
 			}
-			value += string(buf[:n])
+			return fmt.Errorf("%s challenge is invalid", chal.Type)
 		}
-		if err != nil {
+		if err := c.wait(ctx); err != nil {
 			return err
 		}
-		break
+		chal, err = c.ca().GetChallenge(ctx, uri)
 	}
-	_, err = c.client.Accept(ctx, chal)
-	if err != nil {
-		return err
+}
+
+// maxRedirects is the number of redirects followed by fetchHTTP, the same
+// as Let's Encrypt's validation.
+const maxRedirects = 10
+
+// challengeClient fetches http-01 responses the way Let's Encrypt does: it
+// follows redirects to http and https on the standard ports and does not
+// verify certificates, since the CA accepts any certificate on redirects.
+var challengeClient = &http.Client{
+	Transport: &http.Transport{
+		TLSClientConfig: &tls.Config{InsecureSkipVerify: true},
+	},
+	CheckRedirect: checkRedirect,
+}
+
+// checkRedirect rejects the redirects Let's Encrypt refuses to follow.
+func checkRedirect(req *http.Request, via []*http.Request) error {
+	if len(via) > maxRedirects {
+		return fmt.Errorf("too many redirects")
 	}
-	_, err = c.client.WaitAuthorization(ctx, chal.URI)
-	return err
+	u := req.URL
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return fmt.Errorf("redirect to unsupported scheme %q", u.Scheme)
+	}
+	if p := u.Port(); p != "" && p != "80" && p != "443" {
+		return fmt.Errorf("redirect to unsupported port %s", p)
+	}
+	if net.ParseIP(u.Hostname()) != nil {
+		return fmt.Errorf("redirect to IP address %s", u.Hostname())
+	}
+	return nil
 }
 
-// Dns-01 PerDnsChallenge creates a temporary server that ACME can access to verify
-// ownership of a domain name.
-func (c *Client) PerDnsChallenge(ctx context.Context, chal *acme.Challenge, domain string) error {
-	c.log.Debugf("attempting DNS challenge on %s", domain)
-	tok, err := c.client.DNS01ChallengeRecord(chal.Token)
-	fmt.Printf("Please add DNS TXT parsing:  _acme-challenge.%s ----> %s\n", domain,tok )
+// fetchHTTP returns the body served at the provided URL if the status is 200,
+// following redirects like the CA does. Surrounding whitespace is removed,
+// as the CA ignores it.
+func fetchHTTP(ctx context.Context, url string) (string, error) {
+	req, err := http.NewRequest("GET", url, nil)
 	if err != nil {
-		return err
+		return "", err
+	}
+	resp, err := challengeClient.Do(req.WithContext(ctx))
+	if err != nil {
+		return "", err
 	}
-	var res string
-	for res != tok {
-		time.Sleep(time.Second*10)
-		res = TxtChange(domain)
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("%s: unexpected status %s", resp.Request.URL, resp.Status)
 	}
-	_, err = c.client.Accept(ctx, chal)
+	b, err := ioutil.ReadAll(io.LimitReader(resp.Body, 1<<10))
 	if err != nil {
-		return err
+		return "", err
 	}
-	_, err = c.client.WaitAuthorization(ctx, chal.URI)
-	return err
+	return strings.TrimSpace(string(b)), nil
 }
 
-// authorize attempts to authorize the provided domain name in preparation for
-// obtaining a TLS certificate.
-func (c *Client) authorize(ctx context.Context, domain, chtype, path string) error {
-	c.log.Debugf("authorizing %s", domain)
-	auth, err := c.client.Authorize(ctx, domain)
+// selectChallenge resolves ChallengeAuto for the authorization and warns if
+// http-01 is used for a domain behind a CDN, which usually makes it fail.
+func (c *Client) selectChallenge(ctx context.Context, auth *acme.Authorization, chtype string) string {
+	if chtype != ChallengeHTTP && chtype != ChallengeAuto {
+		return chtype
+	}
+	domain := auth.Identifier.Value
+	if chtype == ChallengeAuto && auth.Wildcard {
+		return autoDNS(auth)
+	}
+	cdn := c.detectCDN(ctx, domain)
+	switch {
+	case cdn == "":
+		return ChallengeHTTP
+	case chtype == ChallengeAuto:
+		chtype = autoDNS(auth)
+		c.log.Infof("%s is behind %s, using %s-01", domain, cdn, chtype)
+		return chtype
+	default:
+		c.log.Warnf("%s is behind %s, http-01 will likely fail; use dns-01", domain, cdn)
+		return ChallengeHTTP
+	}
+}
+
+// autoDNS returns the DNS challenge type ChallengeAuto uses for the
+// authorization: dns-01, or dns-account-01 if that is the only one offered.
+func autoDNS(auth *acme.Authorization) string {
+	if _, err := DNSChallenge(auth); err != nil {
+		if _, err := DNSAccountChallenge(auth); err == nil {
+			return ChallengeDNSAccount
+		}
+	}
+	return ChallengeDNS
+}
+
+// findChallenge returns the challenge of type chtype of the authorization.
+func findChallenge(auth *acme.Authorization, chtype string) (*acme.Challenge, error) {
+	switch chtype {
+	case ChallengeHTTP:
+		return HTTPChallenge(auth)
+	case ChallengeDNS:
+		return DNSChallenge(auth)
+	case ChallengeDNSAccount:
+		return DNSAccountChallenge(auth)
+	case ChallengeTLSALPN:
+		return TLSALPNChallenge(auth)
+	}
+	return nil, ErrUnsupportedChtype
+}
+
+// authzDomain returns the domain name an authorization is for.
+func authzDomain(auth *acme.Authorization) string {
+	if auth.Wildcard {
+		return "*." + auth.Identifier.Value
+	}
+	return auth.Identifier.Value
+}
+
+// authorize completes the authorization at authzURL in preparation for
+// obtaining a TLS certificate and returns the domain name it is for.
+func (c *Client) authorize(ctx context.Context, authzURL, chtype, path string) (string, error) {
+	auth, err := c.ca().GetAuthorization(ctx, authzURL)
 	if err != nil {
-		return err
+		return "", err
+	}
+	domain := authzDomain(auth)
+	if err := c.checkAuthorization(auth); err != nil {
+		return domain, err
 	}
 	if auth.Status == acme.StatusValid {
-		return nil
+		return domain, nil
 	}
-	if chtype == "http"{
-		chal, err := HttpChallenge(auth)
-		if err != nil {
-			return err
-		}
-		return c.PerHttpChallenge(ctx, chal, domain, path)
-	} else if chtype == "dns" {
-		chal, err := DnsChallenge(auth)
-		if err != nil {
-			return err
-		}
-		return c.PerDnsChallenge(ctx, chal, domain)
+	c.log.Debugf("authorizing %s", domain)
+	if c.delegation != nil {
+		err = c.delegate(ctx, auth, chtype)
 	} else {
-		return errors.New("No support for other challenges")
+		err = c.solve(ctx, auth, chtype, path)
+	}
+	if err != nil {
+		return domain, err
 	}
-}
\ No newline at end of file
+	auth, err = c.ca().WaitAuthorization(ctx, authzURL)
+	if err != nil {
+		return domain, err
+	}
+	return domain, c.checkAuthorization(auth)
+}
+
+// solve places the challenge of the authorization locally and asks the CA
+// to validate it.
+func (c *Client) solve(ctx context.Context, auth *acme.Authorization, chtype, path string) error {
+	chtype = c.selectChallenge(ctx, auth, chtype)
+	chal, err := findChallenge(auth, chtype)
+	if err != nil {
+		return err
+	}
+	switch chtype {
+	case ChallengeHTTP:
+		err = c.SolveHTTP(ctx, chal, auth.Identifier.Value, path)
+	case ChallengeDNS:
+		err = c.SolveDNS(ctx, chal, auth.Identifier.Value)
+	case ChallengeDNSAccount:
+		err = c.SolveDNSAccount(ctx, chal, auth.Identifier.Value)
+	case ChallengeTLSALPN:
+		err = c.SolveTLSALPN(ctx, chal, auth.Identifier.Value)
+	}
+	return err
+}
@@ -0,0 +1,197 @@
+package acme
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"golang.org/x/crypto/scrypt"
+)
+
+// backupMagic starts every backup and identifies its format version.
+const backupMagic = "LETSENCRYPT-BACKUP-1\n"
+
+var (
+	ErrBadBackup     = errors.New("not a backup or wrong passphrase")
+	ErrRestoreTarget = errors.New("restore directory is not empty")
+)
+
+// backupKey derives the encryption key of a backup from the passphrase.
+func backupKey(passphrase, salt []byte) (cipher.AEAD, error) {
+	k, err := scrypt.Key(passphrase, salt, 1<<15, 8, 1, 32)
+	if err != nil {
+		return nil, err
+	}
+	block, err := aes.NewCipher(k)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// Backup writes the accounts, certificates, keys, renewal parameters and
+// archived versions in dir to w as a gzipped tar archive encrypted with
+// AES-GCM under a key derived from passphrase. Leases are left out. The
+// backup is restored with Restore.
+func Backup(w io.Writer, dir string, passphrase []byte) error {
+	var buf bytes.Buffer
+	zw := gzip.NewWriter(&buf)
+	tw := tar.NewWriter(zw)
+	err := filepath.Walk(dir, func(p string, fi os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(dir, p)
+		if err != nil || rel == "." || strings.HasSuffix(rel, ".lease") {
+			return err
+		}
+		link := ""
+		if fi.Mode()&os.ModeSymlink != 0 {
+			if link, err = os.Readlink(p); err != nil {
+				return err
+			}
+		}
+		h, err := tar.FileInfoHeader(fi, link)
+		if err != nil {
+			return err
+		}
+		h.Name = filepath.ToSlash(rel)
+		if err := tw.WriteHeader(h); err != nil {
+			return err
+		}
+		if !fi.Mode().IsRegular() {
+			return nil
+		}
+		b, err := ioutil.ReadFile(p)
+		if err != nil {
+			return err
+		}
+		_, err = tw.Write(b)
+		return err
+	})
+	if err != nil {
+		return err
+	}
+	if err := tw.Close(); err != nil {
+		return err
+	}
+	if err := zw.Close(); err != nil {
+		return err
+	}
+	salt := make([]byte, 16)
+	if _, err := rand.Read(salt); err != nil {
+		return err
+	}
+	aead, err := backupKey(passphrase, salt)
+	if err != nil {
+		return err
+	}
+	nonce := make([]byte, aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return err
+	}
+	out := append([]byte(backupMagic), salt...)
+	out = append(out, nonce...)
+	out = aead.Seal(out, nonce, buf.Bytes(), []byte(backupMagic))
+	_, err = w.Write(out)
+	return err
+}
+
+// Restore unpacks a backup written by Backup into dir, which must be empty
+// or not exist yet, e.g. when moving to a new host.
+func Restore(r io.Reader, dir string, passphrase []byte) error {
+	b, err := ioutil.ReadAll(r)
+	if err != nil {
+		return err
+	}
+	if !bytes.HasPrefix(b, []byte(backupMagic)) || len(b) < len(backupMagic)+16 {
+		return ErrBadBackup
+	}
+	b = b[len(backupMagic):]
+	aead, err := backupKey(passphrase, b[:16])
+	if err != nil {
+		return err
+	}
+	b = b[16:]
+	if len(b) < aead.NonceSize() {
+		return ErrBadBackup
+	}
+	plain, err := aead.Open(nil, b[:aead.NonceSize()], b[aead.NonceSize():], []byte(backupMagic))
+	if err != nil {
+		return ErrBadBackup
+	}
+	if entries, err := ioutil.ReadDir(dir); err == nil && len(entries) > 0 {
+		return fmt.Errorf("%w: %s", ErrRestoreTarget, dir)
+	}
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return err
+	}
+	zr, err := gzip.NewReader(bytes.NewReader(plain))
+	if err != nil {
+		return err
+	}
+	tr := tar.NewReader(zr)
+	links := make(map[string]bool)
+	for {
+		h, err := tr.Next()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		name := path.Clean(h.Name)
+		if path.IsAbs(name) || name == ".." || strings.HasPrefix(name, "../") || throughLink(links, name) {
+			return fmt.Errorf("%w: invalid path %s", ErrBadBackup, h.Name)
+		}
+		p := filepath.Join(dir, filepath.FromSlash(name))
+		mode := os.FileMode(h.Mode).Perm()
+		switch h.Typeflag {
+		case tar.TypeDir:
+			err = os.MkdirAll(p, mode)
+		case tar.TypeSymlink:
+			raw := path.Dir(name) + "/" + h.Linkname
+			target := path.Clean(raw)
+			if path.IsAbs(h.Linkname) || target == ".." || strings.HasPrefix(target, "../") || throughLink(links, raw) {
+				return fmt.Errorf("%w: invalid link %s", ErrBadBackup, h.Name)
+			}
+			links[name] = true
+			err = os.Symlink(h.Linkname, p)
+		case tar.TypeReg:
+			var data []byte
+			if data, err = ioutil.ReadAll(tr); err == nil {
+				err = ioutil.WriteFile(p, data, mode)
+			}
+		}
+		if err != nil {
+			return err
+		}
+	}
+}
+
+// throughLink reports whether the slash-separated path p, relative to the
+// restore directory, passes through one of the symlinks extracted so far
+// before its last element. Such a path is resolved against the link target
+// rather than lexically, so it could leave the directory.
+func throughLink(links map[string]bool, p string) bool {
+	elems := strings.Split(p, "/")
+	cur := "."
+	for _, e := range elems[:len(elems)-1] {
+		cur = path.Join(cur, e)
+		if links[cur] {
+			return true
+		}
+	}
+	return false
+}
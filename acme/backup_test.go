@@ -0,0 +1,101 @@
+package acme
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"crypto/rand"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// sealBackup encrypts a tar archive of entries the way Backup does.
+func sealBackup(t *testing.T, passphrase []byte, entries []*tar.Header) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	zw := gzip.NewWriter(&buf)
+	tw := tar.NewWriter(zw)
+	for _, h := range entries {
+		if err := tw.WriteHeader(h); err != nil {
+			t.Fatal(err)
+		}
+		if h.Size > 0 {
+			tw.Write(bytes.Repeat([]byte("x"), int(h.Size)))
+		}
+	}
+	tw.Close()
+	zw.Close()
+	salt := make([]byte, 16)
+	rand.Read(salt)
+	aead, err := backupKey(passphrase, salt)
+	if err != nil {
+		t.Fatal(err)
+	}
+	nonce := make([]byte, aead.NonceSize())
+	rand.Read(nonce)
+	out := append([]byte(backupMagic), salt...)
+	out = append(out, nonce...)
+	return aead.Seal(out, nonce, buf.Bytes(), []byte(backupMagic))
+}
+
+func TestRestoreRejectsEscapes(t *testing.T) {
+	link := func(name, target string) *tar.Header {
+		return &tar.Header{Typeflag: tar.TypeSymlink, Name: name, Linkname: target, Mode: 0777}
+	}
+	file := func(name string) *tar.Header {
+		return &tar.Header{Typeflag: tar.TypeReg, Name: name, Size: 1, Mode: 0600}
+	}
+	tests := []struct {
+		name    string
+		entries []*tar.Header
+	}{
+		{"parent path", []*tar.Header{file("../x")}},
+		{"absolute link", []*tar.Header{link("a", "/etc")}},
+		{"parent link", []*tar.Header{link("a", "../x")}},
+		{"link under link", []*tar.Header{link("a", "."), link("a/c", "../x")}},
+		{"file under link", []*tar.Header{link("a", "."), file("a/../../x")}},
+		{"link through link", []*tar.Header{link("s", "."), link("t", "s/../x")}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			root := t.TempDir()
+			dir := filepath.Join(root, "state")
+			b := sealBackup(t, []byte("secret"), tt.entries)
+			err := Restore(bytes.NewReader(b), dir, []byte("secret"))
+			if !errors.Is(err, ErrBadBackup) {
+				t.Fatalf("Restore = %v, want ErrBadBackup", err)
+			}
+			if _, err := os.Lstat(filepath.Join(root, "x")); !os.IsNotExist(err) {
+				t.Fatalf("entry escaped the restore directory")
+			}
+		})
+	}
+}
+
+func TestBackupRoundTrip(t *testing.T) {
+	src := t.TempDir()
+	os.MkdirAll(filepath.Join(src, "archive"), 0700)
+	os.WriteFile(filepath.Join(src, "archive", "a.crt"), []byte("cert"), 0644)
+	os.Symlink("archive/a.crt", filepath.Join(src, "a.crt"))
+	os.WriteFile(filepath.Join(src, "a.lease"), []byte("{}"), 0644)
+	var buf bytes.Buffer
+	if err := Backup(&buf, src, []byte("secret")); err != nil {
+		t.Fatal(err)
+	}
+	if err := Restore(bytes.NewReader(buf.Bytes()), t.TempDir(), []byte("wrong")); !errors.Is(err, ErrBadBackup) {
+		t.Fatalf("Restore with wrong passphrase = %v", err)
+	}
+	dst := filepath.Join(t.TempDir(), "state")
+	if err := Restore(bytes.NewReader(buf.Bytes()), dst, []byte("secret")); err != nil {
+		t.Fatal(err)
+	}
+	b, err := os.ReadFile(filepath.Join(dst, "a.crt"))
+	if err != nil || string(b) != "cert" {
+		t.Fatalf("a.crt = %q, %v", b, err)
+	}
+	if _, err := os.Stat(filepath.Join(dst, "a.lease")); !os.IsNotExist(err) {
+		t.Fatal("lease was restored")
+	}
+}
@@ -0,0 +1,171 @@
+package acme
+
+import (
+	"context"
+	"crypto"
+	"sync"
+	"time"
+)
+
+// Request describes a single certificate issued by CreateBatch.
+type Request struct {
+	Dir     string   `json:"dir"`
+	Name    string   `json:"name"`
+	Chtype  string   `json:"chtype"`
+	Domains []string `json:"domains"`
+
+	// Priority orders requests in a Queue; higher runs first.
+	Priority int `json:"priority,omitempty"`
+}
+
+// Progress is called by CreateBatch each time a request finishes.
+type Progress func(done, total int, req Request, err error)
+
+// csrResult holds the outcome of generating a key and CSR for a request.
+// A new key is only written once the request's issuance has started.
+type csrResult struct {
+	csr   []byte
+	fresh crypto.Signer
+	err   error
+}
+
+// CreateBatch creates certificates for all of the provided requests. Keys and
+// CSRs are generated by a pool of workers while the authorizations for the
+// same requests are in flight, and at most workers requests are issued at
+// once. Like Create, a request shares the issuance of a concurrent call for
+// the same certificate. The first error encountered is returned after all
+// requests finish; an invalid domain name fails the batch before anything
+// is issued.
+func (c *Client) CreateBatch(ctx context.Context, reqs []Request, workers int, progress Progress) error {
+	if err := c.writable(); err != nil {
+		return err
+	}
+	if workers < 1 {
+		workers = 1
+	}
+	cfgs := make([]*RenewalConfig, len(reqs))
+	for i, r := range reqs {
+		cfg, err := inheritDefaults(r.Dir, c.newConfig(r.Name, r.Chtype, r.Domains))
+		if err != nil {
+			return err
+		}
+		if err := cfg.normalize(); err != nil {
+			return err
+		}
+		cfgs[i] = cfg
+	}
+	results := make([]chan csrResult, len(reqs))
+	jobs := make(chan int)
+	for i := range reqs {
+		results[i] = make(chan csrResult, 1)
+	}
+	for w := 0; w < workers; w++ {
+		go func() {
+			for i := range jobs {
+				b, fresh, err := c.newCSR(reqs[i].Dir, cfgs[i])
+				results[i] <- csrResult{csr: b, fresh: fresh, err: err}
+			}
+		}()
+	}
+	go func() {
+		defer close(jobs)
+		for i := range reqs {
+			select {
+			case jobs <- i:
+			case <-ctx.Done():
+				for ; i < len(reqs); i++ {
+					results[i] <- csrResult{err: ctx.Err()}
+				}
+				return
+			}
+		}
+	}()
+
+	var (
+		mu    sync.Mutex
+		done  int
+		first error
+		wg    sync.WaitGroup
+		sem   = make(chan struct{}, workers)
+	)
+	for i, r := range reqs {
+		wg.Add(1)
+		sem <- struct{}{}
+		go func(i int, r Request) {
+			defer func() {
+				<-sem
+				wg.Done()
+			}()
+			err := c.issueWith(ctx, r.Dir, cfgs[i], func(ctx context.Context) error {
+				return c.createRequest(ctx, r.Dir, cfgs[i], results[i])
+			})
+			if err != nil {
+				c.log.Errorf("%s: %s", r.Name, err)
+			}
+			mu.Lock()
+			defer mu.Unlock()
+			done++
+			if err != nil && first == nil {
+				first = err
+			}
+			if progress != nil {
+				perr := protect("progress callback", func() error {
+					progress(done, len(reqs), r, err)
+					return nil
+				})
+				if perr != nil {
+					c.log.Errorf("%s", perr)
+				}
+			}
+		}(i, r)
+	}
+	wg.Wait()
+	return first
+}
+
+// createRequest issues a single batch request once its CSR is ready. It
+// runs at most once per request: a request sharing the issuance of another
+// call leaves its CSR unused.
+func (c *Client) createRequest(ctx context.Context, dir string, cfg *RenewalConfig, result <-chan csrResult) (err error) {
+	ctx, op := c.operation(ctx)
+	defer func() {
+		err = op.wrap(err)
+	}()
+	release, err := c.acquire(ctx)
+	if err != nil {
+		return err
+	}
+	defer release()
+	unlease, err := c.lease(dir, cfg.Name)
+	if err != nil {
+		return err
+	}
+	defer unlease()
+	defer func(start time.Time) {
+		c.record(dir, cfg, start, err)
+	}(c.clock.Now())
+	ctx, cancel := c.withDeadline(ctx)
+	defer cancel()
+	o, err := c.authorizeOrder(ctx, dir, cfg)
+	var res csrResult
+	if err == nil {
+		select {
+		case res = <-result:
+		case <-ctx.Done():
+			res.err = ctx.Err()
+		}
+		err = res.err
+	}
+	if err == nil && res.fresh != nil {
+		err = writeCertKey(dir, cfg.Name+pendingKeySuffix, res.fresh)
+	}
+	if err == nil {
+		err = c.createCert(ctx, o, res.csr, dir, cfg)
+	}
+	if err != nil {
+		if err := c.retry(ctx, dir, cfg, err); err != nil {
+			return err
+		}
+	}
+	return c.finish(ctx, dir, cfg)
+}
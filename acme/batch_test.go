@@ -0,0 +1,42 @@
+package acme
+
+import (
+	"context"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestCreateBatchSharesIssuance(t *testing.T) {
+	ca := newTestCA(t)
+	var finalized int32
+	ca.before = func(path string) {
+		if strings.HasPrefix(path, "/finalize/") && atomic.AddInt32(&finalized, 1) == 1 {
+			time.Sleep(300 * time.Millisecond)
+		}
+	}
+	dir := t.TempDir()
+	c := ca.newClient(t, dir)
+	ctx := context.Background()
+	done := make(chan error)
+	go func() {
+		done <- c.Create(ctx, dir, "a", ChallengeHTTP, "a.example")
+	}()
+	time.Sleep(50 * time.Millisecond)
+	reqs := []Request{
+		{Dir: dir, Name: "a", Chtype: ChallengeHTTP, Domains: []string{"a.example"}},
+		{Dir: dir, Name: "b", Chtype: ChallengeHTTP, Domains: []string{"b.example"}},
+	}
+	if err := c.CreateBatch(ctx, reqs, 2, nil); err != nil {
+		t.Fatal(err)
+	}
+	if err := <-done; err != nil {
+		t.Fatal(err)
+	}
+	if n := ca.count("/new-order"); n != 2 {
+		t.Errorf("placed %d orders, want 2", n)
+	}
+	loadLeaf(t, dir, "a")
+	loadLeaf(t, dir, "b")
+}
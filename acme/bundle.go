@@ -0,0 +1,70 @@
+package acme
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+)
+
+// WritePendingOrder writes the pending order as a bundle for another
+// machine, such as one holding the DNS credentials but not the account and
+// certificate keys. The bundle has the order URL, tokens and key
+// authorizations, none of which allow issuing a certificate.
+func WritePendingOrder(w io.Writer, p *PendingOrder) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(p)
+}
+
+// ReadPendingOrder reads a bundle written by WritePendingOrder.
+func ReadPendingOrder(r io.Reader) (*PendingOrder, error) {
+	p := &PendingOrder{}
+	if err := json.NewDecoder(r).Decode(p); err != nil {
+		return nil, err
+	}
+	if p.Version > pendingVersion {
+		return nil, fmt.Errorf("pending order file version %d is not supported", p.Version)
+	}
+	return p, nil
+}
+
+// Check verifies that all challenges of the pending order are in place, so
+// the machine placing them can report back before Continue is run where
+// the order was started. TXT records are checked with VerifyTXT.
+func (p *PendingOrder) Check(ctx context.Context) error {
+	return p.check(ctx, VerifyTXT)
+}
+
+// check verifies the challenges, looking up TXT records with verify.
+func (p *PendingOrder) check(ctx context.Context, verify txtVerifier) error {
+	for _, pc := range p.Challenges {
+		if err := pc.check(ctx, verify); err != nil {
+			return fmt.Errorf("%s: %w", pc.Domain, err)
+		}
+	}
+	return nil
+}
+
+// HTTPHandler serves the http-01 challenges of the pending order, for the
+// machine receiving the validation requests. Other requests are passed to
+// fallback, or get 404 if fallback is nil.
+func (p *PendingOrder) HTTPHandler(fallback http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		host := (&url.URL{Host: r.Host}).Hostname()
+		for _, pc := range p.Challenges {
+			if pc.Type == ChallengeHTTP && pc.Record == "http://"+host+r.URL.Path {
+				w.Header().Set("Content-Type", "text/plain")
+				io.WriteString(w, pc.Value)
+				return
+			}
+		}
+		if fallback == nil {
+			http.NotFound(w, r)
+			return
+		}
+		fallback.ServeHTTP(w, r)
+	})
+}
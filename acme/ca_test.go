@@ -0,0 +1,413 @@
+package acme
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/fireflyst/letsencrypt/acme/acmetest"
+)
+
+// testCA is an in-memory ACME server. Orders are ready as soon as they are
+// created and certificates are issued for whatever the CSR asks. Requests
+// signed with an account URL are checked against the account's key.
+type testCA struct {
+	*httptest.Server
+
+	// before, if set, is called with the path of every request before it
+	// is answered.
+	before func(path string)
+
+	// keyChangeFault, if set, makes key-change requests fail: "lost"
+	// changes the key but answers with an error, as if the response was
+	// lost, and "rejected" answers with an error without changing it.
+	keyChangeFault string
+
+	mu       sync.Mutex
+	nonce    int
+	hits     map[string]int
+	accounts []*rsa.PublicKey
+	orders   []*testOrder
+	key      *ecdsa.PrivateKey
+	cert     *x509.Certificate
+}
+
+// testOrder is an order of a testCA.
+type testOrder struct {
+	domains []string
+	status  string
+	chain   []byte
+}
+
+// jws is a flattened JSON web signature as sent by the client.
+type jws struct {
+	Protected string `json:"protected"`
+	Payload   string `json:"payload"`
+	Signature string `json:"signature"`
+}
+
+// jwsHeader is the protected header of a jws.
+type jwsHeader struct {
+	Alg string          `json:"alg"`
+	KID string          `json:"kid"`
+	JWK json.RawMessage `json:"jwk"`
+}
+
+func newTestCA(t *testing.T) *testCA {
+	t.Helper()
+	ca := &testCA{hits: make(map[string]int)}
+	var err error
+	ca.key, err = ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	now := time.Now()
+	tmpl := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "test ca"},
+		NotBefore:             now.Add(-time.Hour),
+		NotAfter:              now.Add(365 * 24 * time.Hour),
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+		KeyUsage:              x509.KeyUsageCertSign,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, ca.key.Public(), ca.key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ca.cert, err = x509.ParseCertificate(der); err != nil {
+		t.Fatal(err)
+	}
+	ca.Server = httptest.NewTLSServer(http.HandlerFunc(ca.serve))
+	t.Cleanup(ca.Close)
+	return ca
+}
+
+// newClient registers an account with the CA and returns a client using it
+// with the certificates in dir.
+func (ca *testCA) newClient(t *testing.T, dir string, opts ...Option) *Client {
+	t.Helper()
+	k, err := acmetest.WriteAccount(dir, "account")
+	if err != nil {
+		t.Fatal(err)
+	}
+	ca.register(&k.PublicKey)
+	opts = append([]Option{WithInsecure(), WithDirectoryURL(ca.URL + "/dir")}, opts...)
+	c, err := New(context.Background(), dir, "account", "", opts...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return c
+}
+
+// register creates an account for the key and returns its URL.
+func (ca *testCA) register(k *rsa.PublicKey) string {
+	ca.mu.Lock()
+	defer ca.mu.Unlock()
+	ca.accounts = append(ca.accounts, k)
+	return ca.accountURL(len(ca.accounts) - 1)
+}
+
+// accountURL returns the URL of account i. The caller holds mu.
+func (ca *testCA) accountURL(i int) string {
+	return ca.URL + "/account/" + strconv.Itoa(i)
+}
+
+// lookup returns the index of the account with key k, or -1. The caller
+// holds mu.
+func (ca *testCA) lookup(k *rsa.PublicKey) int {
+	for i, a := range ca.accounts {
+		if a != nil && a.Equal(k) {
+			return i
+		}
+	}
+	return -1
+}
+
+// count returns how often path was requested.
+func (ca *testCA) count(path string) int {
+	ca.mu.Lock()
+	defer ca.mu.Unlock()
+	return ca.hits[path]
+}
+
+func (ca *testCA) serve(w http.ResponseWriter, r *http.Request) {
+	if ca.before != nil {
+		ca.before(r.URL.Path)
+	}
+	ca.mu.Lock()
+	defer ca.mu.Unlock()
+	ca.hits[r.URL.Path]++
+	ca.nonce++
+	w.Header().Set("Replay-Nonce", strconv.Itoa(ca.nonce))
+	switch r.URL.Path {
+	case "/dir":
+		w.Write(acmetest.Directory(ca.URL))
+		return
+	case "/new-nonce":
+		return
+	}
+	if r.Method != http.MethodPost {
+		ca.problem(w, "malformed", "not a POST request", http.StatusMethodNotAllowed)
+		return
+	}
+	var req jws
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		ca.problem(w, "malformed", err.Error(), http.StatusBadRequest)
+		return
+	}
+	h, payload, jwk, err := parseJWS(&req)
+	if err != nil {
+		ca.problem(w, "malformed", err.Error(), http.StatusBadRequest)
+		return
+	}
+	if r.URL.Path == "/new-account" {
+		ca.newAccount(w, jwk, payload)
+		return
+	}
+	account := -1
+	if strings.HasPrefix(h.KID, ca.URL+"/account/") {
+		account, _ = strconv.Atoi(strings.TrimPrefix(h.KID, ca.URL+"/account/"))
+	}
+	if account < 0 || account >= len(ca.accounts) || ca.accounts[account] == nil || verifyJWS(&req, ca.accounts[account]) != nil {
+		ca.problem(w, "unauthorized", "bad signature for "+h.KID, http.StatusForbidden)
+		return
+	}
+	parts := strings.Split(strings.TrimPrefix(r.URL.Path, "/"), "/")
+	switch parts[0] {
+	case "account":
+		w.Write(acmetest.Account(ca.URL, "valid"))
+	case "key-change":
+		ca.keyChange(w, account, payload)
+	case "new-order":
+		ca.newOrder(w, payload)
+	case "order", "finalize", "cert":
+		i, err := strconv.Atoi(parts[len(parts)-1])
+		if err != nil || i >= len(ca.orders) {
+			ca.problem(w, "malformed", "no order "+r.URL.Path, http.StatusNotFound)
+			return
+		}
+		switch parts[0] {
+		case "order":
+			ca.writeOrder(w, i, http.StatusOK)
+		case "finalize":
+			ca.finalize(w, i, payload)
+		case "cert":
+			w.Header().Set("Content-Type", "application/pem-certificate-chain")
+			w.Write(ca.orders[i].chain)
+		}
+	case "authz":
+		w.Write(acmetest.Authorization(ca.URL, parts[1], "valid"))
+	default:
+		ca.problem(w, "malformed", "no "+r.URL.Path, http.StatusNotFound)
+	}
+}
+
+// newAccount answers a new-account request signed by jwk, finding the
+// account of an existing key.
+func (ca *testCA) newAccount(w http.ResponseWriter, jwk *rsa.PublicKey, payload []byte) {
+	var req struct {
+		OnlyReturnExisting bool `json:"onlyReturnExisting"`
+	}
+	json.Unmarshal(payload, &req)
+	status := http.StatusOK
+	i := ca.lookup(jwk)
+	if i < 0 {
+		if req.OnlyReturnExisting {
+			ca.problem(w, "accountDoesNotExist", "no account for key", http.StatusBadRequest)
+			return
+		}
+		ca.accounts = append(ca.accounts, jwk)
+		i = len(ca.accounts) - 1
+		status = http.StatusCreated
+	}
+	w.Header().Set("Location", ca.accountURL(i))
+	w.WriteHeader(status)
+	w.Write(acmetest.Account(ca.URL, "valid"))
+}
+
+// keyChange replaces the key of the account with the one of the inner JWS
+// of payload.
+func (ca *testCA) keyChange(w http.ResponseWriter, account int, payload []byte) {
+	var inner jws
+	if err := json.Unmarshal(payload, &inner); err != nil {
+		ca.problem(w, "malformed", err.Error(), http.StatusBadRequest)
+		return
+	}
+	_, _, jwk, err := parseJWS(&inner)
+	if err != nil || jwk == nil {
+		ca.problem(w, "malformed", "inner JWS has no key", http.StatusBadRequest)
+		return
+	}
+	if ca.lookup(jwk) >= 0 {
+		ca.problem(w, "conflict", "key in use", http.StatusConflict)
+		return
+	}
+	if ca.keyChangeFault != "rejected" {
+		ca.accounts[account] = jwk
+	}
+	if ca.keyChangeFault != "" {
+		ca.problem(w, "malformed", "key change "+ca.keyChangeFault, http.StatusBadRequest)
+		return
+	}
+	w.Write(acmetest.Account(ca.URL, "valid"))
+}
+
+// newOrder creates a ready order for the identifiers of payload.
+func (ca *testCA) newOrder(w http.ResponseWriter, payload []byte) {
+	var req struct {
+		Identifiers []struct{ Value string }
+	}
+	if err := json.Unmarshal(payload, &req); err != nil {
+		ca.problem(w, "malformed", err.Error(), http.StatusBadRequest)
+		return
+	}
+	o := &testOrder{status: "ready"}
+	for _, id := range req.Identifiers {
+		o.domains = append(o.domains, id.Value)
+	}
+	ca.orders = append(ca.orders, o)
+	ca.writeOrder(w, len(ca.orders)-1, http.StatusCreated)
+}
+
+// finalize issues the certificate of order i for the CSR of payload.
+func (ca *testCA) finalize(w http.ResponseWriter, i int, payload []byte) {
+	var req struct{ CSR string }
+	json.Unmarshal(payload, &req)
+	der, err := base64.RawURLEncoding.DecodeString(req.CSR)
+	if err != nil {
+		ca.problem(w, "badCSR", err.Error(), http.StatusBadRequest)
+		return
+	}
+	csr, err := x509.ParseCertificateRequest(der)
+	if err != nil {
+		ca.problem(w, "badCSR", err.Error(), http.StatusBadRequest)
+		return
+	}
+	now := time.Now()
+	tmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(now.UnixNano()),
+		Subject:      pkix.Name{CommonName: csr.Subject.CommonName},
+		DNSNames:     append([]string{csr.Subject.CommonName}, csr.DNSNames...),
+		NotBefore:    now.Add(-time.Hour),
+		NotAfter:     now.Add(90 * 24 * time.Hour),
+	}
+	leaf, err := x509.CreateCertificate(rand.Reader, tmpl, ca.cert, csr.PublicKey, ca.key)
+	if err != nil {
+		ca.problem(w, "serverInternal", err.Error(), http.StatusInternalServerError)
+		return
+	}
+	o := ca.orders[i]
+	o.chain = append(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: leaf}),
+		pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: ca.cert.Raw})...)
+	o.status = "valid"
+	ca.writeOrder(w, i, http.StatusOK)
+}
+
+// writeOrder answers with order i. The caller holds mu.
+func (ca *testCA) writeOrder(w http.ResponseWriter, i int, status int) {
+	o := ca.orders[i]
+	ids := make([]map[string]string, len(o.domains))
+	authzs := make([]string, len(o.domains))
+	for j, d := range o.domains {
+		ids[j] = map[string]string{"type": "dns", "value": d}
+		authzs[j] = ca.URL + "/authz/" + d
+	}
+	body := map[string]interface{}{
+		"status":         o.status,
+		"expires":        time.Now().Add(24 * time.Hour).Format(time.RFC3339),
+		"identifiers":    ids,
+		"authorizations": authzs,
+		"finalize":       fmt.Sprintf("%s/finalize/%d", ca.URL, i),
+	}
+	if o.status == "valid" {
+		body["certificate"] = fmt.Sprintf("%s/cert/%d", ca.URL, i)
+	}
+	b, _ := json.Marshal(body)
+	w.Header().Set("Location", fmt.Sprintf("%s/order/%d", ca.URL, i))
+	w.WriteHeader(status)
+	w.Write(b)
+}
+
+// problem answers with an ACME problem document.
+func (ca *testCA) problem(w http.ResponseWriter, typ, detail string, status int) {
+	w.Header().Set("Content-Type", "application/problem+json")
+	w.WriteHeader(status)
+	w.Write(acmetest.Problem(typ, detail, status))
+}
+
+// parseJWS decodes the protected header and payload of req, and the key
+// of its header if it carries one.
+func parseJWS(req *jws) (*jwsHeader, []byte, *rsa.PublicKey, error) {
+	b, err := base64.RawURLEncoding.DecodeString(req.Protected)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	h := &jwsHeader{}
+	if err := json.Unmarshal(b, h); err != nil {
+		return nil, nil, nil, err
+	}
+	payload, err := base64.RawURLEncoding.DecodeString(req.Payload)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	if h.JWK == nil {
+		return h, payload, nil, nil
+	}
+	var jwk struct{ N, E string }
+	if err := json.Unmarshal(h.JWK, &jwk); err != nil {
+		return nil, nil, nil, err
+	}
+	n, err := base64.RawURLEncoding.DecodeString(jwk.N)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	e, err := base64.RawURLEncoding.DecodeString(jwk.E)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	k := &rsa.PublicKey{N: new(big.Int).SetBytes(n), E: int(new(big.Int).SetBytes(e).Int64())}
+	if err := verifyJWS(req, k); err != nil {
+		return nil, nil, nil, err
+	}
+	return h, payload, k, nil
+}
+
+// verifyJWS checks the RS256 signature of req.
+func verifyJWS(req *jws, k *rsa.PublicKey) error {
+	sig, err := base64.RawURLEncoding.DecodeString(req.Signature)
+	if err != nil {
+		return err
+	}
+	sum := sha256.Sum256([]byte(req.Protected + "." + req.Payload))
+	return rsa.VerifyPKCS1v15(k, crypto.SHA256, sum[:], sig)
+}
+
+// loadLeaf loads the certificate name from dir, failing the test unless it
+// matches its key.
+func loadLeaf(t *testing.T, dir, name string) *x509.Certificate {
+	t.Helper()
+	cert, err := LoadCertificate(dir, name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return cert.Leaf
+}
@@ -0,0 +1,130 @@
+package acme
+
+import (
+	"context"
+	"strings"
+)
+
+// DefaultCAAIdentity is the issuer domain name of Let's Encrypt in CAA
+// records.
+const DefaultCAAIdentity = "letsencrypt.org"
+
+// WithCAAIdentity sets the issuer domain name CheckCAA looks for, for CAs
+// other than Let's Encrypt.
+func WithCAAIdentity(identity string) Option {
+	return func(c *Client) {
+		c.caaIdentity = identity
+	}
+}
+
+// CAA is a CAA record.
+type CAA struct {
+	Flags int
+	Tag   string
+	Value string
+}
+
+// parseCAA parses the presentation format of a CAA record, e.g.
+// `0 issue "letsencrypt.org"`.
+func parseCAA(s string) (CAA, bool) {
+	f := strings.SplitN(strings.TrimSpace(s), " ", 3)
+	if len(f) != 3 {
+		return CAA{}, false
+	}
+	flags := 0
+	for _, r := range f[0] {
+		if r < '0' || r > '9' {
+			return CAA{}, false
+		}
+		flags = flags*10 + int(r-'0')
+	}
+	return CAA{Flags: flags, Tag: strings.ToLower(f[1]), Value: strings.Trim(f[2], `"`)}, true
+}
+
+// LookupCAA returns the relevant CAA records of domain as seen by public
+// resolvers: those of the closest of domain and its parents that has any
+// (RFC 8659, 3).
+func LookupCAA(ctx context.Context, domain string) ([]CAA, error) {
+	name := strings.TrimPrefix(strings.TrimSuffix(domain, "."), "*.")
+	for name != "" {
+		b, err := dnsQuery(ctx, typeCAA, name)
+		if err != nil {
+			return nil, err
+		}
+		values, err := parseRecords(b)
+		if err != nil {
+			return nil, err
+		}
+		var records []CAA
+		for _, v := range values {
+			if r, ok := parseCAA(v); ok {
+				records = append(records, r)
+			}
+		}
+		if len(records) > 0 {
+			return records, nil
+		}
+		i := strings.IndexByte(name, '.')
+		if i < 0 {
+			break
+		}
+		name = name[i+1:]
+	}
+	return nil, nil
+}
+
+// caaAllows reports whether the CAA records permit identity to issue for
+// domain. Wildcard names use the issuewild records if there are any.
+func caaAllows(records []CAA, domain, identity string) bool {
+	tag := "issue"
+	if strings.HasPrefix(domain, "*.") {
+		for _, r := range records {
+			if r.Tag == "issuewild" {
+				tag = "issuewild"
+				break
+			}
+		}
+	}
+	found := false
+	for _, r := range records {
+		if r.Tag != tag {
+			continue
+		}
+		found = true
+		// The issuer domain name may be followed by parameters.
+		v := strings.TrimSpace(strings.SplitN(r.Value, ";", 2)[0])
+		if strings.EqualFold(v, identity) {
+			return true
+		}
+	}
+	return !found
+}
+
+// CheckCAA returns an error if the CAA records of domain do not allow the
+// CA to issue for it.
+func (c *Client) CheckCAA(ctx context.Context, domain string) error {
+	records, err := LookupCAA(ctx, domain)
+	if err != nil {
+		return err
+	}
+	identity := c.caaIdentity
+	if identity == "" {
+		identity = DefaultCAAIdentity
+	}
+	if !caaAllows(records, domain, identity) {
+		return &CAAError{Domain: domain, Identity: identity, Records: records}
+	}
+	return nil
+}
+
+// CAAError is returned by CheckCAA when the CAA records of a domain forbid
+// issuance.
+type CAAError struct {
+	Domain   string
+	Identity string
+	Records  []CAA
+}
+
+func (e *CAAError) Error() string {
+	return "CAA records of " + e.Domain + " do not allow " + e.Identity + " to issue"
+}
@@ -0,0 +1,71 @@
+package acme
+
+import (
+	"context"
+	"fmt"
+	"sort"
+)
+
+// WithStagingCanary authorizes certificates whose parameters changed since
+// their last issuance against staging first, a client created with
+// WithDirectoryURL(StagingURL), and only orders from the CA once that
+// succeeded. A broken configuration then fails against staging instead of
+// using up production rate limits. A parameter change means new or
+// removed domain names or a different challenge type.
+//
+// The staging client answers its challenges through the HTTPHandler and
+// GetCertificate of the client it is given to, and uses its HTTPSolver and
+// DNSProvider unless it has its own, so it must not be used for other
+// issuances at the same time.
+func WithStagingCanary(staging *Client) Option {
+	return func(c *Client) {
+		c.canary = staging
+	}
+}
+
+// shareSolvers makes the canary c solve challenges the way the client
+// using it does.
+func (c *Client) shareSolvers(from *Client) {
+	c.tokens = from.tokens
+	c.alpn = from.alpn
+	if c.httpSolver == nil {
+		c.httpSolver = from.httpSolver
+	}
+	if c.dnsProvider == nil {
+		c.dnsProvider = from.dnsProvider
+	}
+}
+
+// changed reports whether the certificate would be issued with parameters
+// that were not used for the current certificate.
+func changed(dir string, cfg *RenewalConfig) bool {
+	chain, err := loadChain(dir, cfg.Name)
+	if err != nil {
+		return true
+	}
+	if cfg.IssuedChtype != "" && cfg.IssuedChtype != cfg.Chtype {
+		return true
+	}
+	added, removed := diffNames(certNames(chain[0]), sortedNames(cfg.Domains))
+	return len(added) > 0 || len(removed) > 0
+}
+
+// sortedNames returns a sorted copy of domains.
+func sortedNames(domains []string) []string {
+	d := append([]string(nil), domains...)
+	sort.Strings(d)
+	return d
+}
+
+// runCanary authorizes the certificate against the staging client if it is
+// configured and the parameters changed.
+func (c *Client) runCanary(ctx context.Context, dir string, cfg *RenewalConfig) error {
+	if c.canary == nil || !changed(dir, cfg) {
+		return nil
+	}
+	c.log.Infof("%s changed, authorizing against staging first", cfg.Name)
+	if _, err := c.canary.authorizeOrder(ctx, dir, cfg); err != nil {
+		return fmt.Errorf("staging canary: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,128 @@
+package acme
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+// cdnTimeout bounds the HTTP request DetectCDN sends, and cdnCacheTTL how
+// long selectChallenge keeps its result for a domain name.
+const (
+	cdnTimeout  = 5 * time.Second
+	cdnCacheTTL = time.Hour
+)
+
+// cdnSignature identifies a CDN by the CNAME targets it hands out and the
+// headers it adds.
+type cdnSignature struct {
+	name     string
+	suffixes []string
+	headers  []string
+	server   string
+}
+
+var cdnSignatures = []cdnSignature{
+	{
+		name:     "Cloudflare",
+		suffixes: []string{".cdn.cloudflare.net."},
+		headers:  []string{"Cf-Ray"},
+		server:   "cloudflare",
+	},
+	{
+		name:     "Akamai",
+		suffixes: []string{".akamaiedge.net.", ".edgekey.net.", ".edgesuite.net.", ".akamai.net."},
+		headers:  []string{"X-Akamai-Transformed"},
+		server:   "akamaighost",
+	},
+	{
+		name:     "Fastly",
+		suffixes: []string{".fastly.net.", ".fastlylb.net."},
+		headers:  []string{"X-Fastly-Request-Id"},
+	},
+	{
+		name:     "CloudFront",
+		suffixes: []string{".cloudfront.net."},
+		headers:  []string{"X-Amz-Cf-Id"},
+		server:   "cloudfront",
+	},
+}
+
+// DetectCDN returns the name of the CDN or proxy in front of domain, or an
+// empty string if none is recognized. It looks at the CNAME target of the
+// domain and at the headers of its HTTP response. Name servers are not
+// considered, as a zone hosted by a CDN's DNS need not be proxied by it.
+func DetectCDN(ctx context.Context, domain string) string {
+	if cname, err := net.DefaultResolver.LookupCNAME(ctx, domain); err == nil {
+		cname = strings.ToLower(cname)
+		for _, s := range cdnSignatures {
+			for _, suffix := range s.suffixes {
+				if strings.HasSuffix(cname, suffix) {
+					return s.name
+				}
+			}
+		}
+	}
+	ctx, cancel := context.WithTimeout(ctx, cdnTimeout)
+	defer cancel()
+	req, err := http.NewRequest("HEAD", "http://"+domain+"/", nil)
+	if err != nil {
+		return ""
+	}
+	resp, err := http.DefaultClient.Do(req.WithContext(ctx))
+	if err != nil {
+		return ""
+	}
+	resp.Body.Close()
+	server := strings.ToLower(resp.Header.Get("Server"))
+	for _, s := range cdnSignatures {
+		if s.server != "" && strings.Contains(server, s.server) {
+			return s.name
+		}
+		for _, h := range s.headers {
+			if resp.Header.Get(h) != "" {
+				return s.name
+			}
+		}
+	}
+	return ""
+}
+
+// cdnCache keeps the results of DetectCDN by domain name.
+type cdnCache struct {
+	mu sync.Mutex
+	m  map[string]cdnResult
+}
+
+// cdnResult is a cached result of DetectCDN.
+type cdnResult struct {
+	cdn string
+	at  time.Time
+}
+
+// detectCDN returns DetectCDN for domain, cached for cdnCacheTTL so an
+// order for many names behind the same setup does not probe each one on
+// every renewal attempt.
+func (c *Client) detectCDN(ctx context.Context, domain string) string {
+	now := c.clock.Now()
+	c.cdns.mu.Lock()
+	r, ok := c.cdns.m[domain]
+	c.cdns.mu.Unlock()
+	if ok && now.Sub(r.at) < cdnCacheTTL {
+		return r.cdn
+	}
+	cdn := DetectCDN(ctx, domain)
+	if ctx.Err() != nil {
+		return cdn
+	}
+	c.cdns.mu.Lock()
+	defer c.cdns.mu.Unlock()
+	if c.cdns.m == nil {
+		c.cdns.m = make(map[string]cdnResult)
+	}
+	c.cdns.m[domain] = cdnResult{cdn, now}
+	return cdn
+}
@@ -1,45 +1,118 @@
 package acme
 
-
 import (
+	"bytes"
 	"context"
-	"crypto/rand"
-	"crypto/rsa"
+	"crypto"
 	"crypto/x509"
 	"crypto/x509/pkix"
+	"encoding/asn1"
 	"encoding/pem"
 	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
 	"os"
-	"time"
 	"path"
+	"strings"
+
+	"golang.org/x/crypto/acme"
 )
 
 const certType = "CERTIFICATE"
 
-var ErrNoDomains = errors.New("no domain names provided")
+// pendingKeySuffix is the suffix of a key generated for an order, which
+// replaces <name>.key once the certificate for it is written.
+const pendingKeySuffix = ".key.pending"
+
+// clientAuthExt requests the serverAuth and clientAuth extended key usages.
+var clientAuthExt = pkix.Extension{
+	Id: asn1.ObjectIdentifier{2, 5, 29, 37},
+	Value: mustMarshal([]asn1.ObjectIdentifier{
+		{1, 3, 6, 1, 5, 5, 7, 3, 1},
+		{1, 3, 6, 1, 5, 5, 7, 3, 2},
+	}),
+}
+
+// WithClientAuth requests certificates usable for TLS client authentication
+// as well as server authentication. Public CAs such as Let's Encrypt ignore
+// the request; it is meant for private ACME CAs issuing client certificates.
+func WithClientAuth() Option {
+	return func(c *Client) {
+		c.clientAuth = true
+	}
+}
+
+// mustMarshal DER encodes a value known to be valid.
+func mustMarshal(v interface{}) []byte {
+	b, err := asn1.Marshal(v)
+	if err != nil {
+		panic(err)
+	}
+	return b
+}
+
+var (
+	ErrNoDomains     = errors.New("no domain names provided")
+	ErrNoCertificate = errors.New("no certificate found")
+	ErrKeyMismatch   = errors.New("certificate was not issued for its key")
+)
 
-// createCSR creates a certificate signing requests for the provided domains.
-func createCSR(k *rsa.PrivateKey, domains ...string) ([]byte, error) {
+// createCSR creates a certificate signing requests for the provided domains
+// with the provided extra extensions.
+func createCSR(random io.Reader, k crypto.Signer, exts []pkix.Extension, domains ...string) ([]byte, error) {
 	if len(domains) == 0 {
 		return nil, ErrNoDomains
 	}
 	return x509.CreateCertificateRequest(
-		rand.Reader,
+		random,
 		&x509.CertificateRequest{
-			Subject:  pkix.Name{CommonName: domains[0]},
-			DNSNames: domains[1:],
+			Subject:         pkix.Name{CommonName: domains[0]},
+			DNSNames:        domains[1:],
+			ExtraExtensions: exts,
 		},
 		k,
 	)
 }
 
-// createCert obtains a certificate for the provided CSR.
-func (c *Client) createCert(ctx context.Context, csr []byte, name, dir string ) error {
-	ders, _, err := c.client.CreateCert(ctx, csr, 90*24*time.Hour, true)
+// createCert finalizes the ready order with the provided CSR and writes the
+// certificate.
+func (c *Client) createCert(ctx context.Context, o *acme.Order, csr []byte, dir string, cfg *RenewalConfig) error {
+	ders, _, err := c.ca().CreateOrderCert(ctx, o.FinalizeURL, csr, true)
 	if err != nil {
-		return err
+		return c.issueError(cfg, err)
+	}
+	return c.writeCert(ctx, ders, dir, cfg)
+}
+
+// writeCert writes the issued certificate chain ders, replacing the previous
+// certificate.
+func (c *Client) writeCert(ctx context.Context, ders [][]byte, dir string, cfg *RenewalConfig) error {
+	name := cfg.Name
+	prev, _ := loadChain(dir, name)
+	if stored, err := LoadRenewalConfig(dir, name); err == nil && stored.Revoked {
+		// The key of a revoked certificate may have been replaced.
+		prev = nil
+	}
+	if len(ders) > 0 {
+		if err := checkIssued(cfg, prev, ders[0]); err != nil {
+			return err
+		}
 	}
-	w, err := os.Create(path.Join(dir, name + ".crt") )
+	// A Must-Staple certificate only replaces the previous one together
+	// with its staple.
+	var staple []byte
+	if cfg.MustStaple {
+		var err error
+		if staple, err = c.newStaple(ctx, ders); err != nil {
+			return fmt.Errorf("%s: no OCSP staple for the new certificate, keeping the previous one: %w", name, err)
+		}
+		if err := ioutil.WriteFile(path.Join(dir, name+".ocsp.tmp"), staple, 0644); err != nil {
+			return err
+		}
+	}
+	p := path.Join(dir, name+".crt")
+	w, err := os.Create(p + ".tmp")
 	if err != nil {
 		return err
 	}
@@ -53,5 +126,152 @@ func (c *Client) createCert(ctx context.Context, csr []byte, name, dir string )
 			return err
 		}
 	}
+	if err := w.Close(); err != nil {
+		return err
+	}
+	// The key is installed before the certificate, with two renames that
+	// are not atomic together: a reader between them, or a crash, sees the
+	// new key with the previous certificate. Only the live/<name> link of
+	// WithLiveLinks switches the pair at once.
+	if err := installPendingKey(dir, name, ders); err != nil {
+		return err
+	}
+	if err := os.Rename(p+".tmp", p); err != nil {
+		return err
+	}
+	if staple != nil {
+		if err := os.Rename(path.Join(dir, name+".ocsp.tmp"), path.Join(dir, name+".ocsp")); err != nil {
+			return err
+		}
+	}
+	c.compare(prev, ders, cfg)
+	if err := c.archive(dir, cfg, ders); err != nil {
+		return err
+	}
+	if len(ders) > 0 {
+		if err := c.export(dir, cfg, ders[0]); err != nil {
+			return err
+		}
+	}
 	return nil
 }
+
+// installPendingKey moves the key generated for the order to <name>.key if
+// the certificate ders was issued for it. A pending key left by an earlier
+// failed attempt is ignored if the certificate was issued for <name>.key
+// instead, e.g. with ReuseKey. A certificate for neither key is rejected,
+// as another issuance has replaced the pending key since the order.
+func installPendingKey(dir, name string, ders [][]byte) error {
+	if len(ders) == 0 {
+		return nil
+	}
+	leaf, err := x509.ParseCertificate(ders[0])
+	if err != nil {
+		return err
+	}
+	k, err := loadCertKey(dir, name+pendingKeySuffix)
+	switch {
+	case err == nil && keyMatches(k, leaf):
+		return os.Rename(path.Join(dir, name+pendingKeySuffix), path.Join(dir, name+".key"))
+	case err != nil && !os.IsNotExist(err):
+		return err
+	}
+	if k, err := loadCertKey(dir, name+".key"); err == nil && keyMatches(k, leaf) {
+		return nil
+	}
+	return fmt.Errorf("%w: %s", ErrKeyMismatch, name)
+}
+
+// keyMatches reports whether the certificate was issued for the key.
+func keyMatches(k crypto.Signer, cert *x509.Certificate) bool {
+	spki, err := x509.MarshalPKIXPublicKey(k.Public())
+	return err == nil && bytes.Equal(spki, cert.RawSubjectPublicKeyInfo)
+}
+
+// stapleAttempts is how often the staple of a new certificate is fetched
+// before giving up, as OCSP responders may take a few seconds to learn of
+// it.
+const stapleAttempts = 5
+
+// newStaple fetches the OCSP response for the issued chain ders.
+func (c *Client) newStaple(ctx context.Context, ders [][]byte) ([]byte, error) {
+	chain := make([]*x509.Certificate, len(ders))
+	for i, der := range ders {
+		cert, err := x509.ParseCertificate(der)
+		if err != nil {
+			return nil, err
+		}
+		chain[i] = cert
+	}
+	for i := 1; ; i++ {
+		b, _, err := c.fetchStaple(ctx, chain)
+		if err == nil || i == stapleAttempts || errors.Is(err, ErrNoIssuer) || errors.Is(err, ErrNoOCSPServer) {
+			return b, err
+		}
+		if err := c.wait(ctx); err != nil {
+			return nil, err
+		}
+	}
+}
+
+// compare logs and emits the differences between the previous certificate
+// and the one just issued, so unexpected changes such as a chain swap are
+// noticed.
+func (c *Client) compare(prev []*x509.Certificate, ders [][]byte, cfg *RenewalConfig) {
+	if prev == nil {
+		return
+	}
+	next := make([]*x509.Certificate, 0, len(ders))
+	for _, b := range ders {
+		cert, err := x509.ParseCertificate(b)
+		if err != nil {
+			c.log.Warnf("%s: unable to parse issued certificate: %s", cfg.Name, err)
+			return
+		}
+		next = append(next, cert)
+	}
+	changes := DiffChains(prev, next)
+	if len(changes) == 0 {
+		return
+	}
+	c.log.Warnf("%s: certificate changed: %s", cfg.Name, strings.Join(changes, "; "))
+	c.emitEvent(Event{
+		Type:    EventCertificateChanged,
+		Name:    cfg.Name,
+		Domains: cfg.Domains,
+		Changes: changes,
+	})
+}
+
+// parseChain decodes the PEM encoded certificates in b.
+func parseChain(b []byte) ([]*x509.Certificate, error) {
+	var certs []*x509.Certificate
+	for {
+		var block *pem.Block
+		block, b = pem.Decode(b)
+		if block == nil {
+			break
+		}
+		if block.Type != certType {
+			continue
+		}
+		cert, err := x509.ParseCertificate(block.Bytes)
+		if err != nil {
+			return nil, err
+		}
+		certs = append(certs, cert)
+	}
+	if len(certs) == 0 {
+		return nil, ErrNoCertificate
+	}
+	return certs, nil
+}
+
+// loadChain loads the certificate chain written by createCert.
+func loadChain(dir, name string) ([]*x509.Certificate, error) {
+	b, err := ioutil.ReadFile(path.Join(dir, name+".crt"))
+	if err != nil {
+		return nil, err
+	}
+	return parseChain(b)
+}
@@ -0,0 +1,61 @@
+package acme
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path"
+	"testing"
+	"time"
+
+	"github.com/fireflyst/letsencrypt/acme/acmetest"
+)
+
+func TestInstallPendingKey(t *testing.T) {
+	chain, err := acmetest.NewChain(time.Hour, "a.example")
+	if err != nil {
+		t.Fatal(err)
+	}
+	other, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ders := [][]byte{chain.Leaf.Raw}
+	tests := []struct {
+		name    string
+		key     []byte
+		pending []byte
+		err     error
+		want    []byte
+	}{
+		{"pending key", acmetest.KeyPEM(other), chain.KeyPEM(), nil, chain.KeyPEM()},
+		{"reused key", chain.KeyPEM(), acmetest.KeyPEM(other), nil, chain.KeyPEM()},
+		{"first key", nil, chain.KeyPEM(), nil, chain.KeyPEM()},
+		{"replaced pending key", acmetest.KeyPEM(other), acmetest.KeyPEM(other), ErrKeyMismatch, acmetest.KeyPEM(other)},
+		{"no key", nil, nil, ErrKeyMismatch, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			for f, b := range map[string][]byte{"a.key": tt.key, "a" + pendingKeySuffix: tt.pending} {
+				if b != nil {
+					if err := ioutil.WriteFile(path.Join(dir, f), b, 0600); err != nil {
+						t.Fatal(err)
+					}
+				}
+			}
+			if err := installPendingKey(dir, "a", ders); !errors.Is(err, tt.err) {
+				t.Fatalf("installPendingKey = %v, want %v", err, tt.err)
+			}
+			b, err := ioutil.ReadFile(path.Join(dir, "a.key"))
+			if err != nil && !os.IsNotExist(err) {
+				t.Fatal(err)
+			}
+			if string(b) != string(tt.want) {
+				t.Errorf("a.key holds the wrong key")
+			}
+		})
+	}
+}
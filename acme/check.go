@@ -0,0 +1,132 @@
+package acme
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"os"
+	"strings"
+)
+
+// CheckResult is the outcome of a single check run by Check. Name is the
+// certificate the check is about, or empty for checks of the client.
+type CheckResult struct {
+	Name  string
+	Check string
+	Err   error
+}
+
+// CheckOptions selects the checks run by Check in addition to the syntax of
+// the stored files.
+type CheckOptions struct {
+	// Ports checks that port 80 can be bound for certificates using the
+	// http challenge. Leave it off when HTTPHandler already serves it.
+	Ports bool
+	// CAA checks that the CAA records of every domain name allow the CA to
+	// issue.
+	CAA bool
+}
+
+// Check verifies without issuing that the certificates in dir can be
+// renewed: that dir is writable unless the client is read-only, the account
+// is usable, the renewal files parse and name supported challenge and key
+// types and valid domain names, and, depending on opts, that port 80 is
+// free and CAA allows issuance. Only failed checks are returned.
+func (c *Client) Check(ctx context.Context, dir string, opts CheckOptions) []CheckResult {
+	var results []CheckResult
+	fail := func(name, check string, err error) {
+		results = append(results, CheckResult{Name: name, Check: check, Err: err})
+	}
+	if !c.readOnly {
+		if err := checkWritable(dir); err != nil {
+			fail("", "storage", err)
+		}
+	}
+	if c.ca().Key == nil {
+		fail("", "account", ErrNoAccountKey)
+	}
+	names, err := Certificates(dir)
+	if err != nil {
+		fail("", "storage", err)
+	}
+	needsHTTP := false
+	caa := make(map[string]error)
+	for _, name := range names {
+		cfg, err := LoadRenewalConfig(dir, name)
+		if err == nil {
+			cfg, err = inheritDefaults(dir, cfg)
+		}
+		if err != nil {
+			fail(name, "config", err)
+			continue
+		}
+		switch cfg.Chtype {
+		case ChallengeHTTP, ChallengeAuto:
+			needsHTTP = true
+		case ChallengeDNS, ChallengeDNSAccount, ChallengeTLSALPN:
+		default:
+			fail(name, "config", fmt.Errorf("%w %q", ErrUnsupportedChtype, cfg.Chtype))
+		}
+		if err := checkKeyType(cfg.KeyType); err != nil {
+			fail(name, "config", err)
+		}
+		if len(cfg.Domains) == 0 {
+			fail(name, "config", ErrNoDomains)
+		}
+		for _, d := range cfg.Domains {
+			if _, err := NormalizeDomain(d); err != nil {
+				fail(name, "config", err)
+				continue
+			}
+			if !opts.CAA {
+				continue
+			}
+			if _, ok := caa[d]; !ok {
+				caa[d] = c.CheckCAA(ctx, d)
+			}
+			if caa[d] != nil {
+				fail(name, "caa", caa[d])
+			}
+		}
+	}
+	if opts.Ports && needsHTTP {
+		l, err := net.Listen("tcp", ":80")
+		if err != nil {
+			fail("", "port", err)
+		} else {
+			l.Close()
+		}
+	}
+	return results
+}
+
+// checkWritable verifies that files can be created in dir.
+func checkWritable(dir string) error {
+	f, err := ioutil.TempFile(dir, ".check")
+	if err != nil {
+		return err
+	}
+	f.Close()
+	return os.Remove(f.Name())
+}
+
+// checkDomain verifies the syntax of a domain name, allowing a leading
+// wildcard label.
+func checkDomain(d string) error {
+	name := strings.TrimPrefix(d, "*.")
+	if name == "" || len(name) > 253 || net.ParseIP(name) != nil {
+		return fmt.Errorf("invalid domain name %q", d)
+	}
+	for _, label := range strings.Split(name, ".") {
+		if label == "" || len(label) > 63 || label[0] == '-' || label[len(label)-1] == '-' {
+			return fmt.Errorf("invalid domain name %q", d)
+		}
+		for _, r := range label {
+			if !(r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9' || r == '-') {
+				return fmt.Errorf("invalid domain name %q", d)
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,229 @@
+package acme
+
+import (
+	"context"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"golang.org/x/crypto/acme"
+)
+
+// checkpointVersion is the current version of the checkpoint format.
+const checkpointVersion = 1
+
+var ErrInvalidCheckpoint = errors.New("invalid checkpoint")
+
+// Checkpoint is an opaque token from which an issuance interrupted by its
+// time budget can be resumed. It holds no secrets.
+type Checkpoint string
+
+// checkpoint is the content of a Checkpoint.
+type checkpoint struct {
+	Version  int       `json:"version"`
+	Dir      string    `json:"dir"`
+	Name     string    `json:"name"`
+	Chtype   string    `json:"chtype"`
+	Domains  []string  `json:"domains"`
+	OrderURL string    `json:"orderURL"`
+	Expires  time.Time `json:"expires"`
+}
+
+// encode returns the token of the checkpoint.
+func (cp *checkpoint) encode() (Checkpoint, error) {
+	cp.Version = checkpointVersion
+	b, err := json.Marshal(cp)
+	if err != nil {
+		return "", err
+	}
+	return Checkpoint(base64.RawURLEncoding.EncodeToString(b)), nil
+}
+
+// parse decodes the token.
+func (t Checkpoint) parse() (*checkpoint, error) {
+	b, err := base64.RawURLEncoding.DecodeString(string(t))
+	if err != nil {
+		return nil, fmt.Errorf("%w: %s", ErrInvalidCheckpoint, err)
+	}
+	cp := &checkpoint{}
+	if err := json.Unmarshal(b, cp); err != nil {
+		return nil, fmt.Errorf("%w: %s", ErrInvalidCheckpoint, err)
+	}
+	if cp.Version != checkpointVersion {
+		return nil, fmt.Errorf("%w: version %d is not supported", ErrInvalidCheckpoint, cp.Version)
+	}
+	if cp.Name == "" || cp.OrderURL == "" {
+		return nil, ErrInvalidCheckpoint
+	}
+	return cp, nil
+}
+
+// CreateWithin works like Create but spends at most budget on the
+// issuance, for cron jobs and serverless functions with a time limit. If
+// the budget runs out after the order was created, CreateWithin returns a
+// checkpoint and a nil error; pass it to Resume, e.g. in the next
+// invocation, to carry on where the issuance stopped. The checkpoint is
+// empty once the certificate is written. Certificates with DualKey set are
+// not supported.
+func (c *Client) CreateWithin(ctx context.Context, budget time.Duration, dir, name, chtype string, domains ...string) (Checkpoint, error) {
+	if err := c.writable(); err != nil {
+		return "", err
+	}
+	cfg, err := inheritDefaults(dir, c.newConfig(name, chtype, domains))
+	if err != nil {
+		return "", err
+	}
+	if err := cfg.normalize(); err != nil {
+		return "", err
+	}
+	if cfg.DualKey {
+		return "", fmt.Errorf("%s: dual key certificates cannot be issued with a checkpoint", name)
+	}
+	ctx, op := c.operation(ctx)
+	bctx, cancel := context.WithTimeout(ctx, budget)
+	defer cancel()
+	release, err := c.acquire(bctx)
+	if err != nil {
+		return "", op.wrap(err)
+	}
+	defer release()
+	o, err := c.newOrder(bctx, dir, cfg)
+	if err != nil {
+		return "", op.wrap(err)
+	}
+	cp := &checkpoint{
+		Dir:      dir,
+		Name:     cfg.Name,
+		Chtype:   cfg.Chtype,
+		Domains:  cfg.Domains,
+		OrderURL: o.URI,
+		Expires:  o.Expires,
+	}
+	return c.resume(ctx, bctx, cfg, cp)
+}
+
+// Resume continues the issuance of a checkpoint returned by CreateWithin or
+// an earlier Resume, spending at most budget on it. Like CreateWithin, it
+// returns a new checkpoint if the budget runs out again and an empty one
+// once the certificate is written.
+func (c *Client) Resume(ctx context.Context, budget time.Duration, t Checkpoint) (Checkpoint, error) {
+	if err := c.writable(); err != nil {
+		return "", err
+	}
+	cp, err := t.parse()
+	if err != nil {
+		return "", err
+	}
+	if !cp.Expires.IsZero() && c.clock.Now().After(cp.Expires) {
+		return "", fmt.Errorf("%w: %s", ErrOrderExpired, cp.Name)
+	}
+	cfg, err := inheritDefaults(cp.Dir, c.newConfig(cp.Name, cp.Chtype, cp.Domains))
+	if err != nil {
+		return "", err
+	}
+	if err := cfg.normalize(); err != nil {
+		return "", err
+	}
+	ctx, op := c.operation(ctx)
+	bctx, cancel := context.WithTimeout(ctx, budget)
+	defer cancel()
+	release, err := c.acquire(bctx)
+	if err != nil {
+		return "", op.wrap(err)
+	}
+	defer release()
+	return c.resume(ctx, bctx, cfg, cp)
+}
+
+// resume drives the order of the checkpoint as far as bctx allows and
+// returns the checkpoint again if bctx expired before ctx did.
+func (c *Client) resume(ctx, bctx context.Context, cfg *RenewalConfig, cp *checkpoint) (t Checkpoint, err error) {
+	_, op := c.operation(ctx)
+	unlease, err := c.lease(cp.Dir, cfg.Name)
+	if err != nil {
+		return "", op.wrap(err)
+	}
+	defer unlease()
+	start := c.clock.Now()
+	err = c.advance(bctx, cp.Dir, cfg, cp.OrderURL)
+	if err != nil && bctx.Err() == context.DeadlineExceeded && ctx.Err() == nil {
+		c.log.Infof("time budget of %s exhausted, checkpointing", cfg.Name)
+		return cp.encode()
+	}
+	if err == nil {
+		err = cfg.issued(cp.Dir, c.clock.Now())
+	}
+	c.record(cp.Dir, cfg, start, err)
+	return "", op.wrap(err)
+}
+
+// advance completes the order at orderURL from whatever state an earlier
+// call left it in and writes the certificate.
+func (c *Client) advance(ctx context.Context, dir string, cfg *RenewalConfig, orderURL string) error {
+	o, err := c.ca().GetOrder(ctx, orderURL)
+	if err != nil {
+		return c.issueError(cfg, err)
+	}
+	// The CA need not send a Location header when the order is fetched.
+	o.URI = orderURL
+	if err := c.checkOrder(o); err != nil {
+		return err
+	}
+	switch o.Status {
+	case acme.StatusPending:
+		if o, err = c.completeOrder(ctx, dir, cfg, o); err != nil {
+			return err
+		}
+	case acme.StatusReady:
+	case acme.StatusProcessing, acme.StatusValid:
+		// Finalized by an earlier call with the key written then.
+		return c.fetchCert(ctx, dir, cfg, o.URI)
+	default:
+		return c.issueError(cfg, &acme.OrderError{OrderURL: o.URI, Status: o.Status})
+	}
+	if o.Status == acme.StatusValid {
+		return c.fetchCert(ctx, dir, cfg, o.URI)
+	}
+	b, err := c.generateCSR(dir, cfg)
+	if err != nil {
+		return err
+	}
+	return c.createCert(ctx, o, b, dir, cfg)
+}
+
+// fetchCert waits for the finalized order at orderURL and writes its
+// certificate, which must be for the pending or live key in dir.
+func (c *Client) fetchCert(ctx context.Context, dir string, cfg *RenewalConfig, orderURL string) error {
+	o, err := c.ca().WaitOrder(ctx, orderURL)
+	if err != nil {
+		return c.issueError(cfg, err)
+	}
+	if err := c.validateURL("certificate url", o.CertURL); err != nil {
+		return err
+	}
+	ders, err := c.ca().FetchCert(ctx, o.CertURL, true)
+	if err != nil {
+		return c.issueError(cfg, err)
+	}
+	if len(ders) == 0 {
+		return ErrNoCertificate
+	}
+	leaf, err := x509.ParseCertificate(ders[0])
+	if err != nil {
+		return err
+	}
+	matches := false
+	for _, f := range []string{cfg.Name + pendingKeySuffix, cfg.Name + ".key"} {
+		if k, err := loadCertKey(dir, f); err == nil && keyMatches(k, leaf) {
+			matches = true
+			break
+		}
+	}
+	if !matches {
+		return fmt.Errorf("%s: key was replaced since the order was finalized", cfg.Name)
+	}
+	return c.writeCert(ctx, ders, dir, cfg)
+}
@@ -0,0 +1,67 @@
+package acme
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// laterClock is the system clock moved forward.
+type laterClock time.Duration
+
+func (l laterClock) Now() time.Time                       { return time.Now().Add(time.Duration(l)) }
+func (laterClock) After(d time.Duration) <-chan time.Time { return time.After(d) }
+
+func TestCreateWithinResume(t *testing.T) {
+	ca := newTestCA(t)
+	// The first finalization outlasts the budget, but the CA completes it.
+	var finalized int32
+	ca.before = func(path string) {
+		if strings.HasPrefix(path, "/finalize/") && atomic.AddInt32(&finalized, 1) == 1 {
+			time.Sleep(500 * time.Millisecond)
+		}
+	}
+	dir := t.TempDir()
+	c := ca.newClient(t, dir)
+	ctx := context.Background()
+	cp, err := c.CreateWithin(ctx, 200*time.Millisecond, dir, "a", ChallengeHTTP, "a.example")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cp == "" {
+		t.Fatal("CreateWithin returned no checkpoint")
+	}
+	if certExists(dir, "a") {
+		t.Fatal("certificate written before the checkpoint was resumed")
+	}
+	// Let the CA finish the interrupted finalization.
+	time.Sleep(500 * time.Millisecond)
+
+	expired, err := New(ctx, dir, "account", "", WithInsecure(), WithDirectoryURL(ca.URL+"/dir"), WithClock(laterClock(48*time.Hour)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := expired.Resume(ctx, time.Minute, cp); !errors.Is(err, ErrOrderExpired) {
+		t.Fatalf("Resume after expiry = %v, want %v", err, ErrOrderExpired)
+	}
+
+	next, err := c.Resume(ctx, time.Minute, cp)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if next != "" {
+		t.Fatal("Resume returned a checkpoint after writing the certificate")
+	}
+	if n := ca.count("/new-order"); n != 1 {
+		t.Errorf("placed %d orders, want 1", n)
+	}
+	if n := ca.count("/finalize/0"); n != 1 {
+		t.Errorf("finalized %d times, want 1", n)
+	}
+	if got := loadLeaf(t, dir, "a").DNSNames; !sameDomains(got, []string{"a.example"}) {
+		t.Errorf("certificate for %v", got)
+	}
+}
@@ -2,75 +2,463 @@ package acme
 
 import (
 	"context"
+	"crypto"
+	"crypto/rand"
+	"crypto/x509/pkix"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
 	"os"
+	"path"
+	"sync"
+	"time"
 
 	"github.com/sirupsen/logrus"
 	"golang.org/x/crypto/acme"
+	"golang.org/x/sync/errgroup"
+	"golang.org/x/sync/singleflight"
 )
 
 // Client facilitates the process of obtaining TLS certificates.
 type Client struct {
-	client *acme.Client
-	log    *logrus.Entry
+	// client is replaced when the directory is refreshed; use ca.
+	clientMu sync.RWMutex
+	client   *acme.Client
+	log      *logrus.Entry
+	rand     io.Reader
+
+	// directory and transport configure the connection to the CA.
+	directory  string
+	transport  http.RoundTripper
+	userAgent  string
+	dircache   *dirCache
+	dirRefresh time.Duration
+
+	// caaIdentity is the issuer domain name checked by CheckCAA.
+	caaIdentity string
+
+	// canary authorizes changed certificates before this client orders
+	// them; see WithStagingCanary.
+	canary *Client
+
+	// live keeps numbered versions with a live link; see WithLiveLinks.
+	live bool
+	// sniMatching chooses the certificates listeners serve; see
+	// WithSNIMatching.
+	sniMatching SNIMatching
+	// readOnly forbids writes to disk and the CA; see WithReadOnly.
+	readOnly bool
+
+	// dir and accountName locate the account files, account is the last
+	// known server-side state of the account.
+	dir         string
+	accountName string
+	account     *Account
+	accountFile *accountFile
+	// accountMu guards changes to accountFile.
+	accountMu sync.Mutex
+	eab       *acme.ExternalAccountBinding
+
+	mustStaple  bool
+	clientAuth  bool
+	strict      bool
+	retrySubset bool
+	reuseKey    bool
+	keyType     string
+	dualKey     bool
+
+	allowedHosts []string
+	insecureURLs bool
+	// insecure skips TLS verification of a test CA; see WithInsecure.
+	insecure bool
+
+	// conditional revalidates POST-as-GET responses; see
+	// WithConditionalRequests.
+	conditional bool
+
+	pollInterval  time.Duration
+	maxRetryAfter time.Duration
+	deadline      time.Duration
+
+	// issuing and authorizing collapse concurrent calls for the same
+	// certificate or domain name into a single request to the CA.
+	issuing     singleflight.Group
+	authorizing singleflight.Group
+
+	// txt holds the TXT values of the DNS challenges in progress, doh the
+	// resolvers they are checked with.
+	txt         txtRecords
+	doh         []string
+	propagation *Propagation
+	dnsProvider DNSProvider
+	httpSolver  HTTPSolver
+	delegation  *delegation
+
+	// leaseOwner and leaseTTL configure the lease taken on a certificate
+	// before issuing it; no lease is taken if leaseOwner is empty.
+	leaseOwner string
+	leaseTTL   time.Duration
+
+	// orders and limiter bound how many issuances run and how fast they
+	// start; both are optional.
+	orders  chan struct{}
+	limiter *limiter
+	quotas  map[string]*quotaState
+
+	hooks []func(Event)
+	clock Clock
+	cdns  cdnCache
+
+	// tokens and alpn hold the responses of the challenges being solved;
+	// a staging canary shares them with its client.
+	tokens *tokens
+	alpn   *alpnCerts
+}
+
+// Option configures a Client.
+type Option func(*Client)
+
+// WithRand sets the entropy source used to generate keys and sign CSRs, e.g.
+// an HSM-backed RNG. It defaults to crypto/rand.Reader. Since Go 1.26,
+// crypto/rsa and crypto/ecdsa only use the source if the main module sets
+// GODEBUG=cryptocustomrand=1, e.g. with a //go:debug directive; otherwise
+// they use the system's secure source. Tests that need reproducible keys
+// and CSRs use acmetest.Deterministic instead.
+func WithRand(r io.Reader) Option {
+	return func(c *Client) {
+		c.rand = r
+	}
+}
+
+// WithTransport sets the transport used to reach the CA, e.g. to go through
+// a proxy or to inject failures with acmetest.Chaos. It defaults to
+// http.DefaultTransport. It cannot be combined with WithInsecure, which
+// brings its own transport.
+func WithTransport(rt http.RoundTripper) Option {
+	return func(c *Client) {
+		c.transport = rt
+	}
 }
 
 // New creates a new ACME client. If the key does not exist, a new one is
 // generated and registered.
-func New(ctx context.Context, dir, accountkey, email string) (*Client, error) {
-	client := &acme.Client{}
-	k, err := loadKey(dir, accountkey + ".key")
+func New(ctx context.Context, dir, accountkey, email string, opts ...Option) (*Client, error) {
+	c := &Client{
+		log:           logrus.WithField("context", "acme"),
+		dir:           dir,
+		accountName:   accountkey,
+		rand:          rand.Reader,
+		pollInterval:  DefaultPollInterval,
+		maxRetryAfter: DefaultMaxRetryAfter,
+		clock:         systemClock{},
+		transport:     http.DefaultTransport,
+		tokens:        &tokens{},
+		alpn:          &alpnCerts{},
+	}
+	for _, opt := range opts {
+		opt(c)
+	}
+	if c.pollInterval <= 0 {
+		return nil, fmt.Errorf("poll interval must be positive, got %s", c.pollInterval)
+	}
+	if c.canary != nil {
+		c.canary.shareSolvers(c)
+	}
+	c.dircache = &dirCache{url: c.directory}
+	if c.dircache.url == "" {
+		c.dircache.url = ProductionURL
+	}
+	if c.insecure {
+		if c.transport != http.DefaultTransport {
+			return nil, errors.New("WithInsecure and WithTransport cannot be combined")
+		}
+		t, err := c.checkInsecure(ctx, c.dircache.url)
+		if err != nil {
+			return nil, err
+		}
+		c.transport = t
+	}
+	transport := c.transport
+	if c.readOnly {
+		transport = &readOnlyTransport{next: transport}
+	}
+	if c.conditional {
+		transport = &condTransport{next: transport}
+	}
+	transport = &certURLTransport{next: transport, validate: c.validateURL}
+	client := &acme.Client{
+		DirectoryURL: c.directory,
+		UserAgent:    c.userAgent,
+		HTTPClient: &http.Client{
+			Transport: &traceTransport{
+				next: &dirTransport{
+					next: &retryAfterTransport{
+						next:  transport,
+						max:   c.maxRetryAfter,
+						poll:  c.pollInterval,
+						clock: c.clock,
+					},
+					cache: c.dircache,
+					clock: c.clock,
+				},
+				log: c.log,
+			},
+		},
+	}
+	c.client = client
+	f, migrated, err := loadAccountFile(dir, accountkey)
 	if err != nil {
-		if os.IsNotExist(err) {
-			k, err = generateKey(dir, accountkey + ".key")
-			if err != nil {
-				return nil, err
-			}
-			client.Key = k
-
-			if email == "" {
-				if _, err := client.Register(ctx, nil, acme.AcceptTOS); err != nil {
-					return nil, err
-				}
-			} else {
-				account := acme.Account{
-					Contact: []string{"mailto:" + email},
-				}
-				if _, err := client.Register(ctx, &account, acme.AcceptTOS); err != nil {
-					return nil, err
-				}
-			}
-
-		} else {
+		if !os.IsNotExist(err) {
+			return nil, err
+		}
+		if err := c.register(ctx, email); err != nil {
+			return nil, err
+		}
+		return c, nil
+	}
+	k, err := f.currentKey()
+	if err != nil {
+		return nil, err
+	}
+	client.Key = k
+	c.accountFile = f
+	c.account = f.Account
+	if migrated {
+		f.Directory = c.directoryURL()
+		c.log.Debugf("migrating account %s to version %d", accountkey, accountVersion)
+		if err := c.saveAccountFile(); err != nil {
 			return nil, err
 		}
-	} else {
-		client.Key = k
 	}
-	return &Client{
-		client: client,
-		log:    logrus.WithField("context", "acme"),
-	}, nil
+	if err := c.settleRollover(ctx); err != nil {
+		return nil, err
+	}
+	return c, nil
 }
 
 // Create attempts to create a TLS certificate and private key for the
 // specified domain names. The provided address is used for challenges.
+// Concurrent calls for the same certificate share a single issuance.
 func (c *Client) Create(ctx context.Context, dir, name, chtype string, domains ...string) error {
-	out := make(chan error)
-	for _, d := range domains {
-		go func(d string)(err error) {
-			err = c.authorize(ctx, d, chtype, dir)
-			out <- err
-			return err
-		}(d)
+	return c.issue(ctx, dir, c.newConfig(name, chtype, domains))
+}
+
+// newConfig returns the parameters for a new certificate, using the client's
+// defaults.
+func (c *Client) newConfig(name, chtype string, domains []string) *RenewalConfig {
+	return &RenewalConfig{
+		Name:       name,
+		Chtype:     chtype,
+		Domains:    domains,
+		MustStaple: c.mustStaple,
+		ClientAuth: c.clientAuth,
+		ReuseKey:   c.reuseKey,
+		KeyType:    c.keyType,
+		DualKey:    c.dualKey,
+	}
+}
+
+// sharedIssueTimeout bounds an issuance shared by concurrent calls when
+// WithDeadline is not set.
+const sharedIssueTimeout = time.Hour
+
+// issue runs create for the certificate, sharing the result with concurrent
+// calls for the same certificate. The shared issuance runs detached from
+// the context of the call that started it, so that call giving up does not
+// fail the others; each call returns when its own context is done. A call
+// for other domain names waits for the running issuance and then issues
+// its own, as both write the same files.
+func (c *Client) issue(ctx context.Context, dir string, cfg *RenewalConfig) error {
+	cfg, err := inheritDefaults(dir, cfg)
+	if err != nil {
+		return err
+	}
+	if err := cfg.normalize(); err != nil {
+		return err
+	}
+	return c.issueWith(ctx, dir, cfg, func(ctx context.Context) error {
+		return c.create(ctx, dir, cfg)
+	})
+}
+
+// issueWith is issue for a normalized cfg, with create performing the
+// issuance.
+func (c *Client) issueWith(ctx context.Context, dir string, cfg *RenewalConfig, create func(context.Context) error) error {
+	for {
+		ch := c.issuing.DoChan(issueKey(dir, cfg.Name), func() (interface{}, error) {
+			timeout := c.deadline
+			if timeout <= 0 {
+				timeout = sharedIssueTimeout
+			}
+			ctx, cancel := c.withTimeout(context.WithoutCancel(ctx), timeout)
+			defer cancel()
+			renewal := certExists(dir, cfg.Name)
+			err := create(ctx)
+			if err == nil && renewal {
+				c.emit(EventCertificateRenewed, cfg.Name, cfg.Domains, nil)
+			}
+			return cfg.Domains, err
+		})
+		select {
+		case r := <-ch:
+			if !r.Shared || sameDomains(r.Val.([]string), cfg.Domains) {
+				if r.Shared {
+					c.log.Debugf("shared issuance of %s", cfg.Name)
+				}
+				return r.Err
+			}
+			c.log.Debugf("issuance of %s for other domains done, issuing again", cfg.Name)
+		case <-ctx.Done():
+			return ctx.Err()
+		}
 	}
-	<-out
-	k, err := generateKey(dir, name + ".key")
+}
+
+// issueKey identifies a certificate by its location only. Issuances of the
+// same name for other domain names share its files, so they must not run
+// at the same time either.
+func issueKey(dir, name string) string {
+	return path.Join(dir, name)
+}
+
+// create performs the issuance and records its parameters for renewal.
+func (c *Client) create(ctx context.Context, dir string, cfg *RenewalConfig) (err error) {
+	if err := c.writable(); err != nil {
+		return err
+	}
+	ctx, op := c.operation(ctx)
+	defer func() {
+		err = op.wrap(err)
+	}()
+	release, err := c.acquire(ctx)
 	if err != nil {
 		return err
 	}
-	b, err := createCSR(k, domains...)
+	defer release()
+	unlease, err := c.lease(dir, cfg.Name)
 	if err != nil {
 		return err
 	}
-	return c.createCert(ctx, b, name, dir)
+	defer unlease()
+	defer func(start time.Time) {
+		c.record(dir, cfg, start, err)
+	}(c.clock.Now())
+	ctx, cancel := c.withDeadline(ctx)
+	defer cancel()
+	if err := c.obtain(ctx, dir, cfg); err != nil {
+		if err := c.retry(ctx, dir, cfg, err); err != nil {
+			return err
+		}
+	}
+	return c.finish(ctx, dir, cfg)
+}
+
+// authorizeAll completes the provided authorizations concurrently and returns
+// the error of each failed domain name. The first error that is not specific
+// to a domain name, see domainError, cancels the other authorizations and is
+// returned instead.
+func (c *Client) authorizeAll(ctx context.Context, dir, chtype string, authzURLs ...string) (map[string]error, error) {
+	var (
+		mu     sync.Mutex
+		failed map[string]error
+	)
+	g, ctx := errgroup.WithContext(ctx)
+	for _, u := range authzURLs {
+		g.Go(func() error {
+			v, err, _ := c.authorizing.Do(u, func() (interface{}, error) {
+				var d string
+				err := protect(chtype+" solver", func() (err error) {
+					d, err = c.authorize(ctx, u, chtype, dir)
+					return err
+				})
+				return d, err
+			})
+			d, _ := v.(string)
+			if d == "" {
+				d = u
+			}
+			if err == nil {
+				c.emit(EventDomainAuthorized, "", []string{d}, nil)
+				return nil
+			}
+			c.emit(EventAuthorizationFailed, "", []string{d}, err)
+			if !domainError(err) {
+				return err
+			}
+			mu.Lock()
+			defer mu.Unlock()
+			if failed == nil {
+				failed = make(map[string]error)
+			}
+			failed[d] = err
+			return nil
+		})
+	}
+	if err := g.Wait(); err != nil {
+		return nil, err
+	}
+	return failed, nil
+}
+
+// domainProblems are the problem types caused by a single identifier.
+var domainProblems = map[string]bool{
+	"urn:ietf:params:acme:error:caa":                   true,
+	"urn:ietf:params:acme:error:connection":            true,
+	"urn:ietf:params:acme:error:dns":                   true,
+	"urn:ietf:params:acme:error:incorrectResponse":     true,
+	"urn:ietf:params:acme:error:rejectedIdentifier":    true,
+	"urn:ietf:params:acme:error:tls":                   true,
+	"urn:ietf:params:acme:error:unauthorized":          true,
+	"urn:ietf:params:acme:error:unsupportedIdentifier": true,
+}
+
+// domainError reports whether err only concerns the domain name being
+// authorized, so the other names of the order may still succeed.
+func domainError(err error) bool {
+	var ae *acme.AuthorizationError
+	var p *acme.Error
+	switch {
+	case errors.As(err, &ae):
+		return true
+	case errors.As(err, &p):
+		return domainProblems[p.ProblemType]
+	}
+	return errors.Is(err, ErrNoChallenges)
+}
+
+// generateCSR creates the certificate key and a CSR for the certificate.
+func (c *Client) generateCSR(dir string, cfg *RenewalConfig) ([]byte, error) {
+	b, fresh, err := c.newCSR(dir, cfg)
+	if err != nil || fresh == nil {
+		return b, err
+	}
+	if err := writeCertKey(dir, cfg.Name+pendingKeySuffix, fresh); err != nil {
+		return nil, err
+	}
+	return b, nil
+}
+
+// newCSR creates a CSR for the certificate like generateCSR, but returns a
+// new key instead of writing it, so it can be generated before the
+// issuance that owns the certificate's files has started.
+func (c *Client) newCSR(dir string, cfg *RenewalConfig) (csr []byte, fresh crypto.Signer, err error) {
+	k, isNew, err := c.certKey(dir, cfg)
+	if err != nil {
+		return nil, nil, err
+	}
+	var exts []pkix.Extension
+	if cfg.MustStaple {
+		exts = append(exts, mustStapleExt)
+	}
+	if cfg.ClientAuth {
+		exts = append(exts, clientAuthExt)
+	}
+	if csr, err = createCSR(c.rand, k, exts, cfg.Domains...); err != nil {
+		return nil, nil, err
+	}
+	if isNew {
+		fresh = k
+	}
+	return csr, fresh, nil
 }
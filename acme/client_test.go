@@ -0,0 +1,60 @@
+package acme
+
+import (
+	"context"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestCreateConcurrent(t *testing.T) {
+	tests := []struct {
+		name    string
+		domains [][]string
+		orders  int
+	}{
+		{"same domains", [][]string{{"a.example"}, {"a.example"}, {"a.example"}}, 1},
+		{"other domains", [][]string{{"a.example"}, {"a.example", "b.example"}}, 2},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ca := newTestCA(t)
+			// Hold the first order in finalization, so the other calls
+			// would overtake it if they were not serialized.
+			var finalized int32
+			ca.before = func(path string) {
+				if strings.HasPrefix(path, "/finalize/") && atomic.AddInt32(&finalized, 1) == 1 {
+					time.Sleep(300 * time.Millisecond)
+				}
+			}
+			dir := t.TempDir()
+			c := ca.newClient(t, dir)
+			var wg sync.WaitGroup
+			errs := make([]error, len(tt.domains))
+			for i, domains := range tt.domains {
+				wg.Add(1)
+				go func(i int, domains []string) {
+					defer wg.Done()
+					time.Sleep(time.Duration(i) * 50 * time.Millisecond)
+					errs[i] = c.Create(context.Background(), dir, "a", ChallengeHTTP, domains...)
+				}(i, domains)
+			}
+			wg.Wait()
+			for i, err := range errs {
+				if err != nil {
+					t.Fatalf("Create %v: %v", tt.domains[i], err)
+				}
+			}
+			if n := ca.count("/new-order"); n != tt.orders {
+				t.Errorf("placed %d orders, want %d", n, tt.orders)
+			}
+			// The last call issues last, with the key it generated.
+			want := tt.domains[len(tt.domains)-1]
+			if got := loadLeaf(t, dir, "a").DNSNames; !sameDomains(got, want) {
+				t.Errorf("certificate for %v, want %v", got, want)
+			}
+		})
+	}
+}
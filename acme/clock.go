@@ -0,0 +1,23 @@
+package acme
+
+import "time"
+
+// Clock tells the time and waits. It allows tests to control polling,
+// rate limiting and expiry decisions.
+type Clock interface {
+	Now() time.Time
+	After(d time.Duration) <-chan time.Time
+}
+
+// systemClock is the Clock backed by package time.
+type systemClock struct{}
+
+func (systemClock) Now() time.Time                         { return time.Now() }
+func (systemClock) After(d time.Duration) <-chan time.Time { return time.After(d) }
+
+// WithClock replaces the system clock.
+func WithClock(clk Clock) Option {
+	return func(c *Client) {
+		c.clock = clk
+	}
+}
@@ -0,0 +1,224 @@
+package acme
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+)
+
+// cloudflareAPI is the Cloudflare API v4 endpoint.
+const cloudflareAPI = "https://api.cloudflare.com/client/v4"
+
+// challengeTTL is the TTL of the challenge records added by the DNS
+// providers.
+const challengeTTL = 120
+
+// Cloudflare is a DNSProvider for zones hosted by Cloudflare. The API token
+// needs the Zone:Read and DNS:Edit permissions.
+type Cloudflare struct {
+	APIToken string
+	// ZoneID is the zone of the records; if empty, it is looked up by
+	// name.
+	ZoneID string
+
+	mu    sync.Mutex
+	zones map[string]string
+}
+
+// cloudflareResponse is the envelope of Cloudflare API responses.
+type cloudflareResponse struct {
+	Success bool `json:"success"`
+	Errors  []struct {
+		Code    int    `json:"code"`
+		Message string `json:"message"`
+	} `json:"errors"`
+	Result json.RawMessage `json:"result"`
+}
+
+// cloudflareRecord is a DNS record of the Cloudflare API.
+type cloudflareRecord struct {
+	ID      string `json:"id,omitempty"`
+	Type    string `json:"type"`
+	Name    string `json:"name"`
+	Content string `json:"content"`
+	TTL     int    `json:"ttl"`
+}
+
+// Propagation returns the timing of the Cloudflare profile.
+func (p *Cloudflare) Propagation() Propagation {
+	return PropagationProfiles["cloudflare"]
+}
+
+// Present adds the TXT record.
+func (p *Cloudflare) Present(ctx context.Context, name, value string) error {
+	zone, err := p.zone(ctx, name)
+	if err != nil {
+		return err
+	}
+	rec := cloudflareRecord{Type: "TXT", Name: name, Content: value, TTL: challengeTTL}
+	return p.do(ctx, "POST", "/zones/"+zone+"/dns_records", rec, nil)
+}
+
+// Cleanup removes the TXT record.
+func (p *Cloudflare) Cleanup(ctx context.Context, name, value string) error {
+	zone, err := p.zone(ctx, name)
+	if err != nil {
+		return err
+	}
+	q := url.Values{"type": {"TXT"}, "name": {name}}
+	var recs []cloudflareRecord
+	if err := p.do(ctx, "GET", "/zones/"+zone+"/dns_records?"+q.Encode(), nil, &recs); err != nil {
+		return err
+	}
+	for _, r := range recs {
+		if txtData(r.Content) != value {
+			continue
+		}
+		if err := p.do(ctx, "DELETE", "/zones/"+zone+"/dns_records/"+r.ID, nil, nil); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// zone returns the ID of the zone of the record name, the closest parent
+// of name hosted by the account.
+func (p *Cloudflare) zone(ctx context.Context, name string) (string, error) {
+	if p.ZoneID != "" {
+		return p.ZoneID, nil
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	for d := strings.TrimSuffix(name, "."); strings.Contains(d, "."); d = d[strings.IndexByte(d, '.')+1:] {
+		if id, ok := p.zones[d]; ok {
+			return id, nil
+		}
+		var zones []struct {
+			ID string `json:"id"`
+		}
+		if err := p.do(ctx, "GET", "/zones?"+url.Values{"name": {d}}.Encode(), nil, &zones); err != nil {
+			return "", err
+		}
+		if len(zones) > 0 {
+			if p.zones == nil {
+				p.zones = make(map[string]string)
+			}
+			p.zones[d] = zones[0].ID
+			return zones[0].ID, nil
+		}
+	}
+	return "", fmt.Errorf("cloudflare: no zone for %s", name)
+}
+
+// do sends an API request with the JSON body in, if not nil, and decodes
+// the result into out, if not nil.
+func (p *Cloudflare) do(ctx context.Context, method, path string, in, out interface{}) error {
+	var body io.Reader
+	if in != nil {
+		b, err := json.Marshal(in)
+		if err != nil {
+			return err
+		}
+		body = bytes.NewReader(b)
+	}
+	req, err := http.NewRequest(method, cloudflareAPI+path, body)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Authorization", "Bearer "+p.APIToken)
+	if in != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	resp, err := http.DefaultClient.Do(req.WithContext(ctx))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	b, err := ioutil.ReadAll(io.LimitReader(resp.Body, 1<<20))
+	if err != nil {
+		return err
+	}
+	var r cloudflareResponse
+	if err := json.Unmarshal(b, &r); err != nil {
+		return fmt.Errorf("cloudflare: %s %s: unexpected status %s", method, path, resp.Status)
+	}
+	if !r.Success {
+		msgs := make([]string, 0, len(r.Errors))
+		for _, e := range r.Errors {
+			msgs = append(msgs, fmt.Sprintf("%d: %s", e.Code, e.Message))
+		}
+		return fmt.Errorf("cloudflare: %s %s: %s", method, path, strings.Join(msgs, "; "))
+	}
+	if out != nil {
+		return json.Unmarshal(r.Result, out)
+	}
+	return nil
+}
+
+// Deploy uploads the certificate name from dir as a custom
+// certificate of the zone of its first domain name, replacing the custom
+// certificate for the same hosts if there is one. Custom certificates
+// require a Business or Enterprise plan and the SSL and Certificates:Edit
+// permission.
+func (p *Cloudflare) Deploy(ctx context.Context, dir, name string) error {
+	certs, err := loadChain(dir, name)
+	if err != nil {
+		return err
+	}
+	leaf, chain, key, err := deployFiles(dir, name)
+	if err != nil {
+		return err
+	}
+	names := certNames(certs[0])
+	zone, err := p.zone(ctx, strings.TrimPrefix(names[0], "*."))
+	if err != nil {
+		return err
+	}
+	var existing []struct {
+		ID    string   `json:"id"`
+		Hosts []string `json:"hosts"`
+	}
+	if err := p.do(ctx, "GET", "/zones/"+zone+"/custom_certificates", nil, &existing); err != nil {
+		return err
+	}
+	in := map[string]string{
+		"certificate":   string(leaf) + string(chain),
+		"private_key":   string(key),
+		"bundle_method": "force",
+	}
+	for _, c := range existing {
+		if sameNames(c.Hosts, names) {
+			return p.do(ctx, "PATCH", "/zones/"+zone+"/custom_certificates/"+c.ID, in, nil)
+		}
+	}
+	return p.do(ctx, "POST", "/zones/"+zone+"/custom_certificates", in, nil)
+}
+
+// sameNames reports whether a and b hold the same names, ignoring order
+// and duplicates.
+func sameNames(a, b []string) bool {
+	set := func(names []string) map[string]bool {
+		m := make(map[string]bool, len(names))
+		for _, n := range names {
+			m[strings.ToLower(n)] = true
+		}
+		return m
+	}
+	sa, sb := set(a), set(b)
+	if len(sa) != len(sb) {
+		return false
+	}
+	for n := range sa {
+		if !sb[n] {
+			return false
+		}
+	}
+	return true
+}
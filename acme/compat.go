@@ -0,0 +1,89 @@
+package acme
+
+import (
+	"context"
+
+	"golang.org/x/crypto/acme"
+)
+
+// The declarations below keep code written against the original API
+// compiling. They will be removed in a future major version.
+
+// HttpChallenge returns the http-01 challenge of the authorization.
+//
+// Deprecated: use HTTPChallenge.
+func HttpChallenge(auth *acme.Authorization) (*acme.Challenge, error) {
+	return HTTPChallenge(auth)
+}
+
+// DnsChallenge returns the dns-01 challenge of the authorization.
+//
+// Deprecated: use DNSChallenge.
+func DnsChallenge(auth *acme.Authorization) (*acme.Challenge, error) {
+	return DNSChallenge(auth)
+}
+
+// PerHttpChallenge solves an http-01 challenge.
+//
+// Deprecated: use SolveHTTP.
+func (c *Client) PerHttpChallenge(ctx context.Context, chal *acme.Challenge, domain, path string) error {
+	return c.SolveHTTP(ctx, chal, domain, path)
+}
+
+// PerDnsChallenge solves a dns-01 challenge.
+//
+// Deprecated: use SolveDNS.
+func (c *Client) PerDnsChallenge(ctx context.Context, chal *acme.Challenge, domain string) error {
+	return c.SolveDNS(ctx, chal, domain)
+}
+
+// TxtChange returns the _acme-challenge TXT record of domain, or an empty
+// string if it cannot be found.
+//
+// Deprecated: use LookupTXT.
+func TxtChange(domain string) (res string) {
+	res, _ = LookupTXT(context.Background(), domain)
+	return res
+}
+
+// Mone is the dns_query API response.
+//
+// Deprecated: the API response is an implementation detail of LookupTXT.
+type Mone struct {
+	Code  int   `json:"code"`
+	Error error `json:"error"`
+	Data  Mtwo  `json:"data"`
+}
+
+// Mtwo holds the dns_query results per resolver region.
+//
+// Deprecated: the API response is an implementation detail of LookupTXT.
+type Mtwo struct {
+	Ca []Mthree `json:"01"`
+	Hk []Mthree `json:"852"`
+	Us []Mthree `json:"86"`
+}
+
+// Mthree is a single dns_query result.
+//
+// Deprecated: the API response is an implementation detail of LookupTXT.
+type Mthree struct {
+	Answer Mfour `json:"answer"`
+}
+
+// Mfour is the answer of a dns_query result.
+//
+// Deprecated: the API response is an implementation detail of LookupTXT.
+type Mfour struct {
+	Timeconsume string `json:"time_consume"`
+	Records     []E    `json:"records"`
+	Error       string `json:"error"`
+}
+
+// E is a TXT record of a dns_query answer.
+//
+// Deprecated: the API response is an implementation detail of LookupTXT.
+type E struct {
+	Ttl   int    `json:"ttl"`
+	Value string `json:"value"`
+}
@@ -0,0 +1,159 @@
+package acme
+
+import (
+	"bytes"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"sync"
+)
+
+const (
+	// maxConditionalEntries bounds the number of responses kept for
+	// conditional requests.
+	maxConditionalEntries = 1024
+	// maxConditionalBody is the largest response body kept.
+	maxConditionalBody = 1 << 16
+)
+
+// WithConditionalRequests keeps the authorizations, orders and other
+// resources fetched with POST-as-GET together with their ETag or
+// Last-Modified validators, and revalidates them with If-None-Match and
+// If-Modified-Since. A CA supporting conditional requests then answers
+// the polling of large deployments with 304 Not Modified; responses
+// without validators are not kept, so other CAs are unaffected.
+func WithConditionalRequests() Option {
+	return func(c *Client) {
+		c.conditional = true
+	}
+}
+
+// condEntry is a response kept for revalidation.
+type condEntry struct {
+	etag         string
+	lastModified string
+	header       http.Header
+	body         []byte
+}
+
+// condTransport sends conditional POST-as-GET requests and replaces 304
+// responses with the kept response.
+type condTransport struct {
+	next http.RoundTripper
+
+	mu      sync.Mutex
+	entries map[string]*condEntry
+}
+
+// RoundTrip implements http.RoundTripper.
+func (t *condTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if req.Method != "POST" || req.Body == nil {
+		return t.next.RoundTrip(req)
+	}
+	b, err := ioutil.ReadAll(req.Body)
+	req.Body.Close()
+	if err != nil {
+		return nil, err
+	}
+	req.Body = ioutil.NopCloser(bytes.NewReader(b))
+	if payload, ok := jwsPayload(b); !ok || payload != "" {
+		return t.next.RoundTrip(req)
+	}
+	key := req.URL.String()
+	e := t.get(key)
+	if e != nil {
+		req = req.Clone(req.Context())
+		req.Body = ioutil.NopCloser(bytes.NewReader(b))
+		if e.etag != "" {
+			req.Header.Set("If-None-Match", e.etag)
+		}
+		if e.lastModified != "" {
+			req.Header.Set("If-Modified-Since", e.lastModified)
+		}
+	}
+	resp, err := t.next.RoundTrip(req)
+	if err != nil {
+		return nil, err
+	}
+	switch {
+	case resp.StatusCode == http.StatusNotModified && e != nil:
+		resp.Body.Close()
+		// The 304 carries a fresh nonce and may update other headers.
+		h := e.header.Clone()
+		for k, v := range resp.Header {
+			h[k] = v
+		}
+		return &http.Response{
+			Status:        "200 OK",
+			StatusCode:    http.StatusOK,
+			Proto:         resp.Proto,
+			ProtoMajor:    resp.ProtoMajor,
+			ProtoMinor:    resp.ProtoMinor,
+			Header:        h,
+			Body:          ioutil.NopCloser(bytes.NewReader(e.body)),
+			ContentLength: int64(len(e.body)),
+			Request:       req,
+		}, nil
+	case resp.StatusCode != http.StatusOK:
+		return resp, nil
+	}
+	etag, lastModified := resp.Header.Get("ETag"), resp.Header.Get("Last-Modified")
+	if etag == "" && lastModified == "" {
+		t.remove(key)
+		return resp, nil
+	}
+	body, err := ioutil.ReadAll(io.LimitReader(resp.Body, maxConditionalBody+1))
+	if err != nil {
+		resp.Body.Close()
+		return nil, err
+	}
+	if len(body) > maxConditionalBody {
+		// Too large to keep; pass the rest of the body on unread.
+		t.remove(key)
+		resp.Body = struct {
+			io.Reader
+			io.Closer
+		}{io.MultiReader(bytes.NewReader(body), resp.Body), resp.Body}
+		return resp, nil
+	}
+	resp.Body.Close()
+	resp.Body = ioutil.NopCloser(bytes.NewReader(body))
+	t.put(key, &condEntry{
+		etag:         etag,
+		lastModified: lastModified,
+		header:       resp.Header.Clone(),
+		body:         body,
+	})
+	return resp, nil
+}
+
+// get returns the entry kept for url.
+func (t *condTransport) get(url string) *condEntry {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.entries[url]
+}
+
+// put keeps an entry for url, dropping an arbitrary one if the cache is
+// full.
+func (t *condTransport) put(url string, e *condEntry) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.entries == nil {
+		t.entries = make(map[string]*condEntry)
+	}
+	if _, ok := t.entries[url]; !ok && len(t.entries) >= maxConditionalEntries {
+		for k := range t.entries {
+			delete(t.entries, k)
+			break
+		}
+	}
+	t.entries[url] = e
+}
+
+// remove drops the entry for url.
+func (t *condTransport) remove(url string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	delete(t.entries, url)
+}
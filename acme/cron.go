@@ -0,0 +1,202 @@
+package acme
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Cron is a parsed cron expression with the fields minute, hour, day of
+// month, month and day of week, e.g. "*/15 2-3 * * 1-5" for every quarter
+// hour between 02:00 and 04:00 on weekdays. Fields accept *, values, ranges,
+// steps and lists, and month and weekday names. The expression may start
+// with CRON_TZ=<zone> to evaluate it in that time zone instead of the local
+// one.
+type Cron struct {
+	minute, hour, dom, month, dow uint64
+	domAny, dowAny                bool
+	loc                           *time.Location
+}
+
+// cronField describes the range and names of a cron field.
+type cronField struct {
+	min, max int
+	names    []string
+}
+
+var (
+	cronMinute = cronField{0, 59, nil}
+	cronHour   = cronField{0, 23, nil}
+	cronDom    = cronField{1, 31, nil}
+	cronMonth  = cronField{1, 12, []string{"jan", "feb", "mar", "apr", "may", "jun", "jul", "aug", "sep", "oct", "nov", "dec"}}
+	cronDow    = cronField{0, 7, []string{"sun", "mon", "tue", "wed", "thu", "fri", "sat"}}
+)
+
+// ParseCron parses a cron expression.
+func ParseCron(expr string) (*Cron, error) {
+	c := &Cron{loc: time.Local}
+	fields := strings.Fields(expr)
+	if len(fields) > 0 && strings.HasPrefix(fields[0], "CRON_TZ=") {
+		loc, err := time.LoadLocation(strings.TrimPrefix(fields[0], "CRON_TZ="))
+		if err != nil {
+			return nil, err
+		}
+		c.loc = loc
+		fields = fields[1:]
+	}
+	if len(fields) != 5 {
+		return nil, fmt.Errorf("cron expression %q: want 5 fields, got %d", expr, len(fields))
+	}
+	var err error
+	for i, f := range []struct {
+		bits *uint64
+		spec cronField
+	}{
+		{&c.minute, cronMinute},
+		{&c.hour, cronHour},
+		{&c.dom, cronDom},
+		{&c.month, cronMonth},
+		{&c.dow, cronDow},
+	} {
+		if *f.bits, err = parseCronField(fields[i], f.spec); err != nil {
+			return nil, fmt.Errorf("cron expression %q: %v", expr, err)
+		}
+	}
+	// Sunday may be written as 0 or 7.
+	if c.dow&(1<<7) != 0 {
+		c.dow |= 1
+	}
+	c.domAny = fields[2] == "*"
+	c.dowAny = fields[4] == "*"
+	return c, nil
+}
+
+// parseCronField returns the set of values of a field as a bit mask.
+func parseCronField(s string, f cronField) (uint64, error) {
+	var bits uint64
+	for _, part := range strings.Split(s, ",") {
+		step := 1
+		if i := strings.IndexByte(part, '/'); i >= 0 {
+			n, err := strconv.Atoi(part[i+1:])
+			if err != nil || n < 1 {
+				return 0, fmt.Errorf("invalid step in %q", part)
+			}
+			step = n
+			part = part[:i]
+		}
+		lo, hi := f.min, f.max
+		if part != "*" {
+			bounds := strings.SplitN(part, "-", 2)
+			var err error
+			if lo, err = f.value(bounds[0]); err != nil {
+				return 0, err
+			}
+			hi = lo
+			if len(bounds) == 2 {
+				if hi, err = f.value(bounds[1]); err != nil {
+					return 0, err
+				}
+			} else if step > 1 {
+				hi = f.max
+			}
+			if hi < lo {
+				return 0, fmt.Errorf("invalid range %q", part)
+			}
+		}
+		for v := lo; v <= hi; v += step {
+			bits |= 1 << uint(v)
+		}
+	}
+	return bits, nil
+}
+
+// value parses a single value or name of the field.
+func (f cronField) value(s string) (int, error) {
+	for i, name := range f.names {
+		if strings.EqualFold(s, name) {
+			return i + f.min, nil
+		}
+	}
+	v, err := strconv.Atoi(s)
+	if err != nil || v < f.min || v > f.max {
+		return 0, fmt.Errorf("invalid value %q", s)
+	}
+	return v, nil
+}
+
+// Matches reports whether the minute of t is selected by the expression.
+func (c *Cron) Matches(t time.Time) bool {
+	t = t.In(c.loc)
+	return c.minute&(1<<uint(t.Minute())) != 0 &&
+		c.hour&(1<<uint(t.Hour())) != 0 &&
+		c.month&(1<<uint(t.Month())) != 0 &&
+		c.dayMatches(t)
+}
+
+// dayMatches reports whether the day of t is selected by the expression.
+func (c *Cron) dayMatches(t time.Time) bool {
+	dom := c.dom&(1<<uint(t.Day())) != 0
+	dow := c.dow&(1<<uint(t.Weekday())) != 0
+	switch {
+	case c.domAny && c.dowAny:
+		return true
+	case c.domAny:
+		return dow
+	case c.dowAny:
+		return dom
+	default:
+		// As in cron, a restricted day of month or week is enough.
+		return dom || dow
+	}
+}
+
+// Next returns the first minute after t selected by the expression, or the
+// zero time if there is none within five years.
+func (c *Cron) Next(t time.Time) time.Time {
+	t = t.In(c.loc).Truncate(time.Minute).Add(time.Minute)
+	end := t.AddDate(5, 0, 0)
+	for t.Before(end) {
+		switch {
+		case c.month&(1<<uint(t.Month())) == 0:
+			t = time.Date(t.Year(), t.Month()+1, 1, 0, 0, 0, 0, c.loc)
+		case !c.dayMatches(t):
+			t = time.Date(t.Year(), t.Month(), t.Day()+1, 0, 0, 0, 0, c.loc)
+		case c.hour&(1<<uint(t.Hour())) == 0:
+			// Truncating the absolute time would miss the hour in zones
+			// with a half-hour offset, e.g. Asia/Kolkata.
+			n := time.Date(t.Year(), t.Month(), t.Day(), t.Hour()+1, 0, 0, 0, c.loc)
+			if !n.After(t) {
+				n = t.Add(time.Minute)
+			}
+			t = n
+		case c.minute&(1<<uint(t.Minute())) == 0:
+			t = t.Add(time.Minute)
+		default:
+			return t
+		}
+	}
+	return time.Time{}
+}
+
+// RenewOnSchedule runs RenewAll for dir every time the cron expression
+// matches, until ctx is done. Reports are passed to report if it is not nil.
+func (c *Client) RenewOnSchedule(ctx context.Context, dir string, cron *Cron, opts RenewOptions, report func(*RenewReport, error)) error {
+	for {
+		now := c.clock.Now()
+		next := cron.Next(now)
+		if next.IsZero() {
+			return fmt.Errorf("cron expression never matches")
+		}
+		select {
+		case <-c.clock.After(next.Sub(now)):
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+		r, err := c.RenewAll(ctx, dir, opts)
+		if report != nil {
+			report(r, err)
+		}
+	}
+}
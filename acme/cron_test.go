@@ -0,0 +1,35 @@
+package acme
+
+import (
+	"testing"
+	"time"
+)
+
+func TestCronNext(t *testing.T) {
+	tests := []struct {
+		expr string
+		from string
+		want string
+	}{
+		{"CRON_TZ=UTC 0 11 * * *", "2026-03-01T09:00:00Z", "2026-03-01T11:00:00Z"},
+		{"CRON_TZ=UTC */15 2-3 * * *", "2026-03-01T03:50:00Z", "2026-03-02T02:00:00Z"},
+		{"CRON_TZ=Asia/Kolkata 0 11 * * *", "2026-03-01T09:00:00+05:30", "2026-03-01T11:00:00+05:30"},
+		{"CRON_TZ=Asia/Kolkata 30 2 * * *", "2026-03-01T23:10:00+05:30", "2026-03-02T02:30:00+05:30"},
+		{"CRON_TZ=Asia/Kathmandu 0 6 * * mon", "2026-03-01T12:00:00+05:45", "2026-03-02T06:00:00+05:45"},
+		{"CRON_TZ=Australia/Adelaide 0 4 1 * *", "2026-03-15T00:00:00+10:30", "2026-04-01T04:00:00+10:30"},
+		{"CRON_TZ=America/St_Johns 0 9 * * *", "2026-03-01T10:00:00-03:30", "2026-03-02T09:00:00-03:30"},
+		// 02:30 does not exist on the day daylight saving time starts.
+		{"CRON_TZ=America/New_York 30 3 * * *", "2026-03-08T01:00:00-05:00", "2026-03-08T03:30:00-04:00"},
+	}
+	for _, tt := range tests {
+		c, err := ParseCron(tt.expr)
+		if err != nil {
+			t.Fatalf("ParseCron(%q): %v", tt.expr, err)
+		}
+		from, _ := time.Parse(time.RFC3339, tt.from)
+		want, _ := time.Parse(time.RFC3339, tt.want)
+		if got := c.Next(from); !got.Equal(want) {
+			t.Errorf("%q: Next(%s) = %s, want %s", tt.expr, tt.from, got, want)
+		}
+	}
+}
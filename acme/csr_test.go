@@ -0,0 +1,57 @@
+//go:build go1.26
+
+package acme
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/pem"
+	"flag"
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+
+	"github.com/fireflyst/letsencrypt/acme/acmetest"
+)
+
+var update = flag.Bool("update", false, "rewrite the golden files in testdata")
+
+func TestCSRGolden(t *testing.T) {
+	tests := []struct {
+		keyType string
+		golden  string
+	}{
+		{KeyRSA2048, "csr-rsa2048.golden"},
+		{KeyECDSAP256, "csr-ecdsap256.golden"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.keyType, func(t *testing.T) {
+			c := &Client{rand: rand.Reader}
+			cfg := &RenewalConfig{
+				Name:       "a",
+				Domains:    []string{"a.example", "b.example"},
+				KeyType:    tt.keyType,
+				MustStaple: true,
+			}
+			acmetest.Deterministic(t, 1)
+			csr, _, err := c.newCSR(t.TempDir(), cfg)
+			if err != nil {
+				t.Fatal(err)
+			}
+			got := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE REQUEST", Bytes: csr})
+			p := filepath.Join("testdata", tt.golden)
+			if *update {
+				if err := ioutil.WriteFile(p, got, 0644); err != nil {
+					t.Fatal(err)
+				}
+			}
+			want, err := ioutil.ReadFile(p)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.Equal(got, want) {
+				t.Errorf("CSR differs from %s:\n%s", p, got)
+			}
+		})
+	}
+}
@@ -0,0 +1,124 @@
+package acme
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path"
+	"time"
+)
+
+// defaultsVersion is the current version of the defaults file format.
+const defaultsVersion = 1
+
+// Defaults are renewal parameters shared by all certificates of the account
+// in a directory, stored as defaults.json. A certificate inherits every
+// default it does not set itself, and labels are merged with the
+// certificate's own taking precedence. A certificate turns off a boolean
+// default with the matching No field, e.g. RenewalConfig.NoReuseKey.
+// Defaults are applied each time a certificate is issued or renewed, so
+// changing them affects all certificates that do not override them.
+type Defaults struct {
+	Version    int    `json:"version"`
+	Chtype     string `json:"chtype,omitempty"`
+	MustStaple bool   `json:"mustStaple,omitempty"`
+	ClientAuth bool   `json:"clientAuth,omitempty"`
+	ReuseKey   bool   `json:"reuseKey,omitempty"`
+	KeyType    string `json:"keyType,omitempty"`
+	DualKey    bool   `json:"dualKey,omitempty"`
+	Schedule   string `json:"schedule,omitempty"`
+	CertPath   string `json:"certPath,omitempty"`
+	KeyPath    string `json:"keyPath,omitempty"`
+	// RenewBefore is the renewal window used by RenewAll and ExpiryReport
+	// when they are not given one.
+	RenewBefore time.Duration     `json:"renewBefore,omitempty"`
+	Labels      map[string]string `json:"labels,omitempty"`
+}
+
+// defaultsPath returns the location of the defaults file in dir.
+func defaultsPath(dir string) string {
+	return path.Join(dir, "defaults.json")
+}
+
+// LoadDefaults reads the defaults of dir. A directory without a defaults
+// file has no defaults.
+func LoadDefaults(dir string) (*Defaults, error) {
+	b, err := ioutil.ReadFile(defaultsPath(dir))
+	if os.IsNotExist(err) {
+		return &Defaults{}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	d := &Defaults{}
+	if err := json.Unmarshal(b, d); err != nil {
+		return nil, err
+	}
+	if d.Version > defaultsVersion {
+		return nil, fmt.Errorf("defaults file version %d is not supported", d.Version)
+	}
+	return d, nil
+}
+
+// Save writes the defaults to dir.
+func (d *Defaults) Save(dir string) error {
+	d.Version = defaultsVersion
+	b, err := json.MarshalIndent(d, "", "  ")
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(defaultsPath(dir), b, 0644)
+}
+
+// inherit returns cfg with the defaults applied. The certificate's own
+// parameters are kept so that saving it does not copy the defaults into its
+// renewal file.
+func (d *Defaults) inherit(cfg *RenewalConfig) *RenewalConfig {
+	if cfg.own != nil {
+		return cfg
+	}
+	eff := *cfg
+	eff.own = cfg
+	if eff.Chtype == "" {
+		eff.Chtype = d.Chtype
+	}
+	eff.MustStaple = eff.MustStaple || d.MustStaple && !eff.NoMustStaple
+	eff.ClientAuth = eff.ClientAuth || d.ClientAuth && !eff.NoClientAuth
+	eff.ReuseKey = eff.ReuseKey || d.ReuseKey && !eff.NoReuseKey
+	eff.DualKey = eff.DualKey || d.DualKey && !eff.NoDualKey
+	if eff.KeyType == "" {
+		eff.KeyType = d.KeyType
+	}
+	if eff.Schedule == "" {
+		eff.Schedule = d.Schedule
+	}
+	if eff.CertPath == "" {
+		eff.CertPath = d.CertPath
+	}
+	if eff.KeyPath == "" {
+		eff.KeyPath = d.KeyPath
+	}
+	if eff.RenewBefore <= 0 {
+		eff.RenewBefore = d.RenewBefore
+	}
+	if len(d.Labels) > 0 {
+		eff.Labels = make(map[string]string, len(d.Labels)+len(cfg.Labels))
+		for k, v := range d.Labels {
+			eff.Labels[k] = v
+		}
+		for k, v := range cfg.Labels {
+			eff.Labels[k] = v
+		}
+	}
+	return &eff
+}
+
+// inheritDefaults returns cfg with the defaults of dir applied.
+func inheritDefaults(dir string, cfg *RenewalConfig) (*RenewalConfig, error) {
+	d, err := LoadDefaults(dir)
+	if err != nil {
+		return nil, err
+	}
+	return d.inherit(cfg), nil
+}
@@ -0,0 +1,252 @@
+package acme
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"golang.org/x/crypto/acme"
+)
+
+// Headers carrying the signature of delegation requests.
+const (
+	signatureHeader = "X-Letsencrypt-Signature"
+	timestampHeader = "X-Letsencrypt-Timestamp"
+)
+
+// maxSignatureAge bounds the age of a signed delegation request, limiting
+// replays.
+const maxSignatureAge = 5 * time.Minute
+
+var ErrBadSignature = errors.New("invalid delegation signature")
+
+// Task asks a remote agent to place a challenge. It is posted as JSON to the
+// agent, which reports back to Callback with Complete.
+type Task struct {
+	ID        string           `json:"id"`
+	Challenge PendingChallenge `json:"challenge"`
+	Callback  string           `json:"callback"`
+	Expires   time.Time        `json:"expires"`
+	// Done is set on a second post of the task once the challenge was
+	// validated or abandoned; the agent removes the response and does not
+	// report back.
+	Done bool `json:"done,omitempty"`
+}
+
+// Completion is the result of a Task reported by the agent.
+type Completion struct {
+	ID    string `json:"id"`
+	Error string `json:"error,omitempty"`
+}
+
+// delegation holds the configuration and in-flight tasks of WithDelegation.
+type delegation struct {
+	agentURL    string
+	callbackURL string
+	secret      []byte
+
+	mu      sync.Mutex
+	waiting map[string]chan Completion
+	agents  map[string]registeredAgent
+}
+
+// WithDelegation hands every challenge to a remote agent instead of solving
+// it locally: the token and key authorization are posted to agentURL as a
+// Task signed with secret, and the authorization proceeds once the agent
+// posts a signed Completion to callbackURL, which must be served by
+// DelegationHandler. agentURL may be empty if agents register themselves
+// with AgentRegistryHandler.
+func WithDelegation(agentURL, callbackURL string, secret []byte) Option {
+	return func(c *Client) {
+		c.delegation = &delegation{
+			agentURL:    agentURL,
+			callbackURL: callbackURL,
+			secret:      secret,
+			waiting:     make(map[string]chan Completion),
+		}
+	}
+}
+
+// sign returns the signature of body at the timestamp ts.
+func sign(secret []byte, ts string, body []byte) string {
+	mac := hmac.New(sha256.New, secret)
+	io.WriteString(mac, ts+".")
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// postSigned posts v as signed JSON to url.
+func postSigned(ctx context.Context, url string, secret []byte, v interface{}) error {
+	b, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequest("POST", url, bytes.NewReader(b))
+	if err != nil {
+		return err
+	}
+	ts := strconv.FormatInt(time.Now().Unix(), 10)
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(timestampHeader, ts)
+	req.Header.Set(signatureHeader, sign(secret, ts, b))
+	resp, err := http.DefaultClient.Do(req.WithContext(ctx))
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		return fmt.Errorf("%s: unexpected status %s", url, resp.Status)
+	}
+	return nil
+}
+
+// readSigned verifies the signature of a request and decodes its JSON body
+// into v.
+func readSigned(r *http.Request, secret []byte, v interface{}) error {
+	b, err := ioutil.ReadAll(io.LimitReader(r.Body, 1<<16))
+	if err != nil {
+		return err
+	}
+	ts := r.Header.Get(timestampHeader)
+	sec, err := strconv.ParseInt(ts, 10, 64)
+	if err != nil {
+		return ErrBadSignature
+	}
+	if age := time.Since(time.Unix(sec, 0)); age > maxSignatureAge || age < -maxSignatureAge {
+		return fmt.Errorf("%w: timestamp out of range", ErrBadSignature)
+	}
+	if !hmac.Equal([]byte(r.Header.Get(signatureHeader)), []byte(sign(secret, ts, b))) {
+		return ErrBadSignature
+	}
+	return json.Unmarshal(b, v)
+}
+
+// ParseTask verifies and decodes a Task posted to an agent.
+func ParseTask(r *http.Request, secret []byte) (*Task, error) {
+	t := &Task{}
+	if err := readSigned(r, secret, t); err != nil {
+		return nil, err
+	}
+	return t, nil
+}
+
+// Complete reports to the client that the agent placed the challenge of
+// the task, or failed to with err.
+func Complete(ctx context.Context, t *Task, secret []byte, err error) error {
+	c := Completion{ID: t.ID}
+	if err != nil {
+		c.Error = err.Error()
+	}
+	return postSigned(ctx, t.Callback, secret, c)
+}
+
+// DelegationHandler receives the signed completions of delegated challenges
+// at the callback URL given to WithDelegation.
+func (c *Client) DelegationHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		d := c.delegation
+		if d == nil || r.Method != "POST" {
+			http.NotFound(w, r)
+			return
+		}
+		var comp Completion
+		if err := readSigned(r, d.secret, &comp); err != nil {
+			http.Error(w, err.Error(), http.StatusForbidden)
+			return
+		}
+		d.mu.Lock()
+		ch, ok := d.waiting[comp.ID]
+		delete(d.waiting, comp.ID)
+		d.mu.Unlock()
+		if !ok {
+			http.Error(w, "unknown task", http.StatusNotFound)
+			return
+		}
+		ch <- comp
+		w.WriteHeader(http.StatusNoContent)
+	})
+}
+
+// delegate hands the challenge of the authorization to the agents, waits
+// for all of them to complete and asks the CA to validate it.
+func (c *Client) delegate(ctx context.Context, auth *acme.Authorization, chtype string) error {
+	d := c.delegation
+	pc, err := c.pendingChallenge(ctx, auth, chtype)
+	if err != nil {
+		return err
+	}
+	targets := d.targets(pc.Type, c.clock.Now())
+	if len(targets) == 0 {
+		return fmt.Errorf("%s: no agent to delegate to", pc.Domain)
+	}
+	ch := make(chan Completion, len(targets))
+	var (
+		ids  []string
+		sent = make(map[string]*Task)
+	)
+	defer func() {
+		d.mu.Lock()
+		for _, id := range ids {
+			delete(d.waiting, id)
+		}
+		d.mu.Unlock()
+		c.finishTasks(d, sent)
+	}()
+	for _, target := range targets {
+		id := make([]byte, 16)
+		if _, err := rand.Read(id); err != nil {
+			return err
+		}
+		t := &Task{
+			ID:        hex.EncodeToString(id),
+			Challenge: *pc,
+			Callback:  d.callbackURL,
+			Expires:   auth.Expires,
+		}
+		d.mu.Lock()
+		d.waiting[t.ID] = ch
+		d.mu.Unlock()
+		ids = append(ids, t.ID)
+		c.log.Debugf("delegating %s challenge for %s to %s as task %s", pc.Type, pc.Domain, target, t.ID)
+		sent[target] = t
+		if err := postSigned(ctx, target, d.secret, t); err != nil {
+			return err
+		}
+	}
+	for range targets {
+		select {
+		case comp := <-ch:
+			if comp.Error != "" {
+				return fmt.Errorf("%s: agent: %s", pc.Domain, comp.Error)
+			}
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+	return c.accept(ctx, &acme.Challenge{Type: pc.Type, URI: pc.URL, Token: pc.Token})
+}
+
+// finishTasks tells the agents the tasks sent to them are done, so they
+// stop serving the responses.
+func (c *Client) finishTasks(d *delegation, sent map[string]*Task) {
+	ctx, cancel := context.WithTimeout(context.Background(), cleanupTimeout)
+	defer cancel()
+	for target, t := range sent {
+		t.Done = true
+		if err := postSigned(ctx, target, d.secret, t); err != nil {
+			c.log.Debugf("finishing task %s at %s: %s", t.ID, target, err)
+		}
+	}
+}
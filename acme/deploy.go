@@ -0,0 +1,11 @@
+package acme
+
+import "context"
+
+// Deployer installs the certificate name from dir where the client does
+// not serve it itself, such as a CDN, a load balancer or another host.
+// ACM, SCP and Cloudflare are Deployers; call Deploy from a WithEventHook
+// hook on EventCertificateIssued to deploy every issuance.
+type Deployer interface {
+	Deploy(ctx context.Context, dir, name string) error
+}
@@ -0,0 +1,137 @@
+package acme
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Severity ranks how likely a Finding is to cause an issuance to fail.
+type Severity int
+
+const (
+	SeverityInfo Severity = iota
+	SeverityWarning
+	SeverityError
+)
+
+func (s Severity) String() string {
+	switch s {
+	case SeverityError:
+		return "error"
+	case SeverityWarning:
+		return "warning"
+	default:
+		return "info"
+	}
+}
+
+// Finding is a possible cause of a failed issuance found by Diagnose.
+type Finding struct {
+	Severity Severity
+	Cause    string
+	Detail   string
+}
+
+func (f Finding) String() string {
+	if f.Detail == "" {
+		return fmt.Sprintf("%s: %s", f.Severity, f.Cause)
+	}
+	return fmt.Sprintf("%s: %s (%s)", f.Severity, f.Cause, f.Detail)
+}
+
+// dialTimeout bounds each reachability check of Diagnose.
+const dialTimeout = 5 * time.Second
+
+// Diagnose looks for the common reasons an issuance for domain with the
+// challenge type chtype fails: the domain not resolving, or resolving
+// differently for public resolvers, its addresses being unreachable on
+// ports 80 and 443, CAA records forbidding the CA, and a CDN or proxy in
+// front of it. The findings are ranked, most likely cause first.
+func (c *Client) Diagnose(ctx context.Context, domain, chtype string) []Finding {
+	var findings []Finding
+	add := func(s Severity, cause, detail string) {
+		findings = append(findings, Finding{Severity: s, Cause: cause, Detail: detail})
+	}
+	name := strings.TrimPrefix(domain, "*.")
+	if err := checkDomain(domain); err != nil {
+		add(SeverityError, "invalid domain name", err.Error())
+		return findings
+	}
+	if strings.HasPrefix(domain, "*.") && chtype != ChallengeDNS && chtype != ChallengeDNSAccount {
+		add(SeverityError, "wildcard names can only be validated with dns-01", "")
+	}
+
+	local, err := net.DefaultResolver.LookupHost(ctx, name)
+	if err != nil {
+		sev := SeverityInfo
+		if chtype == ChallengeHTTP {
+			sev = SeverityError
+		}
+		add(sev, "domain does not resolve", err.Error())
+	}
+	public := publicAddrs(ctx, name)
+	if len(local) > 0 && len(public) > 0 && !sameDomains(local, public) {
+		add(SeverityWarning, "local and public resolvers disagree",
+			fmt.Sprintf("local %s, public %s", strings.Join(local, " "), strings.Join(public, " ")))
+	}
+
+	if chtype == ChallengeHTTP {
+		for _, addr := range local {
+			for _, port := range []string{"80", "443"} {
+				d := net.Dialer{Timeout: dialTimeout}
+				conn, err := d.DialContext(ctx, "tcp", net.JoinHostPort(addr, port))
+				if err != nil {
+					sev := SeverityWarning
+					if port == "80" {
+						sev = SeverityError
+					}
+					add(sev, fmt.Sprintf("%s is not reachable on port %s", addr, port), err.Error())
+					continue
+				}
+				conn.Close()
+			}
+		}
+		if cdn := DetectCDN(ctx, name); cdn != "" {
+			add(SeverityWarning, "domain is behind "+cdn, "http-01 may not reach this server; use dns-01")
+		}
+	}
+
+	if err := c.CheckCAA(ctx, domain); err != nil {
+		if _, ok := err.(*CAAError); ok {
+			add(SeverityError, "CAA records forbid issuance", err.Error())
+		} else {
+			add(SeverityInfo, "unable to check CAA records", err.Error())
+		}
+	}
+
+	sort.SliceStable(findings, func(i, j int) bool {
+		return findings[i].Severity > findings[j].Severity
+	})
+	return findings
+}
+
+// publicAddrs returns the A and AAAA records of name as seen by public
+// resolvers, ignoring errors.
+func publicAddrs(ctx context.Context, name string) []string {
+	var addrs []string
+	for _, qtype := range []int{typeA, typeAAAA} {
+		b, err := dnsQuery(ctx, qtype, name)
+		if err != nil {
+			continue
+		}
+		values, err := parseRecords(b)
+		if err != nil {
+			continue
+		}
+		for _, v := range values {
+			if ip := net.ParseIP(v); ip != nil {
+				addrs = append(addrs, ip.String())
+			}
+		}
+	}
+	return addrs
+}
@@ -0,0 +1,104 @@
+package acme
+
+import (
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/rsa"
+	"crypto/x509"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+)
+
+// DiffChains describes how the certificate chain next differs from prev:
+// added or removed names, a different key type, issuer or intermediate
+// chain, or a different validity period. It returns nil if nothing of note
+// changed.
+func DiffChains(prev, next []*x509.Certificate) []string {
+	if len(prev) == 0 || len(next) == 0 {
+		return nil
+	}
+	var changes []string
+	p, n := prev[0], next[0]
+	added, removed := diffNames(certNames(p), certNames(n))
+	if len(added) > 0 {
+		changes = append(changes, "added names "+strings.Join(added, ", "))
+	}
+	if len(removed) > 0 {
+		changes = append(changes, "removed names "+strings.Join(removed, ", "))
+	}
+	if a, b := keyDesc(p.PublicKey), keyDesc(n.PublicKey); a != b {
+		changes = append(changes, fmt.Sprintf("key type changed from %s to %s", a, b))
+	}
+	if a, b := p.Issuer.String(), n.Issuer.String(); a != b {
+		changes = append(changes, fmt.Sprintf("issuer changed from %q to %q", a, b))
+	}
+	if a, b := chainDesc(prev), chainDesc(next); a != b {
+		changes = append(changes, fmt.Sprintf("chain changed from %s to %s", a, b))
+	}
+	if a, b := validity(p), validity(n); a != b {
+		changes = append(changes, fmt.Sprintf("validity changed from %s to %s", a, b))
+	}
+	return changes
+}
+
+// certNames returns the sorted DNS names of a certificate.
+func certNames(c *x509.Certificate) []string {
+	names := append([]string(nil), c.DNSNames...)
+	if c.Subject.CommonName != "" {
+		names = append(names, c.Subject.CommonName)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// diffNames returns the names only in b and the names only in a.
+func diffNames(a, b []string) (added, removed []string) {
+	in := func(s []string, v string) bool {
+		i := sort.SearchStrings(s, v)
+		return i < len(s) && s[i] == v
+	}
+	for _, v := range b {
+		if !in(a, v) && !in(added, v) {
+			added = append(added, v)
+		}
+	}
+	for _, v := range a {
+		if !in(b, v) && !in(removed, v) {
+			removed = append(removed, v)
+		}
+	}
+	return added, removed
+}
+
+// keyDesc describes the type and size of a public key.
+func keyDesc(k interface{}) string {
+	switch k := k.(type) {
+	case *rsa.PublicKey:
+		return fmt.Sprintf("RSA-%d", k.N.BitLen())
+	case *ecdsa.PublicKey:
+		return "ECDSA-" + k.Curve.Params().Name
+	case ed25519.PublicKey:
+		return "Ed25519"
+	default:
+		return fmt.Sprintf("%T", k)
+	}
+}
+
+// chainDesc describes the intermediates of a chain by their common names.
+func chainDesc(chain []*x509.Certificate) string {
+	names := make([]string, 0, len(chain)-1)
+	for _, c := range chain[1:] {
+		names = append(names, c.Subject.CommonName)
+	}
+	if len(names) == 0 {
+		return "no intermediates"
+	}
+	return "[" + strings.Join(names, " > ") + "]"
+}
+
+// validity returns the validity period of a certificate in whole days.
+func validity(c *x509.Certificate) string {
+	return fmt.Sprintf("%d days", int(c.NotAfter.Sub(c.NotBefore).Round(24*time.Hour)/(24*time.Hour)))
+}
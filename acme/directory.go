@@ -0,0 +1,135 @@
+package acme
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/crypto/acme"
+)
+
+// minDirectoryTTL bounds how often the directory is fetched again.
+const minDirectoryTTL = time.Minute
+
+// WithDirectoryRefresh fetches the directory again once it is older than
+// interval, so long-running processes pick up new endpoints. A max-age
+// advertised by the CA takes precedence. By default the directory is only
+// fetched again after an endpoint disappears.
+func WithDirectoryRefresh(interval time.Duration) Option {
+	return func(c *Client) {
+		c.dirRefresh = interval
+	}
+}
+
+// dirCache tracks when the directory was fetched and for how long the CA
+// allows it to be cached.
+type dirCache struct {
+	mu      sync.Mutex
+	url     string
+	fetched time.Time
+	maxAge  time.Duration
+	stale   bool
+}
+
+// dirTransport records directory fetches in a dirCache.
+type dirTransport struct {
+	next  http.RoundTripper
+	cache *dirCache
+	clock Clock
+}
+
+// RoundTrip implements http.RoundTripper.
+func (t *dirTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	resp, err := t.next.RoundTrip(req)
+	if err != nil || req.Method != "GET" || resp.StatusCode != http.StatusOK || req.URL.String() != t.cache.url {
+		return resp, err
+	}
+	t.cache.mu.Lock()
+	defer t.cache.mu.Unlock()
+	t.cache.fetched = t.clock.Now()
+	t.cache.maxAge = maxAge(resp.Header.Get("Cache-Control"))
+	t.cache.stale = false
+	return resp, nil
+}
+
+// maxAge returns the max-age of a Cache-Control header, or zero if the
+// response must not be cached or the header has no max-age.
+func maxAge(cc string) time.Duration {
+	var age time.Duration
+	for _, d := range strings.Split(cc, ",") {
+		d = strings.ToLower(strings.TrimSpace(d))
+		switch {
+		case d == "no-cache" || d == "no-store":
+			return 0
+		case strings.HasPrefix(d, "max-age="):
+			if n, err := strconv.Atoi(d[len("max-age="):]); err == nil && n > 0 {
+				age = time.Duration(n) * time.Second
+			}
+		}
+	}
+	return age
+}
+
+// expired reports whether the directory should be fetched again at now.
+func (d *dirCache) expired(now time.Time, refresh time.Duration) bool {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if d.fetched.IsZero() {
+		return false
+	}
+	if d.stale {
+		return true
+	}
+	ttl := refresh
+	if d.maxAge > 0 {
+		ttl = d.maxAge
+	}
+	if ttl <= 0 {
+		return false
+	}
+	if ttl < minDirectoryTTL {
+		ttl = minDirectoryTTL
+	}
+	return now.Sub(d.fetched) > ttl
+}
+
+// ca returns the ACME client, replacing it with one that fetches the
+// directory again if the cached directory expired. The x/crypto client keeps
+// its directory for its whole lifetime.
+func (c *Client) ca() *acme.Client {
+	c.clientMu.RLock()
+	cl := c.client
+	c.clientMu.RUnlock()
+	if c.dircache == nil || !c.dircache.expired(c.clock.Now(), c.dirRefresh) {
+		return cl
+	}
+	c.clientMu.Lock()
+	defer c.clientMu.Unlock()
+	if c.client == cl {
+		c.log.Debugf("refreshing directory %s", c.dircache.url)
+		c.dircache.mu.Lock()
+		c.dircache.fetched = time.Time{}
+		c.dircache.mu.Unlock()
+		var kid acme.KeyID
+		if c.account != nil {
+			kid = acme.KeyID(c.account.URL)
+		}
+		c.client = withKey(cl, cl.Key, kid)
+	}
+	return c.client
+}
+
+// invalidateDirectory makes the next call to ca fetch the directory again if
+// err suggests an endpoint has moved.
+func (c *Client) invalidateDirectory(err error) {
+	var p *acme.Error
+	if c.dircache == nil || !errors.As(err, &p) || (p.StatusCode != http.StatusNotFound && p.StatusCode != http.StatusGone) {
+		return
+	}
+	c.dircache.mu.Lock()
+	c.dircache.stale = true
+	c.dircache.mu.Unlock()
+}
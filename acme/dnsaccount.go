@@ -0,0 +1,64 @@
+package acme
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/base32"
+	"strings"
+
+	"golang.org/x/crypto/acme"
+)
+
+// DNSAccountChallenge returns the dns-account-01 challenge of the
+// authorization.
+func DNSAccountChallenge(auth *acme.Authorization) (*acme.Challenge, error) {
+	for _, c := range auth.Challenges {
+		if c.Type == "dns-account-01" {
+			return c, nil
+		}
+	}
+	return nil, ErrNoChallenges
+}
+
+// DNSAccountRecord returns the name of the dns-account-01 TXT record for
+// domain and the account URL, _<label>._acme-challenge.<domain>. The label
+// is derived from the account, so several accounts can validate the same
+// domain at once without sharing a record.
+func DNSAccountRecord(accountURL, domain string) string {
+	sum := sha256.Sum256([]byte(accountURL))
+	label := strings.ToLower(base32.StdEncoding.EncodeToString(sum[:10]))
+	return "_" + label + "._acme-challenge." + domain
+}
+
+// SolveDNSAccount prints the dns-account-01 TXT record for the challenge,
+// waits until it is visible and asks the CA to validate it. The record value
+// is the same as for dns-01.
+func (c *Client) SolveDNSAccount(ctx context.Context, chal *acme.Challenge, domain string) error {
+	c.log.Debugf("attempting DNS account challenge on %s", domain)
+	accountURL, err := c.accountURL(ctx)
+	if err != nil {
+		return err
+	}
+	tok, err := c.ca().DNS01ChallengeRecord(chal.Token)
+	if err != nil {
+		return err
+	}
+	done, err := c.waitTXT(ctx, DNSAccountRecord(accountURL, domain), tok)
+	if err != nil {
+		return err
+	}
+	defer done()
+	return c.accept(ctx, chal)
+}
+
+// accountURL returns the URL of the account, fetching it if it is unknown.
+func (c *Client) accountURL(ctx context.Context) (string, error) {
+	if c.account != nil && c.account.URL != "" {
+		return c.account.URL, nil
+	}
+	a, err := c.RefreshAccount(ctx)
+	if err != nil {
+		return "", err
+	}
+	return a.URL, nil
+}
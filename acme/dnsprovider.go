@@ -0,0 +1,61 @@
+package acme
+
+import (
+	"context"
+	"fmt"
+	"time"
+)
+
+// cleanupTimeout bounds the removal of a challenge record or response, which
+// runs even if the issuance was canceled.
+const cleanupTimeout = time.Minute
+
+// DNSProvider publishes the TXT records of dns-01 and dns-account-01
+// challenges. Name is the full record name, e.g.
+// _acme-challenge.example.com, and value its value. Several values may be
+// present at the same name at once, so Present must add to the existing
+// values and Cleanup only remove value.
+type DNSProvider interface {
+	Present(ctx context.Context, name, value string) error
+	Cleanup(ctx context.Context, name, value string) error
+}
+
+// WithDNSProvider publishes DNS challenge records with p instead of asking
+// for them to be added by hand. If p has a method
+//
+//	Propagation() Propagation
+//
+// its result is used as the timing of the checks, unless WithPropagation
+// is set.
+func WithDNSProvider(p DNSProvider) Option {
+	return func(c *Client) {
+		c.dnsProvider = p
+	}
+}
+
+// present publishes the TXT record name with value, or asks for it to be
+// added without a DNSProvider, and returns a function removing it again.
+func (c *Client) present(ctx context.Context, name, value string) (func(), error) {
+	p := c.dnsProvider
+	if p == nil {
+		fmt.Printf("Please add DNS TXT parsing:  %s ----> %s\n", name, value)
+		return func() {}, nil
+	}
+	c.log.Debugf("adding TXT record %s", name)
+	err := protect("dns provider", func() error {
+		return p.Present(ctx, name, value)
+	})
+	if err != nil {
+		return nil, fmt.Errorf("adding TXT record %s: %w", name, err)
+	}
+	return func() {
+		ctx, cancel := context.WithTimeout(context.Background(), cleanupTimeout)
+		defer cancel()
+		err := protect("dns provider", func() error {
+			return p.Cleanup(ctx, name, value)
+		})
+		if err != nil {
+			c.log.Warnf("removing TXT record %s: %s", name, err)
+		}
+	}, nil
+}
@@ -0,0 +1,8 @@
+// Package acme obtains TLS certificates from an ACME CA such as Let's
+// Encrypt, using golang.org/x/crypto/acme.
+//
+// A Client is created with New, which loads or registers the account stored
+// in a directory. Create then authorizes the domain names with the http-01
+// or dns-01 challenge and writes <name>.key and <name>.crt to the same
+// directory, along with the parameters needed by Renew and RenewAll.
+package acme
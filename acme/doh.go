@@ -0,0 +1,122 @@
+package acme
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+)
+
+// Public DNS-over-HTTPS resolvers with a JSON API.
+const (
+	DoHGoogle     = "https://dns.google/resolve"
+	DoHCloudflare = "https://cloudflare-dns.com/dns-query"
+)
+
+// WithDoH checks challenge propagation with the JSON API of the provided
+// DNS-over-HTTPS resolvers instead of the dns_query service, for networks
+// where port 53 is blocked or intercepted. Without endpoints, DoHGoogle and
+// DoHCloudflare are used. Each endpoint must see the record.
+func WithDoH(endpoints ...string) Option {
+	return func(c *Client) {
+		if len(endpoints) == 0 {
+			endpoints = []string{DoHGoogle, DoHCloudflare}
+		}
+		c.doh = endpoints
+	}
+}
+
+// dohResponse is the JSON response of a DNS-over-HTTPS resolver.
+type dohResponse struct {
+	Status    int         `json:"Status"`
+	Answer    []dohRecord `json:"Answer"`
+	Authority []dohRecord `json:"Authority"`
+}
+
+type dohRecord struct {
+	Name string `json:"name"`
+	Type int    `json:"type"`
+	TTL  int    `json:"TTL"`
+	Data string `json:"data"`
+}
+
+// queryDoH looks up the records of type qtype at name with the resolver at
+// endpoint.
+func queryDoH(ctx context.Context, endpoint string, qtype int, name string) (*dohResponse, error) {
+	u := endpoint + "?" + url.Values{
+		"name": {name},
+		"type": {strconv.Itoa(qtype)},
+	}.Encode()
+	req, err := http.NewRequest("GET", u, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Accept", "application/dns-json")
+	resp, err := http.DefaultClient.Do(req.WithContext(ctx))
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	b, err := ioutil.ReadAll(io.LimitReader(resp.Body, 1<<16))
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("%s: unexpected status %s", endpoint, resp.Status)
+	}
+	r := &dohResponse{}
+	if err := json.Unmarshal(b, r); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+// txtData joins the quoted character strings of TXT record data.
+func txtData(data string) string {
+	var b strings.Builder
+	s := strings.TrimSpace(data)
+	for s != "" {
+		q, err := strconv.QuotedPrefix(s)
+		if err != nil {
+			// Not quoted, as some resolvers return it.
+			return b.String() + s
+		}
+		v, _ := strconv.Unquote(q)
+		b.WriteString(v)
+		s = strings.TrimSpace(s[len(q):])
+	}
+	return b.String()
+}
+
+// VerifyTXTDoH is VerifyTXT using the provided DNS-over-HTTPS resolvers,
+// which are reported by endpoint.
+func VerifyTXTDoH(ctx context.Context, endpoints []string, name string, want ...string) ([]TXTResult, error) {
+	results := make([]TXTResult, len(endpoints))
+	for i, endpoint := range endpoints {
+		results[i].Resolver = endpoint
+		r, err := queryDoH(ctx, endpoint, typeTXT, name)
+		if err != nil {
+			results[i].Error = err.Error()
+			continue
+		}
+		for _, rec := range r.Answer {
+			if rec.Type == typeTXT {
+				results[i].Values = append(results[i].Values, txtData(rec.Data))
+			}
+		}
+	}
+	return checkTXT(name, want, results)
+}
+
+// verifyTXT runs VerifyTXT or, with WithDoH, VerifyTXTDoH.
+func (c *Client) verifyTXT(ctx context.Context, name string, want ...string) ([]TXTResult, error) {
+	if len(c.doh) > 0 {
+		return VerifyTXTDoH(ctx, c.doh, name, want...)
+	}
+	return VerifyTXT(ctx, name, want...)
+}
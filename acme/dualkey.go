@@ -0,0 +1,108 @@
+package acme
+
+import (
+	"context"
+	"crypto/tls"
+	"strings"
+	"time"
+)
+
+// Suffixes of the names of companion certificates; see RenewalConfig.DualKey.
+const (
+	rsaSuffix   = ".rsa"
+	ecdsaSuffix = ".ecdsa"
+)
+
+// WithDualKey issues an RSA and an ECDSA certificate for every new
+// certificate; see RenewalConfig.DualKey.
+func WithDualKey() Option {
+	return func(c *Client) {
+		c.dualKey = true
+	}
+}
+
+// companionConfig returns the parameters of the companion certificate of
+// cfg: the same names with a key of the other algorithm, named <name>.rsa,
+// or <name>.ecdsa if the certificate itself uses an RSA key. Pins and
+// output paths only apply to the certificate itself.
+func companionConfig(cfg *RenewalConfig) *RenewalConfig {
+	comp := *cfg
+	comp.own = nil
+	comp.DualKey = false
+	comp.Pins = nil
+	comp.CertPath, comp.KeyPath = "", ""
+	if strings.HasPrefix(cfg.KeyType, "rsa") {
+		comp.Name = cfg.Name + ecdsaSuffix
+		comp.KeyType = KeyECDSAP256
+	} else {
+		comp.Name = cfg.Name + rsaSuffix
+		comp.KeyType = KeyRSA2048
+	}
+	return &comp
+}
+
+// finish records the issuance of cfg and, with DualKey, issues its
+// companion certificate. A failed companion leaves the certificate issued;
+// the failure is recorded under the companion's name and RenewAll issues
+// the companion on its own.
+func (c *Client) finish(ctx context.Context, dir string, cfg *RenewalConfig) error {
+	if err := cfg.issued(dir, c.clock.Now()); err != nil {
+		return err
+	}
+	if cfg.DualKey {
+		if err := c.obtainCompanion(ctx, dir, cfg); err != nil {
+			c.log.Warnf("unable to issue the companion of %s: %s", cfg.Name, err)
+		}
+	}
+	return nil
+}
+
+// renewCompanion issues the companion certificate of cfg without the
+// certificate itself.
+func (c *Client) renewCompanion(ctx context.Context, dir string, cfg *RenewalConfig) (err error) {
+	if err := c.writable(); err != nil {
+		return err
+	}
+	ctx, op := c.operation(ctx)
+	defer func() {
+		err = op.wrap(err)
+	}()
+	release, err := c.acquire(ctx)
+	if err != nil {
+		return err
+	}
+	defer release()
+	unlease, err := c.lease(dir, cfg.Name)
+	if err != nil {
+		return err
+	}
+	defer unlease()
+	ctx, cancel := c.withDeadline(ctx)
+	defer cancel()
+	return c.obtainCompanion(ctx, dir, cfg)
+}
+
+// obtainCompanion issues the companion certificate of cfg and records the
+// attempt under the companion's name.
+func (c *Client) obtainCompanion(ctx context.Context, dir string, cfg *RenewalConfig) (err error) {
+	comp := companionConfig(cfg)
+	c.log.Debugf("issuing %s key certificate %s", comp.KeyType, comp.Name)
+	defer func(start time.Time) {
+		c.record(dir, comp, start, err)
+	}(c.clock.Now())
+	if err := c.obtain(ctx, dir, comp); err != nil {
+		return c.retry(ctx, dir, comp, err)
+	}
+	return nil
+}
+
+// selectCertificate returns the first of certs supported by the client,
+// or the first one if the client supports none of them.
+func selectCertificate(hello *tls.ClientHelloInfo, certs []*tls.Certificate) *tls.Certificate {
+	for _, cert := range certs {
+		if hello.SupportsCertificate(cert) == nil {
+			return cert
+		}
+	}
+	return certs[0]
+}
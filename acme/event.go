@@ -0,0 +1,133 @@
+package acme
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// Event types emitted during the certificate lifecycle.
+const (
+	EventAccountRegistered     = "account.registered"
+	EventAccountKeyChanged     = "account.keychanged"
+	EventDomainAuthorized      = "domain.authorized"
+	EventAuthorizationFailed   = "domain.failed"
+	EventCertificateIssued     = "certificate.issued"
+	EventCertificateRenewed    = "certificate.renewed"
+	EventCertificateExpiring   = "certificate.expiring"
+	EventIssuanceFailed        = "certificate.failed"
+	EventCertificateChanged    = "certificate.changed"
+	EventRenewalDeferred       = "certificate.deferred"
+	EventCertificateRolledBack = "certificate.rolledback"
+	EventCertificateRevoked    = "certificate.revoked"
+)
+
+// webhookTimeout bounds each webhook delivery.
+const webhookTimeout = 10 * time.Second
+
+// Event describes something that happened while obtaining certificates.
+type Event struct {
+	Type    string    `json:"type"`
+	Time    time.Time `json:"time"`
+	Name    string    `json:"name,omitempty"`
+	Domains []string  `json:"domains,omitempty"`
+	Error   string    `json:"error,omitempty"`
+	// Changes lists the differences from the previous certificate for
+	// EventCertificateChanged.
+	Changes []string `json:"changes,omitempty"`
+}
+
+// WithEventHook calls fn for every lifecycle event. fn is called
+// synchronously and should return quickly.
+func WithEventHook(fn func(Event)) Option {
+	return func(c *Client) {
+		c.hooks = append(c.hooks, fn)
+	}
+}
+
+// WithWebhook posts every lifecycle event as JSON to url. If secret is set,
+// the body is signed with HMAC-SHA256 like delegation requests, see
+// ParseEvent. Deliveries run in the background and failures are only
+// logged.
+func WithWebhook(url string, secret []byte) Option {
+	return func(c *Client) {
+		c.hooks = append(c.hooks, func(e Event) {
+			go c.deliver(url, secret, e)
+		})
+	}
+}
+
+// ParseEvent verifies the signature of an event posted by WithWebhook and
+// decodes it. The signature is in the X-Letsencrypt-Signature header, an
+// HMAC-SHA256 of the timestamp in X-Letsencrypt-Timestamp, a dot and the
+// body.
+func ParseEvent(r *http.Request, secret []byte) (*Event, error) {
+	e := &Event{}
+	if err := readSigned(r, secret, e); err != nil {
+		return nil, err
+	}
+	return e, nil
+}
+
+// emit sends an event to all hooks.
+func (c *Client) emit(typ, name string, domains []string, err error) {
+	e := Event{
+		Type:    typ,
+		Name:    name,
+		Domains: domains,
+	}
+	if err != nil {
+		e.Error = err.Error()
+	}
+	c.emitEvent(e)
+}
+
+// emitEvent sends a prepared event to all hooks.
+func (c *Client) emitEvent(e Event) {
+	if len(c.hooks) == 0 {
+		return
+	}
+	e.Time = c.clock.Now()
+	for _, fn := range c.hooks {
+		err := protect("event hook", func() error {
+			fn(e)
+			return nil
+		})
+		if err != nil {
+			c.log.Errorf("%s\n%s", err, err.(*PanicError).Stack)
+		}
+	}
+}
+
+// deliver posts a single event to a webhook, signed with secret if set.
+func (c *Client) deliver(url string, secret []byte, e Event) {
+	b, err := json.Marshal(e)
+	if err != nil {
+		return
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), webhookTimeout)
+	defer cancel()
+	req, err := http.NewRequest("POST", url, bytes.NewReader(b))
+	if err != nil {
+		c.log.Warnf("webhook %s: %s", url, err)
+		return
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if len(secret) > 0 {
+		ts := strconv.FormatInt(c.clock.Now().Unix(), 10)
+		req.Header.Set(timestampHeader, ts)
+		req.Header.Set(signatureHeader, sign(secret, ts, b))
+	}
+	resp, err := http.DefaultClient.Do(req.WithContext(ctx))
+	if err != nil {
+		c.log.Warnf("webhook %s: %s", url, err)
+		return
+	}
+	resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		c.log.Warnf("webhook %s: unexpected status %s", url, resp.Status)
+	}
+}
@@ -0,0 +1,39 @@
+package acme
+
+import (
+	"time"
+)
+
+// Freeze is a period during which certificates are only renewed if they
+// would otherwise expire before it ends, e.g. a change freeze around a
+// product launch.
+type Freeze struct {
+	Start  time.Time
+	End    time.Time
+	Reason string
+}
+
+// frozen returns the freeze in effect at now, if any.
+func (o *RenewOptions) frozen(now time.Time) *Freeze {
+	for i := range o.Freezes {
+		f := &o.Freezes[i]
+		if !now.Before(f.Start) && now.Before(f.End) {
+			return f
+		}
+	}
+	return nil
+}
+
+// deferred reports whether renewing the certificate name in dir is put off
+// by a freeze at now: it is if the certificate outlives the freeze.
+func (o *RenewOptions) deferred(dir, name string, now time.Time) (*Freeze, bool) {
+	f := o.frozen(now)
+	if f == nil || o.Force {
+		return nil, false
+	}
+	chain, err := loadChain(dir, name)
+	if err != nil {
+		return f, false
+	}
+	return f, chain[0].NotAfter.After(f.End)
+}
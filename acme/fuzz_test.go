@@ -0,0 +1,152 @@
+package acme
+
+import (
+	"bytes"
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"io/ioutil"
+	"net/http"
+	"testing"
+	"time"
+
+	"golang.org/x/crypto/acme"
+)
+
+// The fuzz targets in this file replay their seed corpus in testdata/fuzz
+// with go test; run one with e.g.
+//
+//	go test -fuzz FuzzOrder ./acme
+
+// fuzzDirectory is served whenever the fuzzed document is not the directory.
+var fuzzDirectory = []byte(`{
+	"newNonce": "https://ca.test/new-nonce",
+	"newAccount": "https://ca.test/new-account",
+	"newOrder": "https://ca.test/new-order",
+	"revokeCert": "https://ca.test/revoke-cert",
+	"keyChange": "https://ca.test/key-change"
+}`)
+
+// fuzzKey signs requests made by the fuzzed client.
+var fuzzKey, _ = ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+
+// fuzzTransport answers every request from memory. Requests for the target
+// path are answered with the fuzzed body and status.
+type fuzzTransport struct {
+	target string
+	status int
+	body   []byte
+}
+
+// RoundTrip implements http.RoundTripper.
+func (t *fuzzTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	status, body := http.StatusOK, fuzzDirectory
+	switch req.URL.Path {
+	case t.target:
+		status, body = t.status, t.body
+	case "/new-nonce":
+		body = nil
+	}
+	h := make(http.Header)
+	h.Set("Replay-Nonce", "nonce")
+	h.Set("Content-Type", "application/json")
+	return &http.Response{
+		StatusCode: status,
+		Header:     h,
+		Body:       ioutil.NopCloser(bytes.NewReader(body)),
+		Request:    req,
+	}, nil
+}
+
+// fuzzClient returns an ACME client whose responses come from t.
+func fuzzClient(t *fuzzTransport) *acme.Client {
+	return &acme.Client{
+		Key:          fuzzKey,
+		KID:          "https://ca.test/account/1",
+		DirectoryURL: "https://ca.test/directory",
+		HTTPClient:   &http.Client{Transport: t},
+		RetryBackoff: func(int, *http.Request, *http.Response) time.Duration {
+			return 0
+		},
+	}
+}
+
+// FuzzDirectory fuzzes parsing of the directory document.
+func FuzzDirectory(f *testing.F) {
+	f.Fuzz(func(t *testing.T, data []byte) {
+		c := fuzzClient(&fuzzTransport{target: "/directory", status: http.StatusOK, body: data})
+		c.Discover(context.Background())
+	})
+}
+
+// FuzzOrder fuzzes parsing of order objects.
+func FuzzOrder(f *testing.F) {
+	f.Fuzz(func(t *testing.T, data []byte) {
+		c := fuzzClient(&fuzzTransport{target: "/order/1", status: http.StatusOK, body: data})
+		o, err := c.GetOrder(context.Background(), "https://ca.test/order/1")
+		if err != nil {
+			return
+		}
+		strict := &Client{client: c, strict: true}
+		strict.checkOrder(o)
+	})
+}
+
+// FuzzAuthorization fuzzes parsing of authorization objects and challenge
+// selection.
+func FuzzAuthorization(f *testing.F) {
+	f.Fuzz(func(t *testing.T, data []byte) {
+		c := fuzzClient(&fuzzTransport{target: "/authz/1", status: http.StatusOK, body: data})
+		a, err := c.GetAuthorization(context.Background(), "https://ca.test/authz/1")
+		if err != nil {
+			return
+		}
+		HTTPChallenge(a)
+		DNSChallenge(a)
+		strict := &Client{client: c, strict: true}
+		strict.checkAuthorization(a)
+	})
+}
+
+// FuzzProblem fuzzes parsing of problem documents returned with errors.
+func FuzzProblem(f *testing.F) {
+	f.Fuzz(func(t *testing.T, data []byte) {
+		c := fuzzClient(&fuzzTransport{target: "/order/1", status: http.StatusBadRequest, body: data})
+		if _, err := c.GetOrder(context.Background(), "https://ca.test/order/1"); err == nil {
+			t.Fatal("GetOrder succeeded on a 400 response")
+		}
+	})
+}
+
+// FuzzTxtResponse fuzzes parsing of the DNS lookup API responses.
+func FuzzTxtResponse(f *testing.F) {
+	f.Fuzz(func(t *testing.T, data []byte) {
+		parseTxtResponse(data)
+	})
+}
+
+// FuzzKey fuzzes parsing of PEM encoded RSA and ECDSA certificate keys; a
+// key that parses must survive being written and read back.
+func FuzzKey(f *testing.F) {
+	f.Fuzz(func(t *testing.T, data []byte) {
+		k, err := parseCertKey(data)
+		if err != nil {
+			return
+		}
+		b, err := encodeCertKey(k)
+		if err != nil {
+			t.Fatalf("encoding parsed key: %v", err)
+		}
+		if _, err := parseCertKey(b); err != nil {
+			t.Fatalf("parsing encoded key: %v", err)
+		}
+	})
+}
+
+// FuzzChain fuzzes parsing of PEM encoded certificate chains.
+func FuzzChain(f *testing.F) {
+	f.Fuzz(func(t *testing.T, data []byte) {
+		parseChain(data)
+	})
+}
@@ -0,0 +1,250 @@
+package acme
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"hash/fnv"
+	"io/ioutil"
+	"os"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// groupsFile stores the group assignment of a directory.
+const groupsFile = "groups.json"
+
+// groupsVersion is the current version of the groups file format.
+const groupsVersion = 1
+
+// Groups maps the name of a shared SAN certificate to its domain names.
+type Groups map[string][]string
+
+// Strategy picks the group of a domain name. current is the group the name
+// was assigned to before, or empty for a new name, and groups holds the
+// assignment made so far. Returning current keeps the assignment stable.
+type Strategy func(domain, current string, groups Groups) string
+
+// Move records a domain name changing groups. From is empty for new names
+// and To is empty for removed ones.
+type Move struct {
+	Domain string
+	From   string
+	To     string
+}
+
+// PerCert fills groups named group-1, group-2, ... with up to n domain names
+// each. Assigned names never move, and new names fill the first group with
+// room left.
+func PerCert(n int) Strategy {
+	if n < 1 {
+		n = MaxSANs
+	}
+	return func(domain, current string, groups Groups) string {
+		if current != "" {
+			return current
+		}
+		return firstFree("group", 1, n, groups)
+	}
+}
+
+// ByCustomer groups the domain names of each customer, as returned by
+// customer, in certificates named after the customer. Customers with more
+// than n names get more certificates, named customer-2, customer-3, ... A
+// name is moved only when its customer changes.
+func ByCustomer(customer func(domain string) string, n int) Strategy {
+	if n < 1 {
+		n = MaxSANs
+	}
+	return func(domain, current string, groups Groups) string {
+		g := customer(domain)
+		if current != "" && inGroup(current, g) {
+			return current
+		}
+		if len(groups[g]) < n {
+			return g
+		}
+		return firstFree(g, 2, n, groups)
+	}
+}
+
+// ByShard spreads domain names over n groups named shard-0 to shard-<n-1> by
+// a hash of the name. The assignment only depends on the name, so it is
+// stable, but a shard is not guaranteed to stay below MaxSANs.
+func ByShard(n int) Strategy {
+	if n < 1 {
+		n = 1
+	}
+	return func(domain, current string, groups Groups) string {
+		h := fnv.New32a()
+		h.Write([]byte(domain))
+		return fmt.Sprintf("shard-%d", h.Sum32()%uint32(n))
+	}
+}
+
+// firstFree returns the first of prefix-<start>, prefix-<start+1>, ... with
+// room for another domain name.
+func firstFree(prefix string, start, n int, groups Groups) string {
+	for i := start; ; i++ {
+		g := fmt.Sprintf("%s-%d", prefix, i)
+		if len(groups[g]) < n {
+			return g
+		}
+	}
+}
+
+// inGroup reports whether the group g is prefix or one of the groups
+// firstFree numbers after it.
+func inGroup(g, prefix string) bool {
+	if g == prefix {
+		return true
+	}
+	if !strings.HasPrefix(g, prefix+"-") {
+		return false
+	}
+	_, err := strconv.Atoi(g[len(prefix)+1:])
+	return err == nil
+}
+
+// Assign assigns the domain names to groups with s, starting from the
+// previous assignment prev so that names only move when s says so. Names
+// missing from domains are dropped. The moves are returned along with the
+// new assignment.
+func Assign(prev Groups, domains []string, s Strategy) (Groups, []Move) {
+	current := make(map[string]string)
+	for g, ds := range prev {
+		for _, d := range ds {
+			current[d] = g
+		}
+	}
+	d := append([]string(nil), domains...)
+	sort.Strings(d)
+	// Place the names that already have a group first, so that new names
+	// see how full each group is.
+	sort.SliceStable(d, func(i, j int) bool {
+		return current[d[i]] != "" && current[d[j]] == ""
+	})
+	next := make(Groups)
+	var moves []Move
+	seen := make(map[string]bool)
+	for _, domain := range d {
+		if seen[domain] {
+			continue
+		}
+		seen[domain] = true
+		g := s(domain, current[domain], next)
+		next[g] = append(next[g], domain)
+		if g != current[domain] {
+			moves = append(moves, Move{Domain: domain, From: current[domain], To: g})
+		}
+	}
+	for domain, g := range current {
+		if !seen[domain] {
+			moves = append(moves, Move{Domain: domain, From: g})
+		}
+	}
+	for _, ds := range next {
+		sort.Strings(ds)
+	}
+	sort.Slice(moves, func(i, j int) bool {
+		return moves[i].Domain < moves[j].Domain
+	})
+	return next, moves
+}
+
+// Changed returns the groups whose domain names differ between prev and
+// next, including groups that were emptied. These need a new certificate.
+func Changed(prev, next Groups) []string {
+	var changed []string
+	for g, ds := range next {
+		if !sameDomains(prev[g], ds) {
+			changed = append(changed, g)
+		}
+	}
+	for g := range prev {
+		if _, ok := next[g]; !ok {
+			changed = append(changed, g)
+		}
+	}
+	sort.Strings(changed)
+	return changed
+}
+
+// sameDomains reports whether a and b hold the same domain names.
+func sameDomains(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	set := make(map[string]bool, len(a))
+	for _, d := range a {
+		set[d] = true
+	}
+	for _, d := range b {
+		if !set[d] {
+			return false
+		}
+	}
+	return true
+}
+
+// LoadGroups reads the group assignment stored in dir. A missing file is an
+// empty assignment.
+func LoadGroups(dir string) (Groups, error) {
+	b, err := ioutil.ReadFile(path.Join(dir, groupsFile))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return make(Groups), nil
+		}
+		return nil, err
+	}
+	var f struct {
+		Version int    `json:"version"`
+		Groups  Groups `json:"groups"`
+	}
+	if err := json.Unmarshal(b, &f); err != nil {
+		return nil, err
+	}
+	if f.Version > groupsVersion {
+		return nil, fmt.Errorf("groups file version %d is not supported", f.Version)
+	}
+	if f.Groups == nil {
+		f.Groups = make(Groups)
+	}
+	return f.Groups, nil
+}
+
+// Save writes the group assignment to dir.
+func (g Groups) Save(dir string) error {
+	b, err := json.MarshalIndent(struct {
+		Version int    `json:"version"`
+		Groups  Groups `json:"groups"`
+	}{groupsVersion, g}, "", "  ")
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(path.Join(dir, groupsFile), b, 0644)
+}
+
+// CreateGroups creates a certificate for each of the named groups, or for
+// every group if no names are provided. Empty groups are skipped.
+func (c *Client) CreateGroups(ctx context.Context, dir, chtype string, groups Groups, names ...string) error {
+	if len(names) == 0 {
+		for g := range groups {
+			names = append(names, g)
+		}
+		sort.Strings(names)
+	}
+	var reqs []Request
+	for _, g := range names {
+		if len(groups[g]) == 0 {
+			continue
+		}
+		reqs = append(reqs, Request{Dir: dir, Name: g, Chtype: chtype, Domains: groups[g]})
+	}
+	if len(reqs) == 0 {
+		return nil
+	}
+	return c.CreateBatch(ctx, reqs, len(reqs), nil)
+}
@@ -0,0 +1,133 @@
+package acme
+
+import (
+	"context"
+	"net/http"
+	"strings"
+	"sync"
+)
+
+// challengePrefix is the path below which http-01 responses are served.
+const challengePrefix = "/.well-known/acme-challenge/"
+
+// tokens holds the http-01 responses of the challenges being solved.
+type tokens struct {
+	mu sync.RWMutex
+	m  map[string]string
+}
+
+// put makes a response available for its token.
+func (t *tokens) put(token, response string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.m == nil {
+		t.m = make(map[string]string)
+	}
+	t.m[token] = response
+}
+
+// remove forgets a token once its challenge is done.
+func (t *tokens) remove(token string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	delete(t.m, token)
+}
+
+// get returns the response for a token.
+func (t *tokens) get(token string) (string, bool) {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+	r, ok := t.m[token]
+	return r, ok
+}
+
+// HTTPSolver publishes the responses of http-01 challenges, such as the
+// Solver of package http01. Present is called before the challenge is
+// validated and Cleanup once it is done.
+type HTTPSolver interface {
+	Present(ctx context.Context, token, response string) error
+	Cleanup(ctx context.Context, token, response string) error
+}
+
+// WithHTTPSolver publishes http-01 challenge responses with s, in addition
+// to HTTPHandler and the webroot path given to SolveHTTP.
+func WithHTTPSolver(s HTTPSolver) Option {
+	return func(c *Client) {
+		c.httpSolver = s
+	}
+}
+
+// presentHTTP publishes the response of token with the HTTPSolver, if any,
+// and returns a function removing it again.
+func (c *Client) presentHTTP(ctx context.Context, token, response string) (func(), error) {
+	s := c.httpSolver
+	if s == nil {
+		return func() {}, nil
+	}
+	err := protect("http solver", func() error {
+		return s.Present(ctx, token, response)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return func() {
+		ctx, cancel := context.WithTimeout(context.Background(), cleanupTimeout)
+		defer cancel()
+		err := protect("http solver", func() error {
+			return s.Cleanup(ctx, token, response)
+		})
+		if err != nil {
+			c.log.Warnf("removing http-01 response %s: %s", token, err)
+		}
+	}, nil
+}
+
+// HTTPHandler serves http-01 challenge responses for challenges solved by
+// this client and passes every other request to fallback, so the challenge
+// can be answered by an application's existing http.Server on port 80:
+//
+//	http.ListenAndServe(":80", c.HTTPHandler(mux))
+//
+// If fallback is nil, other requests are redirected to HTTPS.
+func (c *Client) HTTPHandler(fallback http.Handler) http.Handler {
+	if fallback == nil {
+		fallback = http.HandlerFunc(redirectHTTPS)
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !strings.HasPrefix(r.URL.Path, challengePrefix) {
+			fallback.ServeHTTP(w, r)
+			return
+		}
+		response, ok := c.ChallengeResponse(r.URL.Path)
+		if !ok {
+			http.NotFound(w, r)
+			return
+		}
+		w.Header().Set("Content-Type", "text/plain")
+		w.Write([]byte(response))
+	})
+}
+
+// ChallengeResponse returns the http-01 response for a request path such as
+// /.well-known/acme-challenge/<token>, if the client is solving that
+// challenge. It lets frameworks that do not use http.Handler, such as Fiber,
+// answer challenges; see the README for middleware examples.
+func (c *Client) ChallengeResponse(path string) (string, bool) {
+	if !strings.HasPrefix(path, challengePrefix) {
+		return "", false
+	}
+	return c.tokens.get(strings.TrimPrefix(path, challengePrefix))
+}
+
+// redirectHTTPS redirects GET and HEAD requests to the same URL over HTTPS.
+func redirectHTTPS(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "GET" && r.Method != "HEAD" {
+		http.Error(w, "Use HTTPS", http.StatusBadRequest)
+		return
+	}
+	host := r.Host
+	if i := strings.LastIndex(host, ":"); i > strings.LastIndex(host, "]") {
+		host = host[:i]
+	}
+	http.Redirect(w, r, "https://"+host+r.URL.RequestURI(), http.StatusFound)
+}
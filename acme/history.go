@@ -0,0 +1,138 @@
+package acme
+
+import (
+	"bufio"
+	"encoding/json"
+	"os"
+	"path"
+	"sync"
+	"time"
+)
+
+// historyFile is the append-only issuance log kept in each directory.
+const historyFile = "history.jsonl"
+
+// historyMu serializes appends to history files.
+var historyMu sync.Mutex
+
+// HistoryEntry records a single issuance attempt.
+type HistoryEntry struct {
+	Name     string        `json:"name"`
+	Domains  []string      `json:"domains"`
+	Chtype   string        `json:"chtype"`
+	Time     time.Time     `json:"time"`
+	Duration time.Duration `json:"duration"`
+	Error    string        `json:"error,omitempty"`
+}
+
+// DomainStats aggregates the history of a single domain name.
+type DomainStats struct {
+	Attempts    int
+	Successes   int
+	Failures    int
+	Duration    time.Duration
+	LastSuccess time.Time
+	LastFailure time.Time
+	LastError   string
+}
+
+// Average returns the mean duration of the attempts.
+func (s *DomainStats) Average() time.Duration {
+	if s.Attempts == 0 {
+		return 0
+	}
+	return s.Duration / time.Duration(s.Attempts)
+}
+
+// record appends an issuance attempt to the history in dir and emits the
+// matching event. Failing to record is logged but does not fail the issuance.
+func (c *Client) record(dir string, cfg *RenewalConfig, start time.Time, err error) {
+	e := HistoryEntry{
+		Name:     cfg.Name,
+		Domains:  cfg.Domains,
+		Chtype:   cfg.Chtype,
+		Time:     start,
+		Duration: c.clock.Now().Sub(start),
+	}
+	if err != nil {
+		e.Error = err.Error()
+	}
+	if err := appendHistory(dir, &e); err != nil {
+		c.log.Warnf("unable to record history: %s", err)
+	}
+	if err != nil {
+		c.emit(EventIssuanceFailed, cfg.Name, cfg.Domains, err)
+	} else {
+		c.emit(EventCertificateIssued, cfg.Name, cfg.Domains, nil)
+	}
+}
+
+// appendHistory writes e as one line to the history file in dir.
+func appendHistory(dir string, e *HistoryEntry) error {
+	b, err := json.Marshal(e)
+	if err != nil {
+		return err
+	}
+	historyMu.Lock()
+	defer historyMu.Unlock()
+	f, err := os.OpenFile(path.Join(dir, historyFile), os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0644)
+	if err != nil {
+		return err
+	}
+	if _, err := f.Write(append(b, '\n')); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// History returns all issuance attempts recorded in dir, oldest first.
+func History(dir string) ([]HistoryEntry, error) {
+	f, err := os.Open(path.Join(dir, historyFile))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	defer f.Close()
+	var entries []HistoryEntry
+	s := bufio.NewScanner(f)
+	for s.Scan() {
+		var e HistoryEntry
+		if err := json.Unmarshal(s.Bytes(), &e); err != nil {
+			return nil, err
+		}
+		entries = append(entries, e)
+	}
+	return entries, s.Err()
+}
+
+// Stats aggregates the history in dir per domain name.
+func Stats(dir string) (map[string]*DomainStats, error) {
+	entries, err := History(dir)
+	if err != nil {
+		return nil, err
+	}
+	stats := make(map[string]*DomainStats)
+	for _, e := range entries {
+		for _, d := range e.Domains {
+			s, ok := stats[d]
+			if !ok {
+				s = &DomainStats{}
+				stats[d] = s
+			}
+			s.Attempts++
+			s.Duration += e.Duration
+			if e.Error == "" {
+				s.Successes++
+				s.LastSuccess = e.Time
+			} else {
+				s.Failures++
+				s.LastFailure = e.Time
+				s.LastError = e.Error
+			}
+		}
+	}
+	return stats, nil
+}
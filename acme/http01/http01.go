@@ -0,0 +1,119 @@
+// Package http01 serves the responses of http-01 challenges, either on a
+// listener of its own that is only open while challenges are pending, or
+// through a handler mounted into an existing server. A Solver is passed to
+// acme.WithHTTPSolver, which registers each token when its authorization
+// is solved and removes it once it is done.
+package http01
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+)
+
+// Prefix is the path below which challenge responses are served.
+const Prefix = "/.well-known/acme-challenge/"
+
+// Solver serves http-01 challenge responses. The zero value serves them
+// through ServeHTTP or Handler only.
+type Solver struct {
+	// Addr, if set, is the address, e.g. ":80", the solver listens on
+	// while challenges are pending.
+	Addr string
+	// Listener, if set, is used instead of Addr, e.g. a socket passed by
+	// systemd. It is served from the first Present on and never closed,
+	// as the solver could not open it again.
+	Listener net.Listener
+
+	// srvMu serializes starting and stopping the server, so Present does
+	// not listen on Addr again before Cleanup has closed it.
+	srvMu  sync.Mutex
+	mu     sync.Mutex
+	tokens map[string]string
+	srv    *http.Server
+	l      net.Listener
+}
+
+// Present makes the response of token available, starting the listener
+// on Addr or serving Listener if it is the first pending challenge.
+func (s *Solver) Present(ctx context.Context, token, response string) error {
+	s.srvMu.Lock()
+	defer s.srvMu.Unlock()
+	if s.srv == nil && (s.Listener != nil || s.Addr != "") {
+		l := s.Listener
+		if l == nil {
+			var err error
+			if l, err = net.Listen("tcp", s.Addr); err != nil {
+				return err
+			}
+		}
+		s.srv, s.l = &http.Server{Handler: s}, l
+		go s.srv.Serve(l)
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.tokens == nil {
+		s.tokens = make(map[string]string)
+	}
+	s.tokens[token] = response
+	return nil
+}
+
+// Cleanup removes the response of token, stopping the listener on Addr
+// once no challenge is pending.
+func (s *Solver) Cleanup(ctx context.Context, token, response string) error {
+	s.srvMu.Lock()
+	defer s.srvMu.Unlock()
+	s.mu.Lock()
+	delete(s.tokens, token)
+	pending := len(s.tokens) > 0
+	s.mu.Unlock()
+	if pending || s.srv == nil || s.Listener != nil {
+		return nil
+	}
+	// Requests in flight take mu to look up their response, so the server
+	// is shut down holding only srvMu. Shutdown does not close the listener
+	// if Serve has not started yet, so it is closed here before the next
+	// Present can listen on Addr again.
+	err := s.srv.Shutdown(ctx)
+	s.l.Close()
+	s.srv, s.l = nil, nil
+	return err
+}
+
+// Response returns the response of the pending challenge token.
+func (s *Solver) Response(token string) (string, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	r, ok := s.tokens[token]
+	return r, ok
+}
+
+// ServeHTTP answers challenge requests and responds 404 to any other.
+func (s *Solver) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if !strings.HasPrefix(r.URL.Path, Prefix) {
+		http.NotFound(w, r)
+		return
+	}
+	response, ok := s.Response(strings.TrimPrefix(r.URL.Path, Prefix))
+	if !ok {
+		http.NotFound(w, r)
+		return
+	}
+	w.Header().Set("Content-Type", "text/plain")
+	w.Write([]byte(response))
+}
+
+// Handler answers challenge requests and passes every other request to
+// fallback, to be mounted in place of an existing server's handler.
+func (s *Solver) Handler(fallback http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if strings.HasPrefix(r.URL.Path, Prefix) {
+			s.ServeHTTP(w, r)
+			return
+		}
+		fallback.ServeHTTP(w, r)
+	})
+}
@@ -0,0 +1,119 @@
+package http01
+
+import (
+	"context"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestSolverListener(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	addr := l.Addr().String()
+	l.Close()
+	s := &Solver{Addr: addr}
+	ctx := context.Background()
+	if err := s.Present(ctx, "token", "response"); err != nil {
+		t.Fatal(err)
+	}
+	resp, err := http.Get("http://" + addr + Prefix + "token")
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, _ := ioutil.ReadAll(resp.Body)
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK || string(b) != "response" {
+		t.Fatalf("GET = %d %q, want 200 %q", resp.StatusCode, b, "response")
+	}
+	if err := s.Cleanup(ctx, "token", "response"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := http.Get("http://" + addr + Prefix + "token"); err == nil {
+		t.Fatal("listener still open after Cleanup")
+	}
+}
+
+func TestSolverRestart(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	addr := l.Addr().String()
+	l.Close()
+	s := &Solver{Addr: addr}
+	ctx := context.Background()
+	for i := 0; i < 20; i++ {
+		if err := s.Present(ctx, "token", "response"); err != nil {
+			t.Fatalf("Present %d: %v", i, err)
+		}
+		if err := s.Cleanup(ctx, "token", "response"); err != nil {
+			t.Fatalf("Cleanup %d: %v", i, err)
+		}
+	}
+}
+
+func TestSolverProvidedListener(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+	s := &Solver{Listener: l}
+	ctx := context.Background()
+	for _, token := range []string{"first", "second"} {
+		if err := s.Present(ctx, token, "response"); err != nil {
+			t.Fatal(err)
+		}
+		resp, err := http.Get("http://" + l.Addr().String() + Prefix + token)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusOK {
+			t.Fatalf("GET %s = %d, want 200", token, resp.StatusCode)
+		}
+		// The listener stays open across Cleanup, as it cannot be
+		// opened again.
+		if err := s.Cleanup(ctx, token, "response"); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestSolverHandler(t *testing.T) {
+	s := &Solver{}
+	fallback := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusTeapot)
+	})
+	srv := httptest.NewServer(s.Handler(fallback))
+	defer srv.Close()
+	ctx := context.Background()
+	s.Present(ctx, "token", "response")
+	tests := []struct {
+		path   string
+		status int
+	}{
+		{Prefix + "token", http.StatusOK},
+		{Prefix + "other", http.StatusNotFound},
+		{"/", http.StatusTeapot},
+	}
+	for _, tt := range tests {
+		resp, err := http.Get(srv.URL + tt.path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		if resp.StatusCode != tt.status {
+			t.Errorf("GET %s = %d, want %d", tt.path, resp.StatusCode, tt.status)
+		}
+	}
+	s.Cleanup(ctx, "token", "response")
+	if _, ok := s.Response("token"); ok {
+		t.Fatal("response kept after Cleanup")
+	}
+}
@@ -0,0 +1,103 @@
+package acme
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"unicode"
+
+	"golang.org/x/net/idna"
+	"golang.org/x/net/publicsuffix"
+)
+
+var (
+	ErrInvalidDomain     = errors.New("invalid domain name")
+	ErrWildcardPosition  = errors.New("wildcard must be the whole leftmost label")
+	ErrWildcardCharacter = errors.New("wildcard uses a character other than *")
+	ErrWildcardSuffix    = errors.New("wildcard directly below a public suffix")
+)
+
+// idnaProfile converts domain names to their ASCII form the way CAs
+// validate them.
+var idnaProfile = idna.New(
+	idna.MapForLookup(),
+	idna.BidiRule(),
+	idna.ValidateLabels(true),
+	idna.StrictDomainName(true),
+)
+
+// wildcardLookalikes are characters that resemble an asterisk and are
+// rejected instead of silently mapped.
+var wildcardLookalikes = []rune{'∗', '⁎', '✱', '＊', '﹡', '٭'}
+
+// NormalizeDomain returns domain in the form a CA expects: lower case,
+// international labels in punycode, and at most one wildcard as the whole
+// leftmost label, e.g. "*.bücher.example" becomes "*.xn--bcher-kva.example".
+// Forms the CA would reject, such as "*.*.example.com", "a*.example.com",
+// "*.co.uk" or look-alike asterisks, fail with a specific error.
+func NormalizeDomain(domain string) (string, error) {
+	for _, r := range wildcardLookalikes {
+		if strings.ContainsRune(domain, r) {
+			return "", fmt.Errorf("%w: %q", ErrWildcardCharacter, domain)
+		}
+	}
+	name, wildcard := strings.TrimPrefix(domain, "*."), strings.HasPrefix(domain, "*.")
+	if strings.Contains(name, "*") {
+		return "", fmt.Errorf("%w: %q", ErrWildcardPosition, domain)
+	}
+	ascii, err := idnaProfile.ToASCII(strings.TrimSuffix(name, "."))
+	if err != nil {
+		return "", fmt.Errorf("%w: %q: %v", ErrInvalidDomain, domain, err)
+	}
+	ascii = strings.ToLower(ascii)
+	if err := checkDomain(ascii); err != nil {
+		return "", fmt.Errorf("%w: %q", ErrInvalidDomain, domain)
+	}
+	if wildcard {
+		if suffix, _ := publicsuffix.PublicSuffix(ascii); suffix == ascii {
+			return "", fmt.Errorf("%w: %q", ErrWildcardSuffix, domain)
+		}
+	}
+	labels := strings.Split(ascii, ".")
+	if len(labels) < 2 || allDigits(labels[len(labels)-1]) {
+		return "", fmt.Errorf("%w: %q", ErrInvalidDomain, domain)
+	}
+	if wildcard {
+		return "*." + ascii, nil
+	}
+	return ascii, nil
+}
+
+// normalize converts the domain names of the certificate with
+// NormalizeDomain.
+func (r *RenewalConfig) normalize() error {
+	d, err := normalizeDomains(r.Domains)
+	if err != nil {
+		return err
+	}
+	r.Domains = d
+	return nil
+}
+
+// normalizeDomains normalizes all domains, returning the first error.
+func normalizeDomains(domains []string) ([]string, error) {
+	out := make([]string, len(domains))
+	for i, d := range domains {
+		n, err := NormalizeDomain(d)
+		if err != nil {
+			return nil, err
+		}
+		out[i] = n
+	}
+	return out, nil
+}
+
+// allDigits reports whether s consists of digits only.
+func allDigits(s string) bool {
+	for _, r := range s {
+		if !unicode.IsDigit(r) {
+			return false
+		}
+	}
+	return s != ""
+}
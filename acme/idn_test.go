@@ -0,0 +1,51 @@
+package acme
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestNormalizeDomain(t *testing.T) {
+	tests := []struct {
+		domain string
+		want   string
+		err    error
+	}{
+		{"Example.COM", "example.com", nil},
+		{"EXAMPLE.com.", "example.com", nil},
+		{"ＥＸＡＭＰＬＥ．ｃｏｍ", "example.com", nil},
+		{"ｅｘａｍｐｌｅ.com", "example.com", nil},
+		{"Bücher.Example", "xn--bcher-kva.example", nil},
+		{"xn--bcher-kva.example", "xn--bcher-kva.example", nil},
+		// ß is a deviation character; CAs use the non-transitional
+		// mapping, which keeps it instead of mapping it to ss.
+		{"straße.de", "xn--strae-oqa.de", nil},
+		{"*.Bücher.example", "*.xn--bcher-kva.example", nil},
+		{"*.example.com", "*.example.com", nil},
+		{"*.*.example.com", "", ErrWildcardPosition},
+		{"a*.example.com", "", ErrWildcardPosition},
+		{"＊.example.com", "", ErrWildcardCharacter},
+		{"*.co.uk", "", ErrWildcardSuffix},
+		{"-a.example.com", "", ErrInvalidDomain},
+		{"a-.example.com", "", ErrInvalidDomain},
+		{"ab--c.example", "", ErrInvalidDomain},
+		{"xn--zz.example", "", ErrInvalidDomain},
+		{"a_b.example.com", "", ErrInvalidDomain},
+		{"a b.example", "", ErrInvalidDomain},
+		{"a..example.com", "", ErrInvalidDomain},
+		{"example", "", ErrInvalidDomain},
+		{"1.2.3.4", "", ErrInvalidDomain},
+	}
+	for _, tt := range tests {
+		got, err := NormalizeDomain(tt.domain)
+		if tt.err != nil {
+			if !errors.Is(err, tt.err) {
+				t.Errorf("NormalizeDomain(%q) error = %v, want %v", tt.domain, err, tt.err)
+			}
+			continue
+		}
+		if err != nil || got != tt.want {
+			t.Errorf("NormalizeDomain(%q) = %q, %v, want %q", tt.domain, got, err, tt.want)
+		}
+	}
+}
@@ -0,0 +1,59 @@
+// Command genroots downloads the certificates at acme.CertificateURLs into
+// the roots directory of package acme, which embeds them, so the ISRG roots
+// and intermediates are known without calling UpdateRoots. It is run by
+// go generate in package acme whenever CertificateURLs changes.
+package main
+
+import (
+	"crypto/x509"
+	"encoding/pem"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+	"time"
+
+	"github.com/fireflyst/letsencrypt/acme"
+)
+
+func main() {
+	dir := "roots"
+	if len(os.Args) > 1 {
+		dir = os.Args[1]
+	}
+	client := &http.Client{Timeout: 30 * time.Second}
+	for _, u := range acme.CertificateURLs {
+		cert, err := fetch(client, u)
+		if err != nil {
+			log.Fatalf("%s: %s", u, err)
+		}
+		b := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: cert.Raw})
+		if err := os.WriteFile(filepath.Join(dir, path.Base(u)), b, 0644); err != nil {
+			log.Fatal(err)
+		}
+		log.Printf("%s: %s, expires %s", path.Base(u), cert.Subject.CommonName, cert.NotAfter.Format(time.DateOnly))
+	}
+}
+
+// fetch downloads a single PEM or DER encoded certificate.
+func fetch(client *http.Client, url string) (*x509.Certificate, error) {
+	resp, err := client.Get(url)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("unexpected status %s", resp.Status)
+	}
+	b, err := io.ReadAll(io.LimitReader(resp.Body, 1<<16))
+	if err != nil {
+		return nil, err
+	}
+	if block, _ := pem.Decode(b); block != nil {
+		b = block.Bytes
+	}
+	return x509.ParseCertificate(b)
+}
@@ -0,0 +1,127 @@
+package acme
+
+import (
+	"encoding/csv"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Item describes a managed certificate for CMDBs and compliance scanners.
+type Item struct {
+	Name         string            `json:"name"`
+	Domains      []string          `json:"domains"`
+	Serial       string            `json:"serial,omitempty"`
+	Issuer       string            `json:"issuer,omitempty"`
+	KeyAlgorithm string            `json:"keyAlgorithm,omitempty"`
+	NotBefore    time.Time         `json:"notBefore"`
+	NotAfter     time.Time         `json:"notAfter"`
+	Labels       map[string]string `json:"labels,omitempty"`
+	// Targets are the files the certificate is deployed to: the
+	// certificate in dir, its live link and its CertPath copy.
+	Targets []string `json:"targets"`
+	// Error is set if the certificate could not be read.
+	Error string `json:"error,omitempty"`
+}
+
+// Inventory returns every certificate in dir, by name. Domains are the SANs
+// of the issued certificate, or the configured names if it cannot be read.
+// The result can be encoded as JSON or passed to WriteInventoryCSV.
+func Inventory(dir string) ([]Item, error) {
+	names, err := Certificates(dir)
+	if err != nil {
+		return nil, err
+	}
+	defaults, err := LoadDefaults(dir)
+	if err != nil {
+		return nil, err
+	}
+	sort.Strings(names)
+	items := make([]Item, 0, len(names))
+	for _, name := range names {
+		item := Item{Name: name, Targets: []string{path.Join(dir, name+".crt")}}
+		cfg, err := LoadRenewalConfig(dir, name)
+		if err == nil {
+			cfg = defaults.inherit(cfg)
+			item.Domains = cfg.Domains
+			item.Labels = cfg.Labels
+		}
+		live := path.Join(liveDir(dir, name), "fullchain.pem")
+		if _, err := os.Lstat(live); err == nil {
+			item.Targets = append(item.Targets, live)
+		}
+		chain, err := loadChain(dir, name)
+		if err != nil {
+			item.Error = err.Error()
+			items = append(items, item)
+			continue
+		}
+		leaf := chain[0]
+		item.Domains = nil
+		for _, d := range certNames(leaf) {
+			if n := len(item.Domains); n == 0 || item.Domains[n-1] != d {
+				item.Domains = append(item.Domains, d)
+			}
+		}
+		item.Serial = fmt.Sprintf("%x", leaf.SerialNumber)
+		item.Issuer = leaf.Issuer.String()
+		item.KeyAlgorithm = keyDesc(leaf.PublicKey)
+		item.NotBefore = leaf.NotBefore
+		item.NotAfter = leaf.NotAfter
+		if cfg != nil && cfg.CertPath != "" {
+			if p, err := outputPath(dir, cfg.CertPath, newOutput(cfg, leaf)); err == nil {
+				item.Targets = append(item.Targets, p)
+			}
+		}
+		items = append(items, item)
+	}
+	return items, nil
+}
+
+// inventoryHeader is the header row written by WriteInventoryCSV.
+var inventoryHeader = []string{
+	"name", "domains", "serial", "issuer", "key_algorithm",
+	"not_before", "not_after", "labels", "targets", "error",
+}
+
+// WriteInventoryCSV writes the inventory as CSV with a header row. Lists
+// are separated by spaces and labels are written as key=value.
+func WriteInventoryCSV(w io.Writer, items []Item) error {
+	cw := csv.NewWriter(w)
+	if err := cw.Write(inventoryHeader); err != nil {
+		return err
+	}
+	for _, item := range items {
+		labels := make([]string, 0, len(item.Labels))
+		for k, v := range item.Labels {
+			labels = append(labels, k+"="+v)
+		}
+		sort.Strings(labels)
+		var notBefore, notAfter string
+		if item.Error == "" {
+			notBefore = item.NotBefore.UTC().Format(time.RFC3339)
+			notAfter = item.NotAfter.UTC().Format(time.RFC3339)
+		}
+		err := cw.Write([]string{
+			item.Name,
+			strings.Join(item.Domains, " "),
+			item.Serial,
+			item.Issuer,
+			item.KeyAlgorithm,
+			notBefore,
+			notAfter,
+			strings.Join(labels, " "),
+			strings.Join(item.Targets, " "),
+			item.Error,
+		})
+		if err != nil {
+			return err
+		}
+	}
+	cw.Flush()
+	return cw.Error()
+}
@@ -1,53 +1,189 @@
 package acme
 
 import (
-	"crypto/rand"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
 	"crypto/rsa"
 	"crypto/x509"
 	"encoding/pem"
+	"fmt"
+	"io"
 	"io/ioutil"
-	"path"
 	"os"
+	"path"
 
 	"errors"
 )
 
-const keyType = "RSA PRIVATE KEY"
+// PEM block types of private keys.
+const (
+	rsaKeyType = "RSA PRIVATE KEY"
+	ecKeyType  = "EC PRIVATE KEY"
+)
 
-var ErrInvalidKey = errors.New("invalid key")
+// Key types of certificate keys, as accepted by the CA.
+const (
+	KeyRSA2048   = "rsa2048"
+	KeyRSA3072   = "rsa3072"
+	KeyRSA4096   = "rsa4096"
+	KeyECDSAP256 = "ecdsa-p256"
+	KeyECDSAP384 = "ecdsa-p384"
+)
+
+// DefaultKeyType is the key type of certificates that do not set one.
+const DefaultKeyType = KeyECDSAP256
+
+var (
+	ErrInvalidKey         = errors.New("invalid key")
+	ErrUnsupportedKeyType = errors.New("unsupported key type")
+)
 
 // loadKey attempts to load a private key from the specified file.
-func loadKey(dir,filename string) (*rsa.PrivateKey, error) {
+func loadKey(dir, filename string) (*rsa.PrivateKey, error) {
 	b, err := ioutil.ReadFile(path.Join(dir, filename))
 	if err != nil {
 		return nil, err
 	}
+	return parseKey(b)
+}
+
+// parseKey decodes a PEM encoded private key.
+func parseKey(b []byte) (*rsa.PrivateKey, error) {
 	block, _ := pem.Decode(b)
-	if block == nil || block.Type != keyType {
+	if block == nil || block.Type != rsaKeyType {
 		return nil, ErrInvalidKey
 	}
 	return x509.ParsePKCS1PrivateKey(block.Bytes)
 }
 
-// generateKey creates a new 2048-bit RSA key and writes it to the specified
-// file.
-func generateKey(dir,filename string) (*rsa.PrivateKey, error) {
-	if _, err := os.Stat(dir); err != nil {
-		err = os.Mkdir(dir,644)
-		if err != nil {
-			return nil, err
+// WithKeyType sets the key type of new certificates, one of the Key
+// constants; see RenewalConfig.KeyType.
+func WithKeyType(t string) Option {
+	return func(c *Client) {
+		c.keyType = t
+	}
+}
+
+// checkKeyType returns ErrUnsupportedKeyType unless t is empty or one of the
+// key types the CA accepts.
+func checkKeyType(t string) error {
+	switch t {
+	case "", KeyRSA2048, KeyRSA3072, KeyRSA4096, KeyECDSAP256, KeyECDSAP384:
+		return nil
+	}
+	return fmt.Errorf("%w %q", ErrUnsupportedKeyType, t)
+}
+
+// keyTypeOf returns the key type of a public key, or an empty string if it
+// is not one the CA accepts.
+func keyTypeOf(pub crypto.PublicKey) string {
+	switch k := pub.(type) {
+	case *rsa.PublicKey:
+		switch k.N.BitLen() {
+		case 2048:
+			return KeyRSA2048
+		case 3072:
+			return KeyRSA3072
+		case 4096:
+			return KeyRSA4096
+		}
+	case *ecdsa.PublicKey:
+		switch k.Curve {
+		case elliptic.P256():
+			return KeyECDSAP256
+		case elliptic.P384():
+			return KeyECDSAP384
 		}
 	}
-	k, err := rsa.GenerateKey(rand.Reader, 2048)
+	return ""
+}
+
+// loadCertKey attempts to load a certificate private key, RSA or ECDSA, from
+// the specified file.
+func loadCertKey(dir, filename string) (crypto.Signer, error) {
+	b, err := ioutil.ReadFile(path.Join(dir, filename))
 	if err != nil {
 		return nil, err
 	}
-	b := pem.EncodeToMemory(&pem.Block{
-		Type:  keyType,
+	return parseCertKey(b)
+}
+
+// parseCertKey decodes a PEM encoded RSA or ECDSA private key.
+func parseCertKey(b []byte) (crypto.Signer, error) {
+	block, _ := pem.Decode(b)
+	if block == nil {
+		return nil, ErrInvalidKey
+	}
+	switch block.Type {
+	case rsaKeyType:
+		return x509.ParsePKCS1PrivateKey(block.Bytes)
+	case ecKeyType:
+		return x509.ParseECPrivateKey(block.Bytes)
+	}
+	return nil, ErrInvalidKey
+}
+
+// newKey creates a new key of type t, DefaultKeyType if empty, from the
+// provided entropy source.
+func newKey(random io.Reader, t string) (crypto.Signer, error) {
+	if t == "" {
+		t = DefaultKeyType
+	}
+	switch t {
+	case KeyRSA2048:
+		return rsa.GenerateKey(random, 2048)
+	case KeyRSA3072:
+		return rsa.GenerateKey(random, 3072)
+	case KeyRSA4096:
+		return rsa.GenerateKey(random, 4096)
+	case KeyECDSAP256:
+		return ecdsa.GenerateKey(elliptic.P256(), random)
+	case KeyECDSAP384:
+		return ecdsa.GenerateKey(elliptic.P384(), random)
+	}
+	return nil, checkKeyType(t)
+}
+
+// writeCertKey writes the certificate key k to filename in dir.
+func writeCertKey(dir, filename string, k crypto.Signer) error {
+	if err := ensureDir(dir); err != nil {
+		return err
+	}
+	b, err := encodeCertKey(k)
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(path.Join(dir, filename), b, 0600)
+}
+
+// encodeCertKey PEM encodes an RSA or ECDSA private key.
+func encodeCertKey(k crypto.Signer) ([]byte, error) {
+	switch k := k.(type) {
+	case *rsa.PrivateKey:
+		return encodeKey(k), nil
+	case *ecdsa.PrivateKey:
+		b, err := x509.MarshalECPrivateKey(k)
+		if err != nil {
+			return nil, err
+		}
+		return pem.EncodeToMemory(&pem.Block{Type: ecKeyType, Bytes: b}), nil
+	}
+	return nil, ErrInvalidKey
+}
+
+// encodeKey PEM encodes a private key.
+func encodeKey(k *rsa.PrivateKey) []byte {
+	return pem.EncodeToMemory(&pem.Block{
+		Type:  rsaKeyType,
 		Bytes: x509.MarshalPKCS1PrivateKey(k),
 	})
-	if err := ioutil.WriteFile(path.Join(dir, filename), b, 0600); err != nil {
-		return nil, err
+}
+
+// ensureDir creates dir if it does not exist yet.
+func ensureDir(dir string) error {
+	if _, err := os.Stat(dir); err != nil {
+		return os.MkdirAll(dir, 0755)
 	}
-	return k, nil
-}
\ No newline at end of file
+	return nil
+}
@@ -0,0 +1,169 @@
+package acme
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path"
+	"time"
+)
+
+// DefaultLeaseTTL is how long a lease is held when neither WithLease nor
+// WithDeadline set a duration.
+const DefaultLeaseTTL = time.Hour
+
+var ErrLeaseHeld = errors.New("certificate is being issued by another owner")
+
+// lease is the content of a <name>.lease file. Token identifies a single
+// acquisition, so two issuances of the same owner do not share a lease.
+type lease struct {
+	Owner   string    `json:"owner"`
+	Token   string    `json:"token,omitempty"`
+	Expires time.Time `json:"expires"`
+}
+
+// WithLease makes the client take a lease on a certificate before issuing
+// it, so that several processes renewing the same directory, e.g. replicas
+// sharing a network filesystem, do not place duplicate orders. owner
+// identifies this process and defaults to the host name and process id. A
+// lease expires after ttl, which defaults to twice the WithDeadline duration
+// or DefaultLeaseTTL. Issuances that find a live lease fail with
+// ErrLeaseHeld; RenewAll reports them as skipped.
+func WithLease(owner string, ttl time.Duration) Option {
+	return func(c *Client) {
+		if owner == "" {
+			host, _ := os.Hostname()
+			owner = fmt.Sprintf("%s:%d", host, os.Getpid())
+		}
+		c.leaseOwner = owner
+		c.leaseTTL = ttl
+	}
+}
+
+// leasePath returns the location of the lease file for name.
+func leasePath(dir, name string) string {
+	return path.Join(dir, name+".lease")
+}
+
+// lease takes the lease on the certificate name in dir if WithLease is set.
+// The returned function gives it up. A live lease is never taken over, even
+// from the same owner; an expired one is moved aside atomically first, so
+// that of two processes finding the same expired lease only one takes it.
+func (c *Client) lease(dir, name string) (func(), error) {
+	if c.leaseOwner == "" {
+		return func() {}, nil
+	}
+	ttl := c.leaseTTL
+	if ttl <= 0 {
+		ttl = 2 * c.deadline
+	}
+	if ttl <= 0 {
+		ttl = DefaultLeaseTTL
+	}
+	p := leasePath(dir, name)
+	token := make([]byte, 8)
+	if _, err := io.ReadFull(rand.Reader, token); err != nil {
+		return nil, err
+	}
+	l := &lease{Owner: c.leaseOwner, Token: hex.EncodeToString(token), Expires: c.clock.Now().Add(ttl)}
+	b, err := json.Marshal(l)
+	if err != nil {
+		return nil, err
+	}
+	for i := 0; ; i++ {
+		f, err := os.OpenFile(p, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0644)
+		if err == nil {
+			_, err = f.Write(b)
+			if cerr := f.Close(); err == nil {
+				err = cerr
+			}
+			if err != nil {
+				os.Remove(p)
+				return nil, err
+			}
+			return func() { c.unlease(p, l.Token) }, nil
+		}
+		if !os.IsExist(err) {
+			return nil, err
+		}
+		if i > 0 {
+			return nil, ErrLeaseHeld
+		}
+		fi, err := os.Stat(p)
+		if os.IsNotExist(err) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		held, err := readLease(p)
+		if err != nil && !os.IsNotExist(err) {
+			return nil, err
+		}
+		if held != nil && c.clock.Now().Before(held.Expires) {
+			return nil, ErrLeaseHeld
+		}
+		if held != nil {
+			c.log.Debugf("taking over lease on %s from %s", name, held.Owner)
+		}
+		if err := c.removeStale(p, l.Token, fi); err != nil {
+			return nil, err
+		}
+	}
+}
+
+// removeStale removes the expired lease file at p, which was fi when it was
+// read. It is renamed aside first and put back if another process replaced
+// it in the meantime.
+func (c *Client) removeStale(p, token string, fi os.FileInfo) error {
+	aside := p + "." + token
+	if err := os.Rename(p, aside); err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return err
+	}
+	moved, err := os.Stat(aside)
+	if err != nil {
+		return err
+	}
+	if os.SameFile(fi, moved) {
+		return os.Remove(aside)
+	}
+	// A live lease was created after the expired one was read.
+	if err := os.Link(aside, p); err != nil && !os.IsExist(err) {
+		return err
+	}
+	os.Remove(aside)
+	return ErrLeaseHeld
+}
+
+// unlease removes the lease file at p if it is still the lease with token.
+func (c *Client) unlease(p, token string) {
+	held, err := readLease(p)
+	if err != nil || held.Token != token {
+		return
+	}
+	if err := os.Remove(p); err != nil {
+		c.log.Warnf("unable to release lease: %s", err)
+	}
+}
+
+// readLease reads the lease file at p. A file that cannot be decoded, e.g.
+// because its owner crashed while writing it, is treated as expired.
+func readLease(p string) (*lease, error) {
+	b, err := ioutil.ReadFile(p)
+	if err != nil {
+		return nil, err
+	}
+	l := &lease{}
+	if err := json.Unmarshal(b, l); err != nil {
+		return &lease{}, nil
+	}
+	return l, nil
+}
@@ -0,0 +1,241 @@
+package acme
+
+import (
+	"context"
+	"crypto/x509"
+	"embed"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path"
+
+	"golang.org/x/crypto/acme"
+)
+
+// Let's Encrypt directories.
+const (
+	// ProductionURL is the directory of the Let's Encrypt production
+	// environment, used when no directory is configured.
+	ProductionURL = acme.LetsEncryptURL
+	// StagingURL is the directory of the Let's Encrypt staging environment,
+	// which has much higher rate limits than production.
+	StagingURL = "https://acme-staging-v02.api.letsencrypt.org/directory"
+)
+
+// CertificateURLs are where UpdateRoots downloads the current Let's Encrypt
+// roots and intermediates from. The certificates at these URLs are also
+// embedded in the package; run go generate after changing them.
+var CertificateURLs = []string{
+	"https://letsencrypt.org/certs/isrgrootx1.pem",
+	"https://letsencrypt.org/certs/isrg-root-x2.pem",
+	"https://letsencrypt.org/certs/2024/r10.pem",
+	"https://letsencrypt.org/certs/2024/r11.pem",
+	"https://letsencrypt.org/certs/2024/e5.pem",
+	"https://letsencrypt.org/certs/2024/e6.pem",
+}
+
+// rootsFile stores the certificates downloaded by UpdateRoots.
+const rootsFile = "letsencrypt-certs.pem"
+
+// embeddedRoots holds the roots and intermediates at CertificateURLs.
+//
+//go:generate go run ./internal/genroots roots
+//go:embed roots/*.pem
+var embeddedRoots embed.FS
+
+var ErrNotLetsEncrypt = errors.New("certificate does not chain to a Let's Encrypt root")
+
+// LetsEncryptRoots returns the ISRG root certificates: those shipped with
+// this package, plus any newer roots stored in dir by UpdateRoots. dir may
+// be empty.
+func LetsEncryptRoots(dir string) ([]*x509.Certificate, error) {
+	roots, _, err := letsEncryptCerts(dir)
+	return roots, err
+}
+
+// letsEncryptCerts returns the embedded roots and intermediates and those
+// stored in dir.
+func letsEncryptCerts(dir string) (roots, intermediates []*x509.Certificate, err error) {
+	entries, err := embeddedRoots.ReadDir("roots")
+	if err != nil {
+		return nil, nil, err
+	}
+	var certs []*x509.Certificate
+	for _, e := range entries {
+		b, err := embeddedRoots.ReadFile("roots/" + e.Name())
+		if err != nil {
+			return nil, nil, err
+		}
+		chain, err := parseChain(b)
+		if err != nil {
+			return nil, nil, err
+		}
+		certs = append(certs, chain...)
+	}
+	if dir != "" {
+		b, err := ioutil.ReadFile(path.Join(dir, rootsFile))
+		if err != nil && !os.IsNotExist(err) {
+			return nil, nil, err
+		}
+		if err == nil {
+			stored, err := parseChain(b)
+			if err != nil {
+				return nil, nil, err
+			}
+			certs = append(certs, stored...)
+		}
+	}
+	seen := make(map[string]bool)
+	for _, cert := range certs {
+		if seen[string(cert.Raw)] {
+			continue
+		}
+		seen[string(cert.Raw)] = true
+		if isSelfSigned(cert) {
+			roots = append(roots, cert)
+		} else {
+			intermediates = append(intermediates, cert)
+		}
+	}
+	return roots, intermediates, nil
+}
+
+// isSelfSigned reports whether cert is a root certificate.
+func isSelfSigned(cert *x509.Certificate) bool {
+	return cert.CheckSignatureFrom(cert) == nil
+}
+
+// VerifyLetsEncrypt verifies that the chain, leaf first, is valid for
+// dnsName and issued under a Let's Encrypt root, independent of the trust
+// store of the system. It returns the verified chain including the root.
+func VerifyLetsEncrypt(dir string, chain []*x509.Certificate, dnsName string) ([]*x509.Certificate, error) {
+	if len(chain) == 0 {
+		return nil, ErrNoCertificate
+	}
+	roots, intermediates, err := letsEncryptCerts(dir)
+	if err != nil {
+		return nil, err
+	}
+	opts := x509.VerifyOptions{
+		DNSName:       dnsName,
+		Roots:         x509.NewCertPool(),
+		Intermediates: x509.NewCertPool(),
+	}
+	for _, r := range roots {
+		opts.Roots.AddCert(r)
+	}
+	for _, c := range append(intermediates, chain[1:]...) {
+		opts.Intermediates.AddCert(c)
+	}
+	verified, err := chain[0].Verify(opts)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrNotLetsEncrypt, err)
+	}
+	return verified[0], nil
+}
+
+// FullChainWithRoot returns the certificate name in dir followed by the
+// root it chains to, PEM encoded, for clients that need the root in the
+// bundle.
+func FullChainWithRoot(dir, name string) ([]byte, error) {
+	chain, err := loadChain(dir, name)
+	if err != nil {
+		return nil, err
+	}
+	verified, err := VerifyLetsEncrypt(dir, chain, "")
+	if err != nil {
+		return nil, err
+	}
+	var b []byte
+	for _, c := range append(chain, verified[len(verified)-1]) {
+		b = append(b, pem.EncodeToMemory(&pem.Block{Type: certType, Bytes: c.Raw})...)
+	}
+	return b, nil
+}
+
+// RootsHandler serves the Let's Encrypt roots and intermediates known for
+// dir as a PEM bundle.
+func RootsHandler(dir string) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		roots, intermediates, err := letsEncryptCerts(dir)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", "application/x-pem-file")
+		for _, c := range append(roots, intermediates...) {
+			pem.Encode(w, &pem.Block{Type: certType, Bytes: c.Raw})
+		}
+	})
+}
+
+// UpdateRoots downloads the certificates at CertificateURLs and stores them
+// in dir for LetsEncryptRoots, VerifyLetsEncrypt and RootsHandler. Every
+// certificate must chain to a root shipped with this package, so a new
+// root is only accepted with a cross-signature from a known one.
+func UpdateRoots(ctx context.Context, dir string) error {
+	roots, _, err := letsEncryptCerts("")
+	if err != nil {
+		return err
+	}
+	var certs []*x509.Certificate
+	for _, u := range CertificateURLs {
+		c, err := fetchCert(ctx, u)
+		if err != nil {
+			return fmt.Errorf("%s: %w", u, err)
+		}
+		certs = append(certs, c)
+	}
+	pool := x509.NewCertPool()
+	for _, r := range roots {
+		pool.AddCert(r)
+	}
+	inter := x509.NewCertPool()
+	for _, c := range certs {
+		inter.AddCert(c)
+	}
+	var b []byte
+	for _, c := range certs {
+		_, err := c.Verify(x509.VerifyOptions{
+			Roots:         pool,
+			Intermediates: inter,
+			KeyUsages:     []x509.ExtKeyUsage{x509.ExtKeyUsageAny},
+		})
+		if err != nil {
+			return fmt.Errorf("%s: %w", c.Subject.CommonName, err)
+		}
+		b = append(b, pem.EncodeToMemory(&pem.Block{Type: certType, Bytes: c.Raw})...)
+	}
+	if err := ensureDir(dir); err != nil {
+		return err
+	}
+	return ioutil.WriteFile(path.Join(dir, rootsFile), b, 0644)
+}
+
+// fetchCert downloads a single PEM or DER encoded certificate.
+func fetchCert(ctx context.Context, url string) (*x509.Certificate, error) {
+	req, err := http.NewRequest("GET", url, nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := http.DefaultClient.Do(req.WithContext(ctx))
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("unexpected status %s", resp.Status)
+	}
+	b, err := ioutil.ReadAll(io.LimitReader(resp.Body, 1<<16))
+	if err != nil {
+		return nil, err
+	}
+	if block, _ := pem.Decode(b); block != nil {
+		b = block.Bytes
+	}
+	return x509.ParseCertificate(b)
+}
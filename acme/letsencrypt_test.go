@@ -0,0 +1,29 @@
+package acme
+
+import (
+	"crypto/x509"
+	"testing"
+)
+
+func TestEmbeddedCerts(t *testing.T) {
+	roots, intermediates, err := letsEncryptCerts("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(roots) == 0 {
+		t.Fatal("no embedded roots")
+	}
+	pool := x509.NewCertPool()
+	for _, r := range roots {
+		pool.AddCert(r)
+	}
+	for _, c := range intermediates {
+		_, err := c.Verify(x509.VerifyOptions{
+			Roots:     pool,
+			KeyUsages: []x509.ExtKeyUsage{x509.ExtKeyUsageAny},
+		})
+		if err != nil {
+			t.Errorf("%s: %v", c.Subject.CommonName, err)
+		}
+	}
+}
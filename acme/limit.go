@@ -0,0 +1,79 @@
+package acme
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// WithMaxConcurrentOrders caps the number of issuances the client runs at
+// once, across Create, CreateBatch and renewals.
+func WithMaxConcurrentOrders(n int) Option {
+	return func(c *Client) {
+		if n > 0 {
+			c.orders = make(chan struct{}, n)
+		}
+	}
+}
+
+// WithOrderRate spaces the start of issuances at least interval apart, to
+// stay below the CA's rate limits when many certificates are renewed.
+func WithOrderRate(interval time.Duration) Option {
+	return func(c *Client) {
+		c.limiter = &limiter{interval: interval}
+	}
+}
+
+// limiter hands out start times at least interval apart.
+type limiter struct {
+	mu       sync.Mutex
+	interval time.Duration
+	next     time.Time
+}
+
+// wait blocks until the next start time or until the context is done.
+func (l *limiter) wait(ctx context.Context, clk Clock) error {
+	l.mu.Lock()
+	now := clk.Now()
+	at := l.next
+	if at.Before(now) {
+		at = now
+	}
+	l.next = at.Add(l.interval)
+	l.mu.Unlock()
+	select {
+	case <-clk.After(at.Sub(now)):
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// acquire reserves an issuance slot. The returned function releases it.
+func (c *Client) acquire(ctx context.Context) (func(), error) {
+	unreserve, err := c.reserveQuota(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if c.orders != nil {
+		select {
+		case c.orders <- struct{}{}:
+		case <-ctx.Done():
+			unreserve()
+			return nil, ctx.Err()
+		}
+	}
+	release := func() {
+		if c.orders != nil {
+			<-c.orders
+		}
+		unreserve()
+	}
+	if c.limiter != nil {
+		if err := c.limiter.wait(ctx, c.clock); err != nil {
+			release()
+			return nil, err
+		}
+	}
+	return release, nil
+}
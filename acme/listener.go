@@ -0,0 +1,310 @@
+package acme
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"path"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/crypto/acme"
+)
+
+// renewCheckInterval is how often NewListener checks for due renewals.
+const renewCheckInterval = 12 * time.Hour
+
+var ErrNoServerName = errors.New("no certificate for server name")
+
+// SNIMatching configures how NewListener and TLSConfig choose the
+// certificate for a handshake. The zero value serves a certificate for the
+// names it was issued for and, one label deep, for the names its wildcards
+// cover, and serves the first certificate to clients that send no server
+// name.
+type SNIMatching struct {
+	// ExactOnly serves a certificate only for the names it was issued for,
+	// so wildcard certificates match no server name.
+	ExactOnly bool
+	// NoDefault fails handshakes without a server name instead of serving
+	// the first certificate.
+	NoDefault bool
+	// Unmatched serves the first certificate for server names no
+	// certificate covers instead of failing the handshake, e.g. for
+	// clients connecting by IP address.
+	Unmatched bool
+}
+
+// WithSNIMatching sets the rules by which listeners choose a certificate
+// for the server name of a handshake.
+func WithSNIMatching(m SNIMatching) Option {
+	return func(c *Client) {
+		c.sniMatching = m
+	}
+}
+
+// certStore holds the certificates served by a listener. Certificates are
+// keyed by name, each with its companion certificates of other key types,
+// and indexed by the DNS names they cover.
+type certStore struct {
+	match  SNIMatching
+	mu     sync.RWMutex
+	certs  map[string][]*tls.Certificate
+	byHost map[string][]*tls.Certificate
+	first  string
+}
+
+// load reads the certificate name from dir, replacing any previous version.
+func (s *certStore) load(dir, name string) error {
+	certs, err := LoadCertificates(dir, name)
+	if err != nil {
+		return err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.certs == nil {
+		s.certs = make(map[string][]*tls.Certificate)
+	}
+	if s.first == "" {
+		s.first = name
+	}
+	s.certs[name] = certs
+	s.byHost = make(map[string][]*tls.Certificate)
+	for _, c := range s.certs {
+		if c[0].Leaf == nil {
+			continue
+		}
+		for _, h := range c[0].Leaf.DNSNames {
+			s.byHost[strings.ToLower(h)] = c
+		}
+	}
+	return nil
+}
+
+// GetCertificate implements tls.Config.GetCertificate. A certificate for the
+// exact server name is preferred; otherwise a wildcard certificate covering
+// it is used. Clients that send no server name get the first certificate.
+// The SNIMatching of the store changes these rules. Of a certificate and
+// its companions, the first one the client supports is returned.
+func (s *certStore) GetCertificate(hello *tls.ClientHelloInfo) (*tls.Certificate, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	host := strings.ToLower(strings.TrimSuffix(hello.ServerName, "."))
+	if host == "" {
+		if s.match.NoDefault {
+			return nil, ErrNoServerName
+		}
+		return s.fallback(hello)
+	}
+	if certs, ok := s.byHost[host]; ok {
+		return selectCertificate(hello, certs), nil
+	}
+	if i := strings.Index(host, "."); i > 0 && !s.match.ExactOnly {
+		if certs, ok := s.byHost["*"+host[i:]]; ok {
+			return selectCertificate(hello, certs), nil
+		}
+	}
+	if s.match.Unmatched {
+		return s.fallback(hello)
+	}
+	return nil, ErrNoServerName
+}
+
+// fallback returns the first certificate. Callers must hold s.mu.
+func (s *certStore) fallback(hello *tls.ClientHelloInfo) (*tls.Certificate, error) {
+	if certs, ok := s.certs[s.first]; ok {
+		return selectCertificate(hello, certs), nil
+	}
+	return nil, ErrNoServerName
+}
+
+// NewListener listens on the TCP address addr, usually ":443", and serves
+// the certificate name from dir with the configuration returned by
+// TLSConfig. With ChallengeTLSALPN, the listener answers the validation
+// handshakes itself while the first certificate is created, so nothing else
+// needs to listen on port 443; the CA only validates on port 443, so addr
+// must be reachable there.
+func (c *Client) NewListener(ctx context.Context, addr, dir, name, chtype string, domains ...string) (net.Listener, error) {
+	l, err := net.Listen("tcp", addr)
+	if err != nil {
+		return nil, err
+	}
+	tl, err := c.NewListenerFrom(ctx, l, dir, name, chtype, domains...)
+	if err != nil {
+		l.Close()
+		return nil, err
+	}
+	return tl, nil
+}
+
+// NewListenerFrom is like NewListener but serves on l, which the caller has
+// already bound, e.g. a socket returned by SystemdListener. l is left open
+// if NewListenerFrom fails. With ChallengeTLSALPN and no certificate yet, l
+// must support deadlines, as *net.TCPListener does.
+func (c *Client) NewListenerFrom(ctx context.Context, l net.Listener, dir, name, chtype string, domains ...string) (net.Listener, error) {
+	store := &certStore{match: c.sniMatching}
+	config := c.serverConfig(store)
+	var err error
+	if chtype == ChallengeTLSALPN && !certExists(dir, name) {
+		dl, ok := l.(deadlineListener)
+		if !ok {
+			return nil, fmt.Errorf("%w: %T does not support deadlines", ErrUnsupportedChtype, l)
+		}
+		err = c.whileAccepting(dl, config, func() error {
+			return c.ensureCert(ctx, store, dir, name, chtype, domains...)
+		})
+	} else {
+		err = c.ensureCert(ctx, store, dir, name, chtype, domains...)
+	}
+	if err != nil {
+		return nil, err
+	}
+	go c.renewLoop(ctx, store, dir, name)
+	return tls.NewListener(l, config), nil
+}
+
+// TLSConfig returns a server configuration serving the certificate name from
+// dir. The certificate is created with Create if it does not exist yet, and
+// renewed in the background when it is due until ctx is done. The
+// configuration is ready for http.Server: it requires TLS 1.2, offers
+// HTTP/2 through ALPN and answers tls-alpn-01 challenges. Nothing serves
+// the configuration before TLSConfig returns, so the first certificate
+// cannot be created with ChallengeTLSALPN; use NewListener instead.
+func (c *Client) TLSConfig(ctx context.Context, dir, name, chtype string, domains ...string) (*tls.Config, error) {
+	if chtype == ChallengeTLSALPN && !certExists(dir, name) {
+		return nil, fmt.Errorf("%w: the first certificate needs NewListener to answer tls-alpn-01", ErrUnsupportedChtype)
+	}
+	store := &certStore{match: c.sniMatching}
+	if err := c.ensureCert(ctx, store, dir, name, chtype, domains...); err != nil {
+		return nil, err
+	}
+	go c.renewLoop(ctx, store, dir, name)
+	return c.serverConfig(store), nil
+}
+
+// serverConfig returns the configuration serving store and the tls-alpn-01
+// challenges of the client.
+func (c *Client) serverConfig(store *certStore) *tls.Config {
+	config := DefaultTLSConfig(c.GetCertificate(store.GetCertificate))
+	config.NextProtos = append(config.NextProtos, acme.ALPNProto)
+	return config
+}
+
+// deadlineListener is a listener whose Accept can be interrupted, such as
+// *net.TCPListener and *net.UnixListener.
+type deadlineListener interface {
+	net.Listener
+	SetDeadline(t time.Time) error
+}
+
+// whileAccepting runs fn while completing the TLS handshakes of the
+// connections to l with config and closing them, so that tls-alpn-01
+// validations succeed before the listener is handed out.
+func (c *Client) whileAccepting(l deadlineListener, config *tls.Config, fn func() error) error {
+	stop := make(chan struct{})
+	stopped := make(chan struct{})
+	go func() {
+		defer close(stopped)
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				select {
+				case <-stop:
+					return
+				default:
+				}
+				if ne, ok := err.(net.Error); ok && ne.Timeout() {
+					continue
+				}
+				c.log.Warnf("accepting tls-alpn-01 validations: %s", err)
+				return
+			}
+			go func() {
+				defer conn.Close()
+				conn.SetDeadline(time.Now().Add(dialTimeout))
+				tls.Server(conn, config).Handshake()
+			}()
+		}
+	}()
+	err := fn()
+	close(stop)
+	// Wake up Accept, then let the returned listener accept again.
+	l.SetDeadline(time.Now())
+	<-stopped
+	l.SetDeadline(time.Time{})
+	return err
+}
+
+// tls12CipherSuites are the cipher suites offered with TLS 1.2: forward
+// secret AEAD suites only, which also satisfy the HTTP/2 requirements.
+// TLS 1.3 suites are not configurable.
+var tls12CipherSuites = []uint16{
+	tls.TLS_ECDHE_ECDSA_WITH_AES_128_GCM_SHA256,
+	tls.TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256,
+	tls.TLS_ECDHE_ECDSA_WITH_AES_256_GCM_SHA384,
+	tls.TLS_ECDHE_RSA_WITH_AES_256_GCM_SHA384,
+	tls.TLS_ECDHE_ECDSA_WITH_CHACHA20_POLY1305_SHA256,
+	tls.TLS_ECDHE_RSA_WITH_CHACHA20_POLY1305_SHA256,
+}
+
+// DefaultTLSConfig returns a server configuration using getCertificate that
+// requires TLS 1.2 or later, offers only forward secret AEAD cipher suites
+// with TLS 1.2 and negotiates HTTP/2 or HTTP/1.1 through ALPN. Session
+// ticket keys are left to crypto/tls, which rotates them automatically.
+func DefaultTLSConfig(getCertificate func(*tls.ClientHelloInfo) (*tls.Certificate, error)) *tls.Config {
+	return &tls.Config{
+		GetCertificate: getCertificate,
+		MinVersion:     tls.VersionTLS12,
+		CipherSuites:   tls12CipherSuites,
+		NextProtos:     []string{"h2", "http/1.1"},
+	}
+}
+
+// certExists reports whether the certificate name exists in dir.
+func certExists(dir, name string) bool {
+	_, err := os.Stat(path.Join(dir, name+".crt"))
+	return !os.IsNotExist(err)
+}
+
+// ensureCert loads the certificate name, creating it first if necessary.
+func (c *Client) ensureCert(ctx context.Context, store *certStore, dir, name, chtype string, domains ...string) error {
+	if !certExists(dir, name) {
+		if err := c.Create(ctx, dir, name, chtype, domains...); err != nil {
+			return err
+		}
+	}
+	return store.load(dir, name)
+}
+
+// renewLoop periodically renews the certificate name and reloads it.
+func (c *Client) renewLoop(ctx context.Context, store *certStore, dir, name string) {
+	opts := RenewOptions{Names: []string{name}}
+	for {
+		select {
+		case <-c.clock.After(renewCheckInterval):
+		case <-ctx.Done():
+			return
+		}
+		cfg, err := LoadRenewalConfig(dir, name)
+		if err == nil {
+			cfg, err = inheritDefaults(dir, cfg)
+		}
+		if err != nil {
+			c.log.Errorf("renewing %s: %s", name, err)
+			continue
+		}
+		if !opts.due(dir, cfg, c.clock.Now()) {
+			continue
+		}
+		if err := c.Renew(ctx, dir, name); err != nil {
+			c.log.Errorf("renewing %s: %s", name, err)
+			continue
+		}
+		if err := store.load(dir, name); err != nil {
+			c.log.Errorf("reloading %s: %s", name, err)
+		}
+	}
+}
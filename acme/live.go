@@ -0,0 +1,202 @@
+package acme
+
+import (
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strconv"
+)
+
+var ErrNoPreviousVersion = errors.New("no previous certificate version")
+
+// WithLiveLinks keeps every issued certificate as a numbered version
+// archive/<name>/<n> holding cert.pem, chain.pem, fullchain.pem and
+// privkey.pem, and points the symlink live/<name> at the newest one, so
+// the files are read as live/<name>/fullchain.pem and so on. The link is
+// replaced with a single rename, so readers always see the files of one
+// version, and a version can be restored with Rollback. Without it,
+// <name>.key and <name>.crt are replaced one after the other, and a reader
+// may briefly see the new key with the previous certificate.
+func WithLiveLinks() Option {
+	return func(c *Client) {
+		c.live = true
+	}
+}
+
+// archiveDir returns the directory holding the versions of name.
+func archiveDir(dir, name string) string {
+	return path.Join(dir, "archive", name)
+}
+
+// versionDir returns the directory holding version n of name.
+func versionDir(dir, name string, n int) string {
+	return path.Join(archiveDir(dir, name), strconv.Itoa(n))
+}
+
+// liveDir returns the live link of name.
+func liveDir(dir, name string) string {
+	return path.Join(dir, "live", name)
+}
+
+// Versions returns the archived versions of the certificate name, oldest
+// first.
+func Versions(dir, name string) ([]int, error) {
+	matches, err := filepath.Glob(filepath.Join(archiveDir(dir, name), "*", "cert.pem"))
+	if err != nil {
+		return nil, err
+	}
+	var versions []int
+	for _, m := range matches {
+		if n, err := strconv.Atoi(filepath.Base(filepath.Dir(m))); err == nil && n > 0 {
+			versions = append(versions, n)
+		}
+	}
+	sort.Ints(versions)
+	return versions, nil
+}
+
+// LiveVersion returns the version the live link of name points at.
+func LiveVersion(dir, name string) (int, error) {
+	target, err := os.Readlink(liveDir(dir, name))
+	if err != nil {
+		return 0, err
+	}
+	n, err := strconv.Atoi(path.Base(target))
+	if err != nil {
+		return 0, fmt.Errorf("%s: unexpected live link %s", name, target)
+	}
+	return n, nil
+}
+
+// archive stores the chain ders and the current key of cfg as a new version
+// and switches the live links to it.
+func (c *Client) archive(dir string, cfg *RenewalConfig, ders [][]byte) error {
+	if !c.live || len(ders) == 0 {
+		return nil
+	}
+	versions, err := Versions(dir, cfg.Name)
+	if err != nil {
+		return err
+	}
+	n := 1
+	if len(versions) > 0 {
+		n = versions[len(versions)-1] + 1
+	}
+	key, err := ioutil.ReadFile(path.Join(dir, cfg.Name+".key"))
+	if err != nil {
+		return err
+	}
+	encode := func(ders [][]byte) []byte {
+		var b []byte
+		for _, der := range ders {
+			b = append(b, pem.EncodeToMemory(&pem.Block{Type: certType, Bytes: der})...)
+		}
+		return b
+	}
+	vdir := versionDir(dir, cfg.Name, n)
+	if err := os.MkdirAll(vdir, 0700); err != nil {
+		return err
+	}
+	for _, f := range []struct {
+		name string
+		b    []byte
+		perm os.FileMode
+	}{
+		{"privkey", key, 0600},
+		{"cert", encode(ders[:1]), 0644},
+		{"chain", encode(ders[1:]), 0644},
+		{"fullchain", encode(ders), 0644},
+	} {
+		p := path.Join(vdir, f.name+".pem")
+		if err := ioutil.WriteFile(p, f.b, f.perm); err != nil {
+			return err
+		}
+	}
+	if err := link(dir, cfg.Name, n); err != nil {
+		return err
+	}
+	c.log.Debugf("%s: live version is now %d", cfg.Name, n)
+	return nil
+}
+
+// link points the live link of name at version n. The link is created
+// under a temporary name and renamed over the previous one, so all files
+// switch at once.
+func link(dir, name string, n int) error {
+	if _, err := os.Stat(versionDir(dir, name, n)); err != nil {
+		return err
+	}
+	if err := os.MkdirAll(path.Join(dir, "live"), 0755); err != nil {
+		return err
+	}
+	target := path.Join("..", "archive", name, strconv.Itoa(n))
+	tmp := path.Join(dir, "live", "."+name+".tmp")
+	os.Remove(tmp)
+	if err := os.Symlink(target, tmp); err != nil {
+		return err
+	}
+	if err := os.Rename(tmp, liveDir(dir, name)); err != nil {
+		os.Remove(tmp)
+		return err
+	}
+	return nil
+}
+
+// Rollback points the live link of the certificate name back at the
+// version before the live one and restores that version as <name>.crt and
+// <name>.key, for when a new certificate breaks clients. Event hooks are
+// called with EventCertificateRolledBack so deployments can reload. The
+// restored version is returned.
+func (c *Client) Rollback(dir, name string) (int, error) {
+	if err := c.writable(); err != nil {
+		return 0, err
+	}
+	cur, err := LiveVersion(dir, name)
+	if err != nil {
+		return 0, err
+	}
+	versions, err := Versions(dir, name)
+	if err != nil {
+		return 0, err
+	}
+	prev := 0
+	for _, v := range versions {
+		if v < cur {
+			prev = v
+		}
+	}
+	if prev == 0 {
+		return 0, fmt.Errorf("%w: %s is at version %d", ErrNoPreviousVersion, name, cur)
+	}
+	vdir := versionDir(dir, name, prev)
+	for _, f := range []struct {
+		src, dst string
+		perm     os.FileMode
+	}{
+		{"privkey", name + ".key", 0600},
+		{"fullchain", name + ".crt", 0644},
+	} {
+		b, err := ioutil.ReadFile(path.Join(vdir, f.src+".pem"))
+		if err != nil {
+			return 0, err
+		}
+		if err := ioutil.WriteFile(path.Join(dir, f.dst), b, f.perm); err != nil {
+			return 0, err
+		}
+	}
+	if err := link(dir, name, prev); err != nil {
+		return 0, err
+	}
+	c.log.Warnf("%s: rolled back from version %d to %d", name, cur, prev)
+	var domains []string
+	if cfg, err := LoadRenewalConfig(dir, name); err == nil {
+		domains = cfg.Domains
+	}
+	c.emit(EventCertificateRolledBack, name, domains, nil)
+	return prev, nil
+}
@@ -0,0 +1,254 @@
+package acme
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path"
+	"time"
+
+	"golang.org/x/crypto/acme"
+)
+
+// pendingVersion is the current version of the pending order file format.
+const pendingVersion = 1
+
+var ErrOrderExpired = errors.New("pending order has expired")
+
+// PendingOrder is an order started with Begin whose challenges are placed
+// by hand. It is stored as <name>.order.json until Continue completes it.
+type PendingOrder struct {
+	Version    int                `json:"version"`
+	Name       string             `json:"name"`
+	Chtype     string             `json:"chtype"`
+	Domains    []string           `json:"domains"`
+	OrderURL   string             `json:"orderURL"`
+	Expires    time.Time          `json:"expires"`
+	Challenges []PendingChallenge `json:"challenges"`
+}
+
+// PendingChallenge is a challenge to be placed for a PendingOrder. For
+// dns-01 and dns-account-01 Record is the TXT record name and Value its
+// value; for http-01 Record is the URL to serve Value at.
+type PendingChallenge struct {
+	Domain string `json:"domain"`
+	Type   string `json:"type"`
+	URL    string `json:"url"`
+	Token  string `json:"token"`
+	Record string `json:"record"`
+	Value  string `json:"value"`
+}
+
+// pendingPath returns the location of the pending order of name.
+func pendingPath(dir, name string) string {
+	return path.Join(dir, name+".order.json")
+}
+
+// LoadPendingOrder reads the pending order of the certificate name.
+func LoadPendingOrder(dir, name string) (*PendingOrder, error) {
+	b, err := ioutil.ReadFile(pendingPath(dir, name))
+	if err != nil {
+		return nil, err
+	}
+	p := &PendingOrder{}
+	if err := json.Unmarshal(b, p); err != nil {
+		return nil, err
+	}
+	if p.Version > pendingVersion {
+		return nil, fmt.Errorf("pending order file version %d is not supported", p.Version)
+	}
+	return p, nil
+}
+
+// Save writes the pending order to dir.
+func (p *PendingOrder) Save(dir string) error {
+	p.Version = pendingVersion
+	b, err := json.MarshalIndent(p, "", "  ")
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(pendingPath(dir, p.Name), b, 0644)
+}
+
+// Begin starts issuing a certificate whose challenges are placed by hand,
+// for hosts without access to the DNS or web server. It orders the
+// certificate, prints the challenges and stores them in dir; the program
+// can then exit. Once the challenges are in place, Continue completes the
+// issuance. To place them from another machine, hand it the order with
+// WritePendingOrder.
+func (c *Client) Begin(ctx context.Context, dir, name, chtype string, domains ...string) (*PendingOrder, error) {
+	if err := c.writable(); err != nil {
+		return nil, err
+	}
+	cfg, err := inheritDefaults(dir, c.newConfig(name, chtype, domains))
+	if err != nil {
+		return nil, err
+	}
+	if err := cfg.normalize(); err != nil {
+		return nil, err
+	}
+	if len(cfg.Domains) == 0 {
+		return nil, ErrNoDomains
+	}
+	o, err := c.ca().AuthorizeOrder(ctx, acme.DomainIDs(cfg.Domains...))
+	if err != nil {
+		return nil, c.issueError(cfg, err)
+	}
+	if err := c.checkOrder(o); err != nil {
+		return nil, err
+	}
+	p := &PendingOrder{
+		Name:     name,
+		Chtype:   chtype,
+		Domains:  cfg.Domains,
+		OrderURL: o.URI,
+		Expires:  o.Expires,
+	}
+	for _, u := range o.AuthzURLs {
+		auth, err := c.ca().GetAuthorization(ctx, u)
+		if err != nil {
+			return nil, err
+		}
+		if err := c.checkAuthorization(auth); err != nil {
+			return nil, err
+		}
+		if auth.Status == acme.StatusValid {
+			continue
+		}
+		pc, err := c.pendingChallenge(ctx, auth, cfg.Chtype)
+		if err != nil {
+			return nil, err
+		}
+		p.Challenges = append(p.Challenges, *pc)
+	}
+	if err := ensureDir(dir); err != nil {
+		return nil, err
+	}
+	if err := p.Save(dir); err != nil {
+		return nil, err
+	}
+	for _, pc := range p.Challenges {
+		if pc.Type == ChallengeHTTP {
+			fmt.Printf("Please serve:  %s ----> %s\n", pc.Record, pc.Value)
+		} else {
+			fmt.Printf("Please add DNS TXT parsing:  %s ----> %s\n", pc.Record, pc.Value)
+		}
+	}
+	return p, nil
+}
+
+// pendingChallenge selects the challenge of the authorization to place by
+// hand and computes what must be published for it.
+func (c *Client) pendingChallenge(ctx context.Context, auth *acme.Authorization, chtype string) (*PendingChallenge, error) {
+	chtype = c.selectChallenge(ctx, auth, chtype)
+	chal, err := findChallenge(auth, chtype)
+	if err != nil {
+		return nil, err
+	}
+	domain := auth.Identifier.Value
+	pc := &PendingChallenge{
+		Domain: authzDomain(auth),
+		Type:   chtype,
+		URL:    chal.URI,
+		Token:  chal.Token,
+	}
+	switch chtype {
+	case ChallengeHTTP:
+		pc.Record = "http://" + domain + c.ca().HTTP01ChallengePath(chal.Token)
+		pc.Value, err = c.ca().HTTP01ChallengeResponse(chal.Token)
+	case ChallengeDNS:
+		pc.Record = "_acme-challenge." + domain
+		pc.Value, err = c.ca().DNS01ChallengeRecord(chal.Token)
+	case ChallengeDNSAccount:
+		var accountURL string
+		if accountURL, err = c.accountURL(ctx); err == nil {
+			pc.Record = DNSAccountRecord(accountURL, domain)
+			pc.Value, err = c.ca().DNS01ChallengeRecord(chal.Token)
+		}
+	default:
+		err = fmt.Errorf("%w: %s challenges cannot be placed by hand", ErrUnsupportedChtype, chtype)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return pc, nil
+}
+
+// txtVerifier checks TXT records like VerifyTXT.
+type txtVerifier func(ctx context.Context, name string, want ...string) ([]TXTResult, error)
+
+// check verifies that the challenge has been placed, looking up TXT records
+// with verify.
+func (pc *PendingChallenge) check(ctx context.Context, verify txtVerifier) error {
+	if pc.Type == ChallengeHTTP {
+		v, err := fetchHTTP(ctx, pc.Record)
+		if err != nil {
+			return err
+		}
+		if v != pc.Value {
+			return fmt.Errorf("%s serves %q instead of the challenge response", pc.Record, v)
+		}
+		return nil
+	}
+	_, err := verify(ctx, pc.Record, pc.Value)
+	return err
+}
+
+// Continue completes the pending order of the certificate name started
+// with Begin. The challenges are checked first, so that Continue fails
+// without using up the order if they are not in place yet and can be
+// called again. TXT records are checked with the resolvers of WithDoH if it
+// is set.
+func (c *Client) Continue(ctx context.Context, dir, name string) (err error) {
+	if err := c.writable(); err != nil {
+		return err
+	}
+	p, err := LoadPendingOrder(dir, name)
+	if err != nil {
+		return err
+	}
+	if !p.Expires.IsZero() && c.clock.Now().After(p.Expires) {
+		return fmt.Errorf("%w: %s", ErrOrderExpired, name)
+	}
+	if err := p.check(ctx, c.verifyTXT); err != nil {
+		return err
+	}
+	cfg, err := inheritDefaults(dir, c.newConfig(name, p.Chtype, p.Domains))
+	if err != nil {
+		return err
+	}
+	ctx, op := c.operation(ctx)
+	defer func() {
+		err = op.wrap(err)
+	}()
+	defer func(start time.Time) {
+		c.record(dir, cfg, start, err)
+	}(c.clock.Now())
+	for _, pc := range p.Challenges {
+		chal := &acme.Challenge{Type: pc.Type, URI: pc.URL, Token: pc.Token}
+		if err := c.accept(ctx, chal); err != nil {
+			return c.issueError(cfg, err)
+		}
+	}
+	o, err := c.ca().WaitOrder(ctx, p.OrderURL)
+	if err != nil {
+		return c.issueError(cfg, err)
+	}
+	b, err := c.generateCSR(dir, cfg)
+	if err != nil {
+		return err
+	}
+	if err := c.createCert(ctx, o, b, dir, cfg); err != nil {
+		return err
+	}
+	if err := c.finish(ctx, dir, cfg); err != nil {
+		return err
+	}
+	if err := os.Remove(pendingPath(dir, name)); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,107 @@
+package acme
+
+import (
+	"bufio"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// Renewal states reported by ExpiryHandler.
+const (
+	StatusOK      = "ok"
+	StatusDue     = "due"
+	StatusFailed  = "failed"
+	StatusInvalid = "invalid"
+)
+
+var renewalStatuses = []string{StatusOK, StatusDue, StatusFailed, StatusInvalid}
+
+// ExpiryHandler serves the expiry of the certificates in dir in the
+// Prometheus text format, for scraping into Grafana dashboards. For every
+// certificate it reports
+//
+//	letsencrypt_cert_expiry_seconds{name,sans}            seconds until expiry
+//	letsencrypt_cert_not_after_timestamp_seconds{name,sans}
+//	letsencrypt_cert_renewal_status{name,status}          1 for the current status
+//
+// where status is ok, due (inside the renewal window), failed (the last
+// attempt failed) or invalid (the certificate cannot be read). before is the
+// renewal window and defaults to DefaultRenewBefore.
+func ExpiryHandler(dir string, before time.Duration) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		report, err := ExpiryReport(dir, before)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		failed, err := lastFailed(dir)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		now := time.Now()
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+		bw := bufio.NewWriter(w)
+		defer bw.Flush()
+		fmt.Fprintln(bw, "# HELP letsencrypt_cert_expiry_seconds Seconds until the certificate expires.")
+		fmt.Fprintln(bw, "# TYPE letsencrypt_cert_expiry_seconds gauge")
+		for _, e := range report {
+			if e.Error == "" {
+				fmt.Fprintf(bw, "letsencrypt_cert_expiry_seconds{%s} %d\n", certLabels(e), int64(e.NotAfter.Sub(now).Seconds()))
+			}
+		}
+		fmt.Fprintln(bw, "# HELP letsencrypt_cert_not_after_timestamp_seconds Expiry of the certificate as a Unix timestamp.")
+		fmt.Fprintln(bw, "# TYPE letsencrypt_cert_not_after_timestamp_seconds gauge")
+		for _, e := range report {
+			if e.Error == "" {
+				fmt.Fprintf(bw, "letsencrypt_cert_not_after_timestamp_seconds{%s} %d\n", certLabels(e), e.NotAfter.Unix())
+			}
+		}
+		fmt.Fprintln(bw, "# HELP letsencrypt_cert_renewal_status Renewal status of the certificate.")
+		fmt.Fprintln(bw, "# TYPE letsencrypt_cert_renewal_status gauge")
+		for _, e := range report {
+			status := StatusOK
+			switch {
+			case e.Error != "":
+				status = StatusInvalid
+			case failed[e.Name]:
+				status = StatusFailed
+			case now.After(e.RenewAt):
+				status = StatusDue
+			}
+			for _, s := range renewalStatuses {
+				v := 0
+				if s == status {
+					v = 1
+				}
+				fmt.Fprintf(bw, "letsencrypt_cert_renewal_status{name=%s,status=%q} %d\n", promQuote(e.Name), s, v)
+			}
+		}
+	})
+}
+
+// lastFailed reports, per certificate, whether the last issuance recorded
+// in the history of dir failed.
+func lastFailed(dir string) (map[string]bool, error) {
+	entries, err := History(dir)
+	if err != nil {
+		return nil, err
+	}
+	failed := make(map[string]bool)
+	for _, e := range entries {
+		failed[e.Name] = e.Error != ""
+	}
+	return failed, nil
+}
+
+// certLabels returns the name and sans labels of a certificate.
+func certLabels(e Expiry) string {
+	return fmt.Sprintf("name=%s,sans=%s", promQuote(e.Name), promQuote(strings.Join(e.Domains, ",")))
+}
+
+// promQuote quotes a Prometheus label value.
+func promQuote(s string) string {
+	return `"` + strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`).Replace(s) + `"`
+}
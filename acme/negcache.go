@@ -0,0 +1,110 @@
+package acme
+
+import (
+	"context"
+	"net"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// typeSOA is the SOA record type.
+const typeSOA = 6
+
+// negativeCache describes resolvers caching the absence of a TXT record.
+type negativeCache struct {
+	zone  string
+	until time.Time
+}
+
+// negativeTTL returns how long resolvers may cache the absence of the TXT
+// record name and the zone it belongs to, from the SOA record of a negative
+// answer: the smaller of the SOA's TTL and its minimum field, as in RFC
+// 2308. ok is false if the record exists or the answer has no SOA.
+func (c *Client) negativeTTL(ctx context.Context, name string) (ttl time.Duration, zone string, ok bool) {
+	endpoint := DoHGoogle
+	if len(c.doh) > 0 {
+		endpoint = c.doh[0]
+	}
+	r, err := queryDoH(ctx, endpoint, typeTXT, name)
+	if err != nil {
+		return 0, "", false
+	}
+	for _, rec := range r.Answer {
+		if rec.Type == typeTXT {
+			return 0, "", false
+		}
+	}
+	for _, rec := range r.Authority {
+		if rec.Type != typeSOA {
+			continue
+		}
+		fields := strings.Fields(rec.Data)
+		if len(fields) != 7 {
+			continue
+		}
+		min, err := strconv.Atoi(fields[6])
+		if err != nil {
+			continue
+		}
+		if rec.TTL < min {
+			min = rec.TTL
+		}
+		return time.Duration(min) * time.Second, strings.TrimSuffix(rec.Name, "."), true
+	}
+	return 0, "", false
+}
+
+// authoritativeTXT checks the TXT record name at each authoritative
+// nameserver of zone directly, bypassing resolver caches.
+func authoritativeTXT(ctx context.Context, zone, name string, want ...string) ([]TXTResult, error) {
+	nss, err := net.DefaultResolver.LookupNS(ctx, zone)
+	if err != nil {
+		return nil, err
+	}
+	results := make([]TXTResult, len(nss))
+	for i, ns := range nss {
+		host := strings.TrimSuffix(ns.Host, ".")
+		results[i].Resolver = host
+		r := &net.Resolver{
+			PreferGo: true,
+			Dial: func(ctx context.Context, network, _ string) (net.Conn, error) {
+				var d net.Dialer
+				return d.DialContext(ctx, network, net.JoinHostPort(host, "53"))
+			},
+		}
+		values, err := r.LookupTXT(ctx, name)
+		if err != nil {
+			results[i].Error = err.Error()
+			continue
+		}
+		results[i].Values = values
+	}
+	return checkTXT(name, want, results)
+}
+
+// checkNegative is called while a TXT record is not visible yet. The first
+// time the record is found negatively cached, the expected delay is
+// logged; from then on the authoritative nameservers are asked directly,
+// and their answer is reported as sufficient if they all have the values.
+// If they cannot be reached, the caller keeps polling until the negative
+// answers expire.
+func (c *Client) checkNegative(ctx context.Context, neg **negativeCache, name string, want []string) bool {
+	if *neg == nil {
+		ttl, zone, ok := c.negativeTTL(ctx, name)
+		if !ok {
+			return false
+		}
+		*neg = &negativeCache{zone: zone, until: c.clock.Now().Add(ttl)}
+		c.log.Infof("%s does not exist yet and resolvers may cache that for %s; checking the nameservers of %s directly", name, ttl, zone)
+	}
+	if _, err := authoritativeTXT(ctx, (*neg).zone, name, want...); err != nil {
+		c.log.Debugf("authoritative check: %s", err)
+		return false
+	}
+	if c.clock.Now().Before((*neg).until) {
+		c.log.Infof("%s is published on all nameservers of %s; not waiting for cached negative answers to expire at %s",
+			name, (*neg).zone, (*neg).until.Format(time.RFC3339))
+	}
+	return true
+}
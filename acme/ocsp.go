@@ -0,0 +1,99 @@
+package acme
+
+import (
+	"bytes"
+	"context"
+	"crypto"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"path"
+
+	"golang.org/x/crypto/ocsp"
+)
+
+// mustStapleExt is the TLS Feature extension requesting status_request (RFC 7633).
+var mustStapleExt = pkix.Extension{
+	Id:    asn1.ObjectIdentifier{1, 3, 6, 1, 5, 5, 7, 1, 24},
+	Value: []byte{0x30, 0x03, 0x02, 0x01, 0x05},
+}
+
+var (
+	ErrNoOCSPServer = errors.New("certificate has no OCSP server")
+	ErrNoIssuer     = errors.New("certificate chain has no issuer")
+	ErrStapleStatus = errors.New("OCSP response is not good")
+)
+
+// WithMustStaple requests the OCSP Must-Staple extension in issued
+// certificates. Create then fails unless a good OCSP response could be fetched
+// and written next to the certificate as <name>.ocsp, so the certificate is
+// never deployed without a staple; the previous certificate is kept
+// otherwise. Use RefreshStaple to keep it current.
+func WithMustStaple() Option {
+	return func(c *Client) {
+		c.mustStaple = true
+	}
+}
+
+// RefreshStaple fetches a fresh OCSP response for the certificate <name>.crt
+// in dir and writes it to <name>.ocsp. The response is only written if the
+// certificate status is good.
+func (c *Client) RefreshStaple(ctx context.Context, dir, name string) (*ocsp.Response, error) {
+	if err := c.writable(); err != nil {
+		return nil, err
+	}
+	chain, err := loadChain(dir, name)
+	if err != nil {
+		return nil, err
+	}
+	b, staple, err := c.fetchStaple(ctx, chain)
+	if err != nil {
+		return nil, err
+	}
+	c.log.Debugf("fetched OCSP staple for %s, next update %s", name, staple.NextUpdate)
+	if err := ioutil.WriteFile(path.Join(dir, name+".ocsp"), b, 0644); err != nil {
+		return nil, err
+	}
+	return staple, nil
+}
+
+// fetchStaple fetches a good OCSP response for the leaf of chain and
+// returns it raw and parsed.
+func (c *Client) fetchStaple(ctx context.Context, chain []*x509.Certificate) ([]byte, *ocsp.Response, error) {
+	if len(chain) < 2 {
+		return nil, nil, ErrNoIssuer
+	}
+	leaf, issuer := chain[0], chain[1]
+	if len(leaf.OCSPServer) == 0 {
+		return nil, nil, ErrNoOCSPServer
+	}
+	req, err := ocsp.CreateRequest(leaf, issuer, &ocsp.RequestOptions{Hash: crypto.SHA1})
+	if err != nil {
+		return nil, nil, err
+	}
+	r, err := http.NewRequest("POST", leaf.OCSPServer[0], bytes.NewReader(req))
+	if err != nil {
+		return nil, nil, err
+	}
+	r.Header.Set("Content-Type", "application/ocsp-request")
+	resp, err := http.DefaultClient.Do(r.WithContext(ctx))
+	if err != nil {
+		return nil, nil, err
+	}
+	defer resp.Body.Close()
+	b, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return nil, nil, err
+	}
+	staple, err := ocsp.ParseResponseForCert(b, leaf, issuer)
+	if err != nil {
+		return nil, nil, err
+	}
+	if staple.Status != ocsp.Good {
+		return nil, nil, ErrStapleStatus
+	}
+	return b, staple, nil
+}
@@ -0,0 +1,189 @@
+package acme
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+
+	"golang.org/x/crypto/acme"
+)
+
+// IssueError is returned when an order fails because of some of its domain
+// names. Failed holds the reason for each failed domain, taken from the
+// authorizations and from the subproblems of the CA's error.
+type IssueError struct {
+	Name    string
+	Domains []string
+	Failed  map[string]error
+
+	// Problem is the error returned by the CA for the order, if any.
+	Problem *acme.Error
+}
+
+func (e *IssueError) Error() string {
+	if len(e.Failed) == 0 {
+		if e.Problem != nil {
+			return fmt.Sprintf("%s: %s", e.Name, e.Problem)
+		}
+		return fmt.Sprintf("%s: order failed", e.Name)
+	}
+	domains := make([]string, 0, len(e.Failed))
+	for d := range e.Failed {
+		domains = append(domains, d)
+	}
+	sort.Strings(domains)
+	reasons := make([]string, len(domains))
+	for i, d := range domains {
+		reasons[i] = fmt.Sprintf("%s: %s", d, e.Failed[d])
+	}
+	return fmt.Sprintf("%s: %d of %d domains failed: %s",
+		e.Name, len(e.Failed), len(e.Domains), strings.Join(reasons, "; "))
+}
+
+// Unwrap returns the error reported by the CA.
+func (e *IssueError) Unwrap() error {
+	if e.Problem == nil {
+		return nil
+	}
+	return e.Problem
+}
+
+// Passed returns the domain names of the order that did not fail.
+func (e *IssueError) Passed() []string {
+	var passed []string
+	for _, d := range e.Domains {
+		if _, ok := e.Failed[d]; !ok {
+			passed = append(passed, d)
+		}
+	}
+	return passed
+}
+
+// WithRetrySubset retries a failed issuance once with only the domain names
+// that passed validation, so one broken name does not block a large SAN
+// certificate. The renewal parameters keep all names, so the failed ones are
+// attempted again on the next renewal.
+func WithRetrySubset() Option {
+	return func(c *Client) {
+		c.retrySubset = true
+	}
+}
+
+// authorizeOrder creates an order for the certificate, authorizes its
+// identifiers and waits until it is ready to be finalized.
+func (c *Client) authorizeOrder(ctx context.Context, dir string, cfg *RenewalConfig) (*acme.Order, error) {
+	o, err := c.newOrder(ctx, dir, cfg)
+	if err != nil {
+		return nil, err
+	}
+	return c.completeOrder(ctx, dir, cfg, o)
+}
+
+// newOrder creates and checks an order for the certificate.
+func (c *Client) newOrder(ctx context.Context, dir string, cfg *RenewalConfig) (*acme.Order, error) {
+	if len(cfg.Domains) == 0 {
+		return nil, ErrNoDomains
+	}
+	if err := c.runCanary(ctx, dir, cfg); err != nil {
+		return nil, err
+	}
+	o, err := c.ca().AuthorizeOrder(ctx, acme.DomainIDs(cfg.Domains...))
+	if err != nil {
+		return nil, c.issueError(cfg, err)
+	}
+	if err := c.checkOrder(o); err != nil {
+		return nil, err
+	}
+	for _, u := range o.AuthzURLs {
+		if err := c.validateURL("authorization url", u); err != nil {
+			return nil, err
+		}
+	}
+	if err := c.validateURL("finalize url", o.FinalizeURL); err != nil {
+		return nil, err
+	}
+	return o, nil
+}
+
+// completeOrder authorizes the identifiers of the order and waits until it
+// is ready to be finalized.
+func (c *Client) completeOrder(ctx context.Context, dir string, cfg *RenewalConfig, o *acme.Order) (*acme.Order, error) {
+	failed, err := c.authorizeAll(ctx, dir, cfg.Chtype, o.AuthzURLs...)
+	if err != nil {
+		return nil, err
+	}
+	if len(failed) > 0 {
+		return nil, &IssueError{Name: cfg.Name, Domains: cfg.Domains, Failed: failed}
+	}
+	o, err = c.ca().WaitOrder(ctx, o.URI)
+	if err != nil {
+		return nil, c.issueError(cfg, err)
+	}
+	return o, nil
+}
+
+// obtain orders and writes the certificate for cfg with a new key.
+func (c *Client) obtain(ctx context.Context, dir string, cfg *RenewalConfig) error {
+	o, err := c.authorizeOrder(ctx, dir, cfg)
+	if err != nil {
+		return err
+	}
+	b, err := c.generateCSR(dir, cfg)
+	if err != nil {
+		return err
+	}
+	return c.createCert(ctx, o, b, dir, cfg)
+}
+
+// retry repeats a failed issuance with the domain names that passed if
+// WithRetrySubset is set and err identifies the failed names.
+func (c *Client) retry(ctx context.Context, dir string, cfg *RenewalConfig, err error) error {
+	var ie *IssueError
+	if !c.retrySubset || !errors.As(err, &ie) {
+		return err
+	}
+	passed := ie.Passed()
+	if len(passed) == 0 || len(passed) == len(cfg.Domains) {
+		return err
+	}
+	c.log.Warnf("%s; retrying with %s", err, strings.Join(passed, ", "))
+	sub := *cfg
+	sub.Domains = passed
+	return c.obtain(ctx, dir, &sub)
+}
+
+// issueError converts an error returned by the CA into an IssueError if the
+// problem names the identifiers that caused it.
+func (c *Client) issueError(cfg *RenewalConfig, err error) error {
+	c.invalidateDirectory(err)
+	var p *acme.Error
+	var oe *acme.OrderError
+	switch {
+	case errors.As(err, &oe) && oe.Problem != nil:
+		p = oe.Problem
+	case errors.As(err, &p):
+	default:
+		return err
+	}
+	ie := &IssueError{Name: cfg.Name, Domains: cfg.Domains, Problem: p}
+	for _, s := range p.Subproblems {
+		if s.Identifier == nil {
+			continue
+		}
+		if ie.Failed == nil {
+			ie.Failed = make(map[string]error)
+		}
+		ie.Failed[s.Identifier.Value] = &acme.Error{
+			StatusCode:  p.StatusCode,
+			ProblemType: s.Type,
+			Detail:      s.Detail,
+			Instance:    s.Instance,
+		}
+	}
+	if ie.Failed == nil && len(p.Subproblems) == 0 {
+		return err
+	}
+	return ie
+}
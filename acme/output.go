@@ -0,0 +1,105 @@
+package acme
+
+import (
+	"bytes"
+	"crypto/x509"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path"
+	"strings"
+	"text/template"
+	"time"
+)
+
+// Output describes an issued certificate to the CertPath and KeyPath
+// templates of its renewal parameters, e.g.
+//
+//	/etc/ssl/{{.Domain}}/{{.NotAfter.Format "2006-01-02"}}-{{.SerialHex}}.crt
+type Output struct {
+	Name      string
+	Domain    string
+	Domains   []string
+	Serial    string
+	SerialHex string
+	NotBefore time.Time
+	NotAfter  time.Time
+}
+
+// newOutput describes the leaf certificate issued for cfg.
+func newOutput(cfg *RenewalConfig, leaf *x509.Certificate) *Output {
+	o := &Output{
+		Name:      cfg.Name,
+		Domains:   cfg.Domains,
+		Serial:    leaf.SerialNumber.String(),
+		SerialHex: fmt.Sprintf("%x", leaf.SerialNumber),
+		NotBefore: leaf.NotBefore,
+		NotAfter:  leaf.NotAfter,
+	}
+	if len(cfg.Domains) > 0 {
+		o.Domain = cfg.Domains[0]
+	}
+	return o
+}
+
+// outputPath expands the path template tmpl. Relative paths are relative to
+// dir.
+func outputPath(dir, tmpl string, o *Output) (string, error) {
+	t, err := template.New("path").Option("missingkey=error").Parse(tmpl)
+	if err != nil {
+		return "", err
+	}
+	var b bytes.Buffer
+	if err := t.Execute(&b, o); err != nil {
+		return "", err
+	}
+	p := strings.TrimSpace(b.String())
+	if p == "" {
+		return "", fmt.Errorf("output path %q is empty", tmpl)
+	}
+	if !path.IsAbs(p) {
+		p = path.Join(dir, p)
+	}
+	return p, nil
+}
+
+// export copies the certificate and key of cfg from dir to the paths given
+// by the CertPath and KeyPath templates, if set. der is the issued leaf
+// certificate.
+func (c *Client) export(dir string, cfg *RenewalConfig, der []byte) error {
+	if cfg.CertPath == "" && cfg.KeyPath == "" {
+		return nil
+	}
+	leaf, err := x509.ParseCertificate(der)
+	if err != nil {
+		return err
+	}
+	o := newOutput(cfg, leaf)
+	for _, f := range []struct {
+		tmpl, ext string
+		perm      os.FileMode
+	}{
+		{cfg.CertPath, ".crt", 0644},
+		{cfg.KeyPath, ".key", 0600},
+	} {
+		if f.tmpl == "" {
+			continue
+		}
+		p, err := outputPath(dir, f.tmpl, o)
+		if err != nil {
+			return fmt.Errorf("%s: %w", cfg.Name, err)
+		}
+		b, err := ioutil.ReadFile(path.Join(dir, cfg.Name+f.ext))
+		if err != nil {
+			return err
+		}
+		if err := ensureDir(path.Dir(p)); err != nil {
+			return err
+		}
+		if err := ioutil.WriteFile(p, b, f.perm); err != nil {
+			return err
+		}
+		c.log.Debugf("%s: wrote %s", cfg.Name, p)
+	}
+	return nil
+}
@@ -0,0 +1,30 @@
+package acme
+
+import (
+	"fmt"
+	"runtime/debug"
+)
+
+// PanicError is returned when a solver, hook or other code supplied by the
+// caller panics. Provider names the code that panicked.
+type PanicError struct {
+	Provider string
+	Value    interface{}
+	Stack    []byte
+}
+
+func (e *PanicError) Error() string {
+	return fmt.Sprintf("%s panicked: %v", e.Provider, e.Value)
+}
+
+// protect runs fn, converting a panic into a *PanicError attributed to
+// provider, so one faulty plugin cannot bring down a process managing many
+// certificates.
+func protect(provider string, fn func() error) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = &PanicError{Provider: provider, Value: r, Stack: debug.Stack()}
+		}
+	}()
+	return fn()
+}
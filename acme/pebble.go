@@ -0,0 +1,69 @@
+package acme
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+)
+
+var ErrInsecureDirectory = errors.New("insecure client needs a directory on a loopback or private address")
+
+// PebbleURL is the default directory of a local Pebble test CA.
+const PebbleURL = "https://localhost:14000/dir"
+
+// WithDirectoryURL sets the directory of the ACME CA. It defaults to the Let's
+// Encrypt production directory.
+func WithDirectoryURL(url string) Option {
+	return func(c *Client) {
+		c.directory = url
+	}
+}
+
+// WithInsecure disables verification of the CA's TLS certificate and allows
+// plain HTTP URLs in its responses, as needed for test CAs such as Pebble:
+//
+//	acme.New(ctx, dir, "account", "", acme.WithDirectoryURL(acme.PebbleURL), acme.WithInsecure())
+//
+// New fails with ErrInsecureDirectory unless the directory host is
+// loopback or private, so it cannot be used with a production CA.
+func WithInsecure() Option {
+	return func(c *Client) {
+		c.insecure = true
+		c.insecureURLs = true
+	}
+}
+
+// checkInsecure verifies that the directory of an insecure client is on a
+// loopback or private address and returns the transport skipping TLS
+// verification.
+func (c *Client) checkInsecure(ctx context.Context, directory string) (http.RoundTripper, error) {
+	u, err := url.Parse(directory)
+	if err != nil {
+		return nil, err
+	}
+	host := u.Hostname()
+	var ips []net.IP
+	if ip := net.ParseIP(host); ip != nil {
+		ips = []net.IP{ip}
+	} else {
+		addrs, err := net.DefaultResolver.LookupIPAddr(ctx, host)
+		if err != nil {
+			return nil, err
+		}
+		for _, a := range addrs {
+			ips = append(ips, a.IP)
+		}
+	}
+	for _, ip := range ips {
+		if !ip.IsLoopback() && !ip.IsPrivate() && !ip.IsLinkLocalUnicast() {
+			return nil, fmt.Errorf("%w: %s resolves to %s", ErrInsecureDirectory, host, ip)
+		}
+	}
+	t := http.DefaultTransport.(*http.Transport).Clone()
+	t.TLSClientConfig = &tls.Config{InsecureSkipVerify: true}
+	return t, nil
+}
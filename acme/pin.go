@@ -0,0 +1,116 @@
+package acme
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"os"
+)
+
+var ErrPinMismatch = errors.New("key does not match the configured pins")
+
+// WithKeyReuse keeps the private key of a certificate across renewals
+// instead of generating a new one, e.g. for DANE 3 1 1 records. It sets the
+// default for new certificates; see RenewalConfig.ReuseKey.
+func WithKeyReuse() Option {
+	return func(c *Client) {
+		c.reuseKey = true
+	}
+}
+
+// SPKIPin returns the pin of a public key: the base64 encoded SHA-256 hash of
+// its SubjectPublicKeyInfo, as used by HPKP pin-sha256.
+func SPKIPin(pub crypto.PublicKey) (string, error) {
+	b, err := x509.MarshalPKIXPublicKey(pub)
+	if err != nil {
+		return "", err
+	}
+	sum := sha256.Sum256(b)
+	return base64.StdEncoding.EncodeToString(sum[:]), nil
+}
+
+// checkPins returns ErrPinMismatch if pins is not empty and does not contain
+// the pin of pub.
+func checkPins(pins []string, pub crypto.PublicKey) error {
+	if len(pins) == 0 {
+		return nil
+	}
+	pin, err := SPKIPin(pub)
+	if err != nil {
+		return err
+	}
+	for _, p := range pins {
+		if p == pin {
+			return nil
+		}
+	}
+	return fmt.Errorf("%w: %s", ErrPinMismatch, pin)
+}
+
+// certKey returns the private key to request the certificate with. The
+// existing key is kept if the certificate reuses its key or is pinned;
+// otherwise a new one is generated and reported as fresh. generateCSR
+// writes a fresh key to <name>.key.pending until writeCert installs it with
+// its certificate.
+func (c *Client) certKey(dir string, cfg *RenewalConfig) (k crypto.Signer, fresh bool, err error) {
+	if err := checkKeyType(cfg.KeyType); err != nil {
+		return nil, false, err
+	}
+	if !cfg.ReuseKey && len(cfg.Pins) == 0 {
+		k, err := newKey(c.rand, cfg.KeyType)
+		return k, err == nil, err
+	}
+	k, err = loadCertKey(dir, cfg.Name+".key")
+	switch {
+	case err == nil:
+		if err := checkPins(cfg.Pins, k.Public()); err != nil {
+			return nil, false, err
+		}
+		t := keyTypeOf(k.Public())
+		if cfg.KeyType == "" || t == cfg.KeyType {
+			return k, false, nil
+		}
+		if len(cfg.Pins) > 0 {
+			return nil, false, fmt.Errorf("%w: key of %s is not %s", ErrPinMismatch, cfg.Name, cfg.KeyType)
+		}
+		c.log.Infof("replacing the %s key of %s with a %s key", keyDesc(k.Public()), cfg.Name, cfg.KeyType)
+	case !os.IsNotExist(err):
+		return nil, false, err
+	case len(cfg.Pins) > 0:
+		// A new key cannot match the pins.
+		return nil, false, fmt.Errorf("%w: no key for %s", ErrPinMismatch, cfg.Name)
+	}
+	k, err = newKey(c.rand, cfg.KeyType)
+	return k, err == nil, err
+}
+
+// checkIssued verifies that the issued leaf certificate kept the pinned or
+// reused key, before it replaces the previous certificate prev.
+func checkIssued(cfg *RenewalConfig, prev []*x509.Certificate, der []byte) error {
+	if !cfg.ReuseKey && len(cfg.Pins) == 0 {
+		return nil
+	}
+	leaf, err := x509.ParseCertificate(der)
+	if err != nil {
+		return err
+	}
+	if err := checkPins(cfg.Pins, leaf.PublicKey); err != nil {
+		return err
+	}
+	if cfg.ReuseKey && len(prev) > 0 && !keyTypeChanged(cfg, prev[0]) &&
+		!bytes.Equal(prev[0].RawSubjectPublicKeyInfo, leaf.RawSubjectPublicKeyInfo) {
+		return fmt.Errorf("%w: %s was issued with a different key", ErrPinMismatch, cfg.Name)
+	}
+	return nil
+}
+
+// keyTypeChanged reports whether the certificate sets a key type the
+// previous certificate prev was not issued with, so that its key is
+// replaced even if reused.
+func keyTypeChanged(cfg *RenewalConfig, prev *x509.Certificate) bool {
+	return cfg.KeyType != "" && keyTypeOf(prev.PublicKey) != cfg.KeyType
+}
@@ -0,0 +1,103 @@
+package acme
+
+import (
+	"context"
+	"net"
+	"strings"
+	"time"
+
+	"golang.org/x/net/publicsuffix"
+)
+
+// Propagation is how a DNS challenge record is checked. Poll is the interval
+// between checks. Timeout bounds how long all resolvers may take to see the
+// record once the first one does; zero means no limit.
+type Propagation struct {
+	Poll    time.Duration
+	Timeout time.Duration
+}
+
+// PropagationProfiles are the timings used for the DNS providers recognized
+// by DetectDNSProvider, from how quickly their nameservers converge.
+var PropagationProfiles = map[string]Propagation{
+	"route53":      {Poll: 10 * time.Second, Timeout: 2 * time.Minute},
+	"cloudflare":   {Poll: 5 * time.Second, Timeout: 2 * time.Minute},
+	"googlecloud":  {Poll: 10 * time.Second, Timeout: 5 * time.Minute},
+	"azure":        {Poll: 10 * time.Second, Timeout: 5 * time.Minute},
+	"digitalocean": {Poll: 10 * time.Second, Timeout: 5 * time.Minute},
+	"aliyun":       {Poll: 10 * time.Second, Timeout: 10 * time.Minute},
+	"dnspod":       {Poll: 10 * time.Second, Timeout: 10 * time.Minute},
+	"godaddy":      {Poll: 30 * time.Second, Timeout: 20 * time.Minute},
+	"namecheap":    {Poll: time.Minute, Timeout: 30 * time.Minute},
+}
+
+// dnsProviders maps nameserver suffixes to PropagationProfiles keys.
+var dnsProviders = []struct {
+	suffix, name string
+}{
+	{".awsdns-", "route53"},
+	{".ns.cloudflare.com.", "cloudflare"},
+	{".googledomains.com.", "googlecloud"},
+	{".azure-dns.", "azure"},
+	{".digitalocean.com.", "digitalocean"},
+	{".alidns.com.", "aliyun"},
+	{".hichina.com.", "aliyun"},
+	{".dnspod.net.", "dnspod"},
+	{".domaincontrol.com.", "godaddy"},
+	{".registrar-servers.com.", "namecheap"},
+}
+
+// WithPropagation sets the timing of DNS challenge checks for all domains,
+// overriding PropagationProfiles. A zero Poll uses the WithPollInterval
+// interval.
+func WithPropagation(p Propagation) Option {
+	return func(c *Client) {
+		c.propagation = &p
+	}
+}
+
+// DetectDNSProvider returns the PropagationProfiles key of the DNS hosting
+// provider of domain, recognized by its nameservers, or an empty string.
+func DetectDNSProvider(ctx context.Context, domain string) string {
+	zone, err := publicsuffix.EffectiveTLDPlusOne(strings.TrimPrefix(domain, "*."))
+	if err != nil {
+		return ""
+	}
+	nss, err := net.DefaultResolver.LookupNS(ctx, zone)
+	if err != nil {
+		return ""
+	}
+	for _, ns := range nss {
+		host := strings.ToLower(ns.Host)
+		if !strings.HasSuffix(host, ".") {
+			host += "."
+		}
+		for _, p := range dnsProviders {
+			if strings.Contains(host, p.suffix) {
+				return p.name
+			}
+		}
+	}
+	return ""
+}
+
+// propagationFor returns the timing of DNS challenge checks for domain.
+func (c *Client) propagationFor(ctx context.Context, domain string) Propagation {
+	p := Propagation{}
+	profile, ok := c.dnsProvider.(interface{ Propagation() Propagation })
+	switch {
+	case c.propagation != nil:
+		p = *c.propagation
+	case ok:
+		p = profile.Propagation()
+	default:
+		if name := DetectDNSProvider(ctx, domain); name != "" {
+			p = PropagationProfiles[name]
+			c.log.Debugf("%s is hosted by %s, checking every %s", domain, name, p.Poll)
+		}
+	}
+	if p.Poll <= 0 {
+		p.Poll = c.pollInterval
+	}
+	return p
+}
@@ -0,0 +1,376 @@
+package acme
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path"
+	"sync"
+	"time"
+)
+
+// queueFile stores the issuance queue of a directory.
+const queueFile = "queue.json"
+
+// queueVersion is the current version of the queue file format.
+const queueVersion = 1
+
+// DefaultMaxAttempts is how often a queued request is attempted before it is
+// moved to the dead letters.
+const DefaultMaxAttempts = 3
+
+// Priorities of queued requests. Any int may be used.
+const (
+	PriorityLow    = -10
+	PriorityNormal = 0
+	PriorityHigh   = 10
+)
+
+// DefaultAging is how long a job waits before its priority is raised by one,
+// so that a steady stream of urgent jobs cannot starve bulk renewals.
+const DefaultAging = time.Hour
+
+// JobState is the state of a queued request.
+type JobState string
+
+// States of a queued request. Jobs move from pending to validating while the
+// order is authorized and to finalizing once it is ready, then to done. A
+// failed job is retried by the next ProcessQueue until it has used up its
+// attempts and is dead.
+const (
+	JobPending    JobState = "pending"
+	JobValidating JobState = "validating"
+	JobFinalizing JobState = "finalizing"
+	JobDone       JobState = "done"
+	JobFailed     JobState = "failed"
+	JobDead       JobState = "dead"
+)
+
+// Job is a request in the queue. OrderURL is the order of the attempt in
+// progress; an interrupted attempt continues with it.
+type Job struct {
+	Request
+	State    JobState  `json:"state"`
+	Attempts int       `json:"attempts"`
+	Error    string    `json:"error,omitempty"`
+	Updated  time.Time `json:"updated"`
+	OrderURL string    `json:"orderURL,omitempty"`
+}
+
+// Queue is a persistent queue of certificate requests. Every state change is
+// written to disk, so a process that crashes part way through a batch
+// resumes where it left off: a job that was in flight continues with the
+// order it had created.
+type Queue struct {
+	// MaxAttempts defaults to DefaultMaxAttempts.
+	MaxAttempts int
+	// Aging defaults to DefaultAging.
+	Aging time.Duration
+
+	mu   sync.Mutex
+	path string
+	jobs []*Job
+}
+
+// OpenQueue loads the queue stored in dir, creating an empty one if there is
+// none. Jobs that were in flight when the queue was last written are put
+// back to pending and keep their order.
+func OpenQueue(dir string) (*Queue, error) {
+	q := &Queue{path: path.Join(dir, queueFile)}
+	b, err := ioutil.ReadFile(q.path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return q, nil
+		}
+		return nil, err
+	}
+	var f struct {
+		Version int    `json:"version"`
+		Jobs    []*Job `json:"jobs"`
+	}
+	if err := json.Unmarshal(b, &f); err != nil {
+		return nil, err
+	}
+	if f.Version > queueVersion {
+		return nil, fmt.Errorf("queue file version %d is not supported", f.Version)
+	}
+	q.jobs = f.Jobs
+	for _, j := range q.jobs {
+		if j.State == JobValidating || j.State == JobFinalizing {
+			j.State = JobPending
+		}
+	}
+	return q, nil
+}
+
+// Add appends the requests to the queue as pending jobs. Nothing is added
+// if a request has an invalid domain name.
+func (q *Queue) Add(reqs ...Request) error {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	now := time.Now()
+	jobs := make([]*Job, len(reqs))
+	for i, r := range reqs {
+		d, err := normalizeDomains(r.Domains)
+		if err != nil {
+			return err
+		}
+		r.Domains = d
+		jobs[i] = &Job{Request: r, State: JobPending, Updated: now}
+	}
+	q.jobs = append(q.jobs, jobs...)
+	return q.save()
+}
+
+// Jobs returns a copy of the jobs in the queue.
+func (q *Queue) Jobs() []Job {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	jobs := make([]Job, len(q.jobs))
+	for i, j := range q.jobs {
+		jobs[i] = *j
+	}
+	return jobs
+}
+
+// Retry puts the dead jobs for the certificate name back to pending with
+// their attempts reset.
+func (q *Queue) Retry(name string) error {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	for _, j := range q.jobs {
+		if j.Name == name && j.State == JobDead {
+			j.State = JobPending
+			j.Attempts = 0
+			j.Updated = time.Now()
+		}
+	}
+	return q.save()
+}
+
+// Prune removes the jobs that are done.
+func (q *Queue) Prune() error {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	jobs := q.jobs[:0]
+	for _, j := range q.jobs {
+		if j.State != JobDone {
+			jobs = append(jobs, j)
+		}
+	}
+	q.jobs = jobs
+	return q.save()
+}
+
+// maxAttempts returns the configured number of attempts per job.
+func (q *Queue) maxAttempts() int {
+	if q.MaxAttempts > 0 {
+		return q.MaxAttempts
+	}
+	return DefaultMaxAttempts
+}
+
+// priority returns the priority of the job raised by one for every Aging it
+// has waited.
+func (q *Queue) priority(j *Job, now time.Time) int {
+	aging := q.Aging
+	if aging <= 0 {
+		aging = DefaultAging
+	}
+	return j.Priority + int(now.Sub(j.Updated)/aging)
+}
+
+// claim marks the pending or failed job not in tried with the highest
+// priority at now as validating and returns it, or nil if there is none.
+// Jobs of equal priority are claimed in the order they were added.
+func (q *Queue) claim(tried map[*Job]bool, now time.Time) (*Job, error) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	var next *Job
+	for _, j := range q.jobs {
+		if tried[j] || (j.State != JobPending && j.State != JobFailed) {
+			continue
+		}
+		if next == nil || q.priority(j, now) > q.priority(next, now) {
+			next = j
+		}
+	}
+	if next == nil {
+		return nil, nil
+	}
+	tried[next] = true
+	next.State = JobValidating
+	next.Attempts++
+	next.Updated = now
+	return next, q.save()
+}
+
+// set moves the job to the provided state at now. A job that is done or
+// failed forgets its order, so the next attempt creates a new one.
+func (q *Queue) set(j *Job, s JobState, err error, now time.Time) error {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	j.State = s
+	j.Error = ""
+	if err != nil {
+		j.Error = err.Error()
+	}
+	if s == JobDone || s == JobFailed || s == JobDead {
+		j.OrderURL = ""
+	}
+	j.Updated = now
+	return q.save()
+}
+
+// setOrder records the order created for the job.
+func (q *Queue) setOrder(j *Job, orderURL string) error {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	j.OrderURL = orderURL
+	return q.save()
+}
+
+// save writes the queue to disk. Callers must hold q.mu.
+func (q *Queue) save() error {
+	b, err := json.MarshalIndent(struct {
+		Version int    `json:"version"`
+		Jobs    []*Job `json:"jobs"`
+	}{queueVersion, q.jobs}, "", "  ")
+	if err != nil {
+		return err
+	}
+	tmp := q.path + ".tmp"
+	if err := ioutil.WriteFile(tmp, b, 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, q.path)
+}
+
+// ProcessQueue issues the pending and failed jobs in the queue with up to
+// workers at once, highest priority first. Jobs already running are not
+// preempted. Each job is attempted at most once per call. The first
+// error encountered is returned after all claimed jobs finish.
+func (c *Client) ProcessQueue(ctx context.Context, q *Queue, workers int) error {
+	if err := c.writable(); err != nil {
+		return err
+	}
+	if workers < 1 {
+		workers = 1
+	}
+	var (
+		mu    sync.Mutex
+		first error
+		wg    sync.WaitGroup
+		tried = make(map[*Job]bool)
+	)
+	fail := func(err error) {
+		mu.Lock()
+		defer mu.Unlock()
+		if first == nil {
+			first = err
+		}
+	}
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for ctx.Err() == nil {
+				j, err := q.claim(tried, c.clock.Now())
+				if err != nil {
+					fail(err)
+					return
+				}
+				if j == nil {
+					return
+				}
+				err = c.processJob(ctx, q, j)
+				state := JobDone
+				switch {
+				case err == nil:
+				case ctx.Err() != nil:
+					q.mu.Lock()
+					j.Attempts--
+					q.mu.Unlock()
+					state = JobPending
+				case j.Attempts >= q.maxAttempts():
+					state = JobDead
+				default:
+					state = JobFailed
+				}
+				if err != nil {
+					c.log.Errorf("%s: %s", j.Name, err)
+					fail(err)
+				}
+				if err := q.set(j, state, err, c.clock.Now()); err != nil {
+					fail(err)
+				}
+			}
+		}()
+	}
+	wg.Wait()
+	return first
+}
+
+// processJob issues a single job, recording its progress in the queue.
+func (c *Client) processJob(ctx context.Context, q *Queue, j *Job) (err error) {
+	ctx, op := c.operation(ctx)
+	defer func() {
+		err = op.wrap(err)
+	}()
+	release, err := c.acquire(ctx)
+	if err != nil {
+		return err
+	}
+	defer release()
+	unlease, err := c.lease(j.Dir, j.Name)
+	if err != nil {
+		return err
+	}
+	defer unlease()
+	cfg, err := inheritDefaults(j.Dir, c.newConfig(j.Name, j.Chtype, j.Domains))
+	if err != nil {
+		return err
+	}
+	defer func(start time.Time) {
+		c.record(j.Dir, cfg, start, err)
+	}(c.clock.Now())
+	ctx, cancel := c.withDeadline(ctx)
+	defer cancel()
+	if j.OrderURL != "" {
+		c.log.Infof("%s: resuming order %s", j.Name, j.OrderURL)
+		err = c.advance(ctx, j.Dir, cfg, j.OrderURL)
+	} else {
+		err = c.processOrder(ctx, q, j, cfg)
+	}
+	if err != nil {
+		if err := c.retry(ctx, j.Dir, cfg, err); err != nil {
+			return err
+		}
+	}
+	return c.finish(ctx, j.Dir, cfg)
+}
+
+// processOrder creates the order of the job, records it in the queue and
+// completes it.
+func (c *Client) processOrder(ctx context.Context, q *Queue, j *Job, cfg *RenewalConfig) error {
+	o, err := c.newOrder(ctx, j.Dir, cfg)
+	if err != nil {
+		return err
+	}
+	if err := q.setOrder(j, o.URI); err != nil {
+		return err
+	}
+	if o, err = c.completeOrder(ctx, j.Dir, cfg, o); err != nil {
+		return err
+	}
+	if err := q.set(j, JobFinalizing, nil, c.clock.Now()); err != nil {
+		return err
+	}
+	b, err := c.generateCSR(j.Dir, cfg)
+	if err != nil {
+		return err
+	}
+	return c.createCert(ctx, o, b, j.Dir, cfg)
+}
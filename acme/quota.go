@@ -0,0 +1,120 @@
+package acme
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// Quota bounds the issuances of a tenant. Zero fields are unlimited.
+type Quota struct {
+	// MaxConcurrent is the number of issuances running at once.
+	MaxConcurrent int
+	// MaxPerHour is the number of issuances started in any hour.
+	MaxPerHour int
+}
+
+// QuotaError is returned when starting an issuance would exceed a quota.
+// Tenant is empty for the global quota.
+type QuotaError struct {
+	Tenant string
+	Limit  string
+}
+
+func (e *QuotaError) Error() string {
+	if e.Tenant == "" {
+		return fmt.Sprintf("global quota of %s exceeded", e.Limit)
+	}
+	return fmt.Sprintf("quota of %s exceeded for tenant %s", e.Limit, e.Tenant)
+}
+
+// tenantKey is the context key of the tenant.
+type tenantKey struct{}
+
+// ContextWithTenant returns a context whose issuances count against the
+// quota of tenant.
+func ContextWithTenant(ctx context.Context, tenant string) context.Context {
+	return context.WithValue(ctx, tenantKey{}, tenant)
+}
+
+// TenantFromContext returns the tenant set with ContextWithTenant.
+func TenantFromContext(ctx context.Context) string {
+	t, _ := ctx.Value(tenantKey{}).(string)
+	return t
+}
+
+// WithQuota sets the quota of tenant, or the global quota if tenant is empty.
+// Issuances over quota fail with a *QuotaError instead of waiting, unlike the
+// limits set with WithMaxConcurrentOrders and WithOrderRate.
+func WithQuota(tenant string, q Quota) Option {
+	return func(c *Client) {
+		if c.quotas == nil {
+			c.quotas = make(map[string]*quotaState)
+		}
+		c.quotas[tenant] = &quotaState{quota: q}
+	}
+}
+
+// quotaState tracks the usage of a quota.
+type quotaState struct {
+	mu      sync.Mutex
+	quota   Quota
+	running int
+	starts  []time.Time
+}
+
+// check reports the limit that starting an issuance at now would exceed.
+func (s *quotaState) check(now time.Time) string {
+	if s.quota.MaxConcurrent > 0 && s.running >= s.quota.MaxConcurrent {
+		return fmt.Sprintf("%d concurrent orders", s.quota.MaxConcurrent)
+	}
+	starts := s.starts[:0]
+	for _, t := range s.starts {
+		if now.Sub(t) < time.Hour {
+			starts = append(starts, t)
+		}
+	}
+	s.starts = starts
+	if s.quota.MaxPerHour > 0 && len(s.starts) >= s.quota.MaxPerHour {
+		return fmt.Sprintf("%d orders per hour", s.quota.MaxPerHour)
+	}
+	return ""
+}
+
+// reserveQuota counts an issuance against the global quota and the quota of
+// the context's tenant. The returned function ends the issuance.
+func (c *Client) reserveQuota(ctx context.Context) (func(), error) {
+	if len(c.quotas) == 0 {
+		return func() {}, nil
+	}
+	tenants := []string{""}
+	if t := TenantFromContext(ctx); t != "" {
+		tenants = append(tenants, t)
+	}
+	// The global quota is always locked first, so the order is consistent.
+	var states []*quotaState
+	for _, t := range tenants {
+		s := c.quotas[t]
+		if s == nil {
+			continue
+		}
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		if limit := s.check(c.clock.Now()); limit != "" {
+			return nil, &QuotaError{Tenant: t, Limit: limit}
+		}
+		states = append(states, s)
+	}
+	for _, s := range states {
+		s.running++
+		s.starts = append(s.starts, c.clock.Now())
+	}
+	return func() {
+		for _, s := range states {
+			s.mu.Lock()
+			s.running--
+			s.mu.Unlock()
+		}
+	}, nil
+}
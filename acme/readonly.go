@@ -0,0 +1,86 @@
+package acme
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+)
+
+var ErrReadOnly = errors.New("client is read-only")
+
+// WithReadOnly opens the account and certificates without ever changing
+// them, for auditing and monitoring hosts. The account must already exist,
+// nothing is written to disk, and operations that would order, finalize,
+// revoke or otherwise change state at the CA fail with ErrReadOnly; only
+// POST-as-GET requests and account lookups reach the CA.
+func WithReadOnly() Option {
+	return func(c *Client) {
+		c.readOnly = true
+	}
+}
+
+// writable returns ErrReadOnly if the client is read-only.
+func (c *Client) writable() error {
+	if c.readOnly {
+		return ErrReadOnly
+	}
+	return nil
+}
+
+// readOnlyTransport refuses ACME requests that could change state at the CA.
+type readOnlyTransport struct {
+	next http.RoundTripper
+}
+
+func (t *readOnlyTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if req.Method != "POST" || req.Body == nil {
+		return t.next.RoundTrip(req)
+	}
+	b, err := ioutil.ReadAll(req.Body)
+	req.Body.Close()
+	if err != nil {
+		return nil, err
+	}
+	if !readOnlyRequest(b) {
+		return nil, fmt.Errorf("%w: refusing POST to %s", ErrReadOnly, req.URL)
+	}
+	req.Body = ioutil.NopCloser(bytes.NewReader(b))
+	return t.next.RoundTrip(req)
+}
+
+// readOnlyRequest reports whether the JWS body is a POST-as-GET request or
+// a lookup of an existing account.
+func readOnlyRequest(body []byte) bool {
+	payload, ok := jwsPayload(body)
+	if !ok {
+		return false
+	}
+	if payload == "" {
+		return true
+	}
+	b, err := base64.RawURLEncoding.DecodeString(payload)
+	if err != nil {
+		return false
+	}
+	var lookup map[string]interface{}
+	if err := json.Unmarshal(b, &lookup); err != nil {
+		return false
+	}
+	return len(lookup) == 1 && lookup["onlyReturnExisting"] == true
+}
+
+// jwsPayload returns the encoded payload of a flattened JWS request body,
+// which is empty for POST-as-GET requests.
+func jwsPayload(body []byte) (string, bool) {
+	var jws struct {
+		Payload string `json:"payload"`
+	}
+	if err := json.Unmarshal(body, &jws); err != nil {
+		return "", false
+	}
+	return jws.Payload, true
+}
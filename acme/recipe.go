@@ -0,0 +1,97 @@
+package acme
+
+import (
+	"errors"
+	"fmt"
+)
+
+var ErrUnknownRecipe = errors.New("unknown deploy recipe")
+
+// Recipe deploys certificates to a server: where the certificate and key
+// are copied to, how the server is reloaded, and the configuration that
+// makes it use them, with %s standing for the certificate and key paths.
+type Recipe struct {
+	CertPath string
+	KeyPath  string
+	Reload   ReloadTarget
+	Config   string
+}
+
+// Recipes are the deploy recipes of mail servers, by server name. The
+// certificate file holds the full chain, as all of them expect. Exim reads
+// the key as its own user, so the key must be made readable to it, e.g.
+// by a setgid directory of group Debian-exim.
+var Recipes = map[string]Recipe{
+	"postfix": {
+		CertPath: "/etc/postfix/tls/{{.Name}}.crt",
+		KeyPath:  "/etc/postfix/tls/{{.Name}}.key",
+		Reload:   ReloadTarget{Command: []string{"postfix", "reload"}},
+		Config:   "smtpd_tls_chain_files = %[2]s, %[1]s\n",
+	},
+	"dovecot": {
+		CertPath: "/etc/dovecot/tls/{{.Name}}.crt",
+		KeyPath:  "/etc/dovecot/tls/{{.Name}}.key",
+		Reload:   ReloadTarget{Command: []string{"doveadm", "reload"}},
+		Config:   "ssl_cert = <%s\nssl_key = <%s\n",
+	},
+	"exim": {
+		CertPath: "/etc/exim4/tls/{{.Name}}.crt",
+		KeyPath:  "/etc/exim4/tls/{{.Name}}.key",
+		Reload:   ReloadTarget{Unit: "exim4"},
+		Config:   "tls_certificate = %s\ntls_privatekey = %s\n",
+	},
+}
+
+// ApplyRecipe sets the output paths of cfg to those of the named recipe,
+// unless cfg already sets them, and returns the recipe. Its Reload target
+// is meant for a Reloader watching the copied files.
+func ApplyRecipe(cfg *RenewalConfig, name string) (*Recipe, error) {
+	r, ok := Recipes[name]
+	if !ok {
+		return nil, fmt.Errorf("%w %q", ErrUnknownRecipe, name)
+	}
+	if cfg.CertPath == "" {
+		cfg.CertPath = r.CertPath
+	}
+	if cfg.KeyPath == "" {
+		cfg.KeyPath = r.KeyPath
+	}
+	return &r, nil
+}
+
+// paths returns the deployed certificate and key paths of cfg. Templates
+// using the serial number or validity of the certificate cannot be resolved
+// ahead of issuance.
+func (r *Recipe) paths(cfg *RenewalConfig) (cert, key string, err error) {
+	o := &Output{Name: cfg.Name, Domains: cfg.Domains}
+	if len(cfg.Domains) > 0 {
+		o.Domain = cfg.Domains[0]
+	}
+	if cert, err = outputPath("", cfg.CertPath, o); err != nil {
+		return "", "", err
+	}
+	if key, err = outputPath("", cfg.KeyPath, o); err != nil {
+		return "", "", err
+	}
+	return cert, key, nil
+}
+
+// ServerConfig returns the server configuration using the certificate of
+// cfg deployed by the recipe.
+func (r *Recipe) ServerConfig(cfg *RenewalConfig) (string, error) {
+	cert, key, err := r.paths(cfg)
+	if err != nil {
+		return "", err
+	}
+	return fmt.Sprintf(r.Config, cert, key), nil
+}
+
+// Reloader returns a Reloader that reloads the server when the
+// certificate of cfg is deployed.
+func (r *Recipe) Reloader(cfg *RenewalConfig) (*Reloader, error) {
+	cert, key, err := r.paths(cfg)
+	if err != nil {
+		return nil, err
+	}
+	return &Reloader{Files: []string{cert, key}, Targets: []ReloadTarget{r.Reload}}, nil
+}
@@ -0,0 +1,130 @@
+package acme
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// txtRecords tracks the TXT values being solved per record name. An order
+// for example.com and *.example.com needs two values at
+// _acme-challenge.example.com at once, so each solver waits until all values
+// for its name are visible before any of them is validated.
+type txtRecords struct {
+	mu     sync.Mutex
+	values map[string]map[string]int
+}
+
+// add registers value for the record name and returns a function removing
+// it again. The same value may be added more than once.
+func (t *txtRecords) add(name, value string) func() {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.values == nil {
+		t.values = make(map[string]map[string]int)
+	}
+	if t.values[name] == nil {
+		t.values[name] = make(map[string]int)
+	}
+	t.values[name][value]++
+	return func() {
+		t.mu.Lock()
+		defer t.mu.Unlock()
+		if t.values[name][value]--; t.values[name][value] == 0 {
+			delete(t.values[name], value)
+		}
+		if len(t.values[name]) == 0 {
+			delete(t.values, name)
+		}
+	}
+}
+
+// want returns the distinct values registered for the record name.
+func (t *txtRecords) want(name string) []string {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	values := make([]string, 0, len(t.values[name]))
+	for v := range t.values[name] {
+		values = append(values, v)
+	}
+	return values
+}
+
+// waitTXT adds the TXT record name with value next to any other values, or
+// asks for it to be added without a DNSProvider, and waits until all values
+// being solved for name are visible to every resolver checked by VerifyTXT
+// or WithDoH, or, if the resolvers cache the record's absence, to its
+// authoritative nameservers.
+// Checks follow the Propagation of the DNS provider. The returned function
+// releases the value once the challenge is done. If ctx ends or the
+// propagation times out first, the error includes the last mismatch.
+func (c *Client) waitTXT(ctx context.Context, name, value string) (func(), error) {
+	release := c.txt.add(name, value)
+	if others := len(c.txt.want(name)) - 1; others > 0 {
+		c.log.Infof("%s needs %d more TXT values at the same time", name, others)
+	}
+	cleanup, err := c.present(ctx, name, value)
+	if err != nil {
+		release()
+		return nil, err
+	}
+	done := func() {
+		cleanup()
+		release()
+	}
+	p := c.propagationFor(ctx, name)
+	var (
+		last error
+		neg  *negativeCache
+		seen time.Time
+	)
+	for {
+		want := c.txt.want(name)
+		results, err := c.verifyTXT(ctx, name, want...)
+		if err == nil || c.checkNegative(ctx, &neg, name, want) {
+			return done, nil
+		}
+		if seen.IsZero() && anySeen(results) {
+			seen = c.clock.Now()
+		}
+		if last == nil || err.Error() != last.Error() {
+			c.log.Debugf("waiting for %s", err)
+		}
+		last = err
+		if p.Timeout > 0 && !seen.IsZero() && c.clock.Now().Sub(seen) > p.Timeout {
+			done()
+			return nil, fmt.Errorf("%s did not propagate within %s: %w", name, p.Timeout, last)
+		}
+		select {
+		case <-c.clock.After(p.Poll):
+		case <-ctx.Done():
+			done()
+			return nil, fmt.Errorf("%w: %w", ctx.Err(), last)
+		}
+	}
+}
+
+// anySeen reports whether a resolver saw all expected values.
+func anySeen(results []TXTResult) bool {
+	for _, r := range results {
+		if r.Error == "" && len(r.Missing) == 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// containsAll reports whether all of want are in have.
+func containsAll(have, want []string) bool {
+	set := make(map[string]bool, len(have))
+	for _, v := range have {
+		set[v] = true
+	}
+	for _, v := range want {
+		if !set[v] {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,170 @@
+package acme
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+// Default timings of a Reloader.
+const (
+	defaultReloadInterval = 10 * time.Second
+	defaultReloadDebounce = 5 * time.Second
+)
+
+// Reloader watches deployed certificate files and reloads the services
+// serving them once the files have settled, so that renewals reach nginx,
+// haproxy or postfix without a restart. The files of a certificate are the
+// Targets of its inventory Item.
+type Reloader struct {
+	// Files are the files to watch. They are polled, so they may be
+	// replaced by renames or symlink changes.
+	Files []string
+	// Targets are reloaded after the files change.
+	Targets []ReloadTarget
+	// Interval is how often the files are polled, default 10s.
+	Interval time.Duration
+	// Debounce is how long the files must be unchanged before the
+	// targets are reloaded, default 5s, so that a certificate and its key
+	// written one after the other cause a single reload.
+	Debounce time.Duration
+}
+
+// ReloadTarget is a service reloaded by a Reloader. Exactly one of PIDFile,
+// Unit or Command is set.
+type ReloadTarget struct {
+	// PIDFile holds the process ID to send Signal to, e.g.
+	// /run/nginx.pid. Signal defaults to SIGHUP.
+	PIDFile string
+	Signal  os.Signal
+	// Unit is a systemd unit reloaded with systemctl reload.
+	Unit string
+	// Command is run to reload the service, e.g. postfix reload.
+	Command []string
+}
+
+// String describes the target for logging.
+func (t ReloadTarget) String() string {
+	switch {
+	case t.PIDFile != "":
+		return t.PIDFile
+	case t.Unit != "":
+		return t.Unit
+	}
+	return strings.Join(t.Command, " ")
+}
+
+// reload reloads the service.
+func (t ReloadTarget) reload(ctx context.Context) error {
+	switch {
+	case t.PIDFile != "":
+		b, err := ioutil.ReadFile(t.PIDFile)
+		if err != nil {
+			return err
+		}
+		pid, err := strconv.Atoi(strings.TrimSpace(string(b)))
+		if err != nil {
+			return fmt.Errorf("%s: invalid pid: %w", t.PIDFile, err)
+		}
+		p, err := os.FindProcess(pid)
+		if err != nil {
+			return err
+		}
+		sig := t.Signal
+		if sig == nil {
+			sig = syscall.SIGHUP
+		}
+		return p.Signal(sig)
+	case t.Unit != "":
+		return run(ctx, "systemctl", "reload", t.Unit)
+	case len(t.Command) > 0:
+		return run(ctx, t.Command[0], t.Command[1:]...)
+	}
+	return fmt.Errorf("reload target has no pid file, unit or command")
+}
+
+// run runs a command, including its output in the error if it fails.
+func run(ctx context.Context, name string, args ...string) error {
+	out, err := exec.CommandContext(ctx, name, args...).CombinedOutput()
+	if err != nil {
+		return fmt.Errorf("%s: %w: %s", name, err, strings.TrimSpace(string(out)))
+	}
+	return nil
+}
+
+// fileState identifies a version of a watched file.
+type fileState struct {
+	modTime time.Time
+	size    int64
+}
+
+// state returns the current version of the files. Missing files are
+// recorded as such.
+func (r *Reloader) state() map[string]fileState {
+	s := make(map[string]fileState, len(r.Files))
+	for _, f := range r.Files {
+		if fi, err := os.Stat(f); err == nil {
+			s[f] = fileState{modTime: fi.ModTime(), size: fi.Size()}
+		}
+	}
+	return s
+}
+
+// Run watches the files until ctx is done, reloading the targets after
+// every change. Failed reloads are logged and do not stop the watch.
+func (r *Reloader) Run(ctx context.Context) error {
+	log := logrus.WithField("context", "reload")
+	interval, debounce := r.Interval, r.Debounce
+	if interval <= 0 {
+		interval = defaultReloadInterval
+	}
+	if debounce <= 0 {
+		debounce = defaultReloadDebounce
+	}
+	last := r.state()
+	var changed time.Time
+	for {
+		select {
+		case <-time.After(interval):
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+		cur := r.state()
+		if !sameState(last, cur) {
+			last, changed = cur, time.Now()
+			continue
+		}
+		if changed.IsZero() || time.Since(changed) < debounce {
+			continue
+		}
+		changed = time.Time{}
+		for _, t := range r.Targets {
+			if err := t.reload(ctx); err != nil {
+				log.Errorf("reloading %s: %s", t, err)
+				continue
+			}
+			log.Infof("reloaded %s", t)
+		}
+	}
+}
+
+// sameState reports whether two versions of the files are equal.
+func sameState(a, b map[string]fileState) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for f, s := range a {
+		if t, ok := b[f]; !ok || !t.modTime.Equal(s.modTime) || t.size != s.size {
+			return false
+		}
+	}
+	return true
+}
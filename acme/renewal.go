@@ -0,0 +1,412 @@
+package acme
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"path"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+// DefaultRenewBefore is how long before expiry RenewAll renews certificates.
+const DefaultRenewBefore = 30 * 24 * time.Hour
+
+// ExpiringSoon is how long before expiry RenewAll announces certificates it
+// did not renew with EventCertificateExpiring.
+const ExpiringSoon = 7 * 24 * time.Hour
+
+// renewalVersion is the current version of the renewal file format.
+const renewalVersion = 1
+
+// RenewalConfig holds the parameters a certificate was issued with. It is
+// stored next to the certificate as <name>.renewal.json so Renew can repeat
+// the issuance without the original arguments.
+type RenewalConfig struct {
+	Version    int       `json:"version"`
+	Name       string    `json:"name"`
+	Chtype     string    `json:"chtype"`
+	Domains    []string  `json:"domains"`
+	MustStaple bool      `json:"mustStaple,omitempty"`
+	ClientAuth bool      `json:"clientAuth,omitempty"`
+	IssuedAt   time.Time `json:"issuedAt"`
+	// IssuedChtype is the challenge type of the last issuance.
+	IssuedChtype string `json:"issuedChtype,omitempty"`
+	// Revoked is set when the current certificate was revoked, making it
+	// due for renewal.
+	Revoked bool `json:"revoked,omitempty"`
+
+	// ReuseKey keeps the private key across renewals. Pins, if set, are
+	// the SPKIPin values the key must match; they imply ReuseKey and a
+	// renewal fails rather than change the key.
+	ReuseKey bool     `json:"reuseKey,omitempty"`
+	Pins     []string `json:"pins,omitempty"`
+
+	// KeyType is the type of the certificate key, e.g. KeyRSA2048 for
+	// legacy clients; DefaultKeyType if empty.
+	KeyType string `json:"keyType,omitempty"`
+	// DualKey also maintains a certificate for the same names with a key
+	// of the other algorithm, for clients without ECDSA support. It is
+	// issued and renewed along with the certificate and stored beside it
+	// as <name>.rsa, or <name>.ecdsa for a certificate with an RSA key.
+	// A companion that fails is retried by RenewAll on its own.
+	DualKey bool `json:"dualKey,omitempty"`
+
+	// Schedule is a cron expression limiting when RenewAll renews the
+	// certificate, e.g. "* 2-3 * * *" for a 02:00-04:00 maintenance
+	// window. See ParseCron. Certificates expiring within ScheduleMargin
+	// are renewed regardless.
+	Schedule string `json:"schedule,omitempty"`
+
+	// CertPath and KeyPath are text/template paths the certificate and
+	// key are copied to after each issuance, in addition to dir. They are
+	// executed with an Output; relative paths are relative to dir.
+	CertPath string `json:"certPath,omitempty"`
+	KeyPath  string `json:"keyPath,omitempty"`
+
+	// RenewBefore is the renewal window of the certificate, used by
+	// RenewAll when it is not given one.
+	RenewBefore time.Duration `json:"renewBefore,omitempty"`
+
+	// Labels are free-form and used to select certificates in RenewAll.
+	Labels map[string]string `json:"labels,omitempty"`
+
+	// NoMustStaple, NoClientAuth, NoReuseKey and NoDualKey turn the
+	// parameter off for this certificate when Defaults turn it on.
+	NoMustStaple bool `json:"noMustStaple,omitempty"`
+	NoClientAuth bool `json:"noClientAuth,omitempty"`
+	NoReuseKey   bool `json:"noReuseKey,omitempty"`
+	NoDualKey    bool `json:"noDualKey,omitempty"`
+
+	// own holds the certificate's parameters without the inherited
+	// Defaults.
+	own *RenewalConfig
+}
+
+// renewalPath returns the location of the renewal file for name.
+func renewalPath(dir, name string) string {
+	return path.Join(dir, name+".renewal.json")
+}
+
+// LoadRenewalConfig reads the renewal parameters of the certificate name.
+func LoadRenewalConfig(dir, name string) (*RenewalConfig, error) {
+	b, err := ioutil.ReadFile(renewalPath(dir, name))
+	if err != nil {
+		return nil, err
+	}
+	cfg := &RenewalConfig{}
+	if err := json.Unmarshal(b, cfg); err != nil {
+		return nil, err
+	}
+	if cfg.Version > renewalVersion {
+		return nil, fmt.Errorf("renewal file version %d is not supported", cfg.Version)
+	}
+	return cfg, nil
+}
+
+// Save writes the renewal parameters to dir.
+func (r *RenewalConfig) Save(dir string) error {
+	r.Version = renewalVersion
+	b, err := json.MarshalIndent(r, "", "  ")
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(renewalPath(dir, r.Name), b, 0644)
+}
+
+// issued records a successful issuance at the provided time.
+func (r *RenewalConfig) issued(dir string, now time.Time) error {
+	r.IssuedAt = now
+	r.IssuedChtype = r.Chtype
+	r.Revoked = false
+	if r.own != nil {
+		r.own.IssuedAt, r.own.IssuedChtype = r.IssuedAt, r.IssuedChtype
+		r.own.Revoked = false
+		return r.own.Save(dir)
+	}
+	return r.Save(dir)
+}
+
+// Reconfigure changes the stored renewal parameters of the certificate name.
+// The new parameters take effect on the next Renew.
+func Reconfigure(dir, name string, fn func(*RenewalConfig)) error {
+	cfg, err := LoadRenewalConfig(dir, name)
+	if err != nil {
+		return err
+	}
+	fn(cfg)
+	cfg.Name = name
+	return cfg.Save(dir)
+}
+
+// Renew issues the certificate name again with its stored parameters.
+func (c *Client) Renew(ctx context.Context, dir, name string) error {
+	cfg, err := LoadRenewalConfig(dir, name)
+	if err != nil {
+		return err
+	}
+	return c.issue(ctx, dir, cfg)
+}
+
+// RenewOptions selects the certificates renewed by RenewAll.
+type RenewOptions struct {
+	// Names limits renewal to the named certificates.
+	Names []string
+	// Selector limits renewal to certificates with all of these labels.
+	Selector map[string]string
+	// Force renews certificates regardless of their expiry.
+	Force bool
+	// Before renews certificates expiring within this duration. It
+	// defaults to the RenewBefore of each certificate, then to
+	// DefaultRenewBefore.
+	Before time.Duration
+	// Concurrency is the number of certificates renewed at once, default
+	// 1. The client-wide limits set with WithMaxConcurrentOrders and
+	// WithOrderRate still apply.
+	Concurrency int
+	// Freezes are periods during which due certificates are only renewed
+	// if they would expire before the freeze ends. The others are
+	// reported as deferred and announced with EventRenewalDeferred.
+	Freezes []Freeze
+}
+
+// RenewResult reports the outcome of renewing a single certificate.
+type RenewResult struct {
+	Name     string
+	Renewed  bool
+	Deferred bool
+	// Skipped is set if the certificate was being issued by another
+	// process holding its lease, see WithLease.
+	Skipped  bool
+	Err      error
+	Duration time.Duration
+}
+
+// RenewReport summarizes a RenewAll run.
+type RenewReport struct {
+	Results  []RenewResult
+	Renewed  int
+	Deferred int
+	Skipped  int
+	Failed   int
+	Elapsed  time.Duration
+}
+
+// Certificates returns the names of all certificates in dir that have
+// renewal parameters.
+func Certificates(dir string) ([]string, error) {
+	matches, err := filepath.Glob(filepath.Join(dir, "*.renewal.json"))
+	if err != nil {
+		return nil, err
+	}
+	names := make([]string, len(matches))
+	for i, m := range matches {
+		names[i] = strings.TrimSuffix(filepath.Base(m), ".renewal.json")
+	}
+	return names, nil
+}
+
+// matches reports whether the certificate is selected by the options.
+func (o *RenewOptions) matches(cfg *RenewalConfig) bool {
+	if len(o.Names) > 0 {
+		found := false
+		for _, n := range o.Names {
+			if n == cfg.Name {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+	for k, v := range o.Selector {
+		if cfg.Labels[k] != v {
+			return false
+		}
+	}
+	return true
+}
+
+// ScheduleMargin is how close to expiry a certificate is renewed even
+// outside its Schedule, so a window that never comes cannot let it lapse.
+const ScheduleMargin = 3 * 24 * time.Hour
+
+// scheduled reports whether the schedule of the certificate in dir allows
+// renewing it at the provided time.
+func (o *RenewOptions) scheduled(dir string, cfg *RenewalConfig, now time.Time) (bool, error) {
+	if o.Force || cfg.Schedule == "" {
+		return true, nil
+	}
+	cron, err := ParseCron(cfg.Schedule)
+	if err != nil {
+		return false, err
+	}
+	if cron.Matches(now) {
+		return true, nil
+	}
+	chain, err := loadChain(dir, cfg.Name)
+	return err == nil && chain[0].NotAfter.Sub(now) < ScheduleMargin, nil
+}
+
+// due reports whether the certificate in dir should be renewed at the
+// provided time.
+func (o *RenewOptions) due(dir string, cfg *RenewalConfig, now time.Time) bool {
+	if o.Force || cfg.Revoked {
+		return true
+	}
+	chain, err := loadChain(dir, cfg.Name)
+	if err != nil {
+		return true
+	}
+	before := o.Before
+	if before <= 0 {
+		before = cfg.RenewBefore
+	}
+	if before <= 0 {
+		before = DefaultRenewBefore
+	}
+	return chain[0].NotAfter.Sub(now) < before
+}
+
+// RenewAll renews the certificates in dir selected by opts that are due for
+// renewal, and reports the outcome for each selected certificate.
+func (c *Client) RenewAll(ctx context.Context, dir string, opts RenewOptions) (*RenewReport, error) {
+	names, err := Certificates(dir)
+	if err != nil {
+		return nil, err
+	}
+	defaults, err := LoadDefaults(dir)
+	if err != nil {
+		return nil, err
+	}
+	workers := opts.Concurrency
+	if workers < 1 {
+		workers = 1
+	}
+	var (
+		start  = c.clock.Now()
+		report = &RenewReport{}
+		mu     sync.Mutex
+		wg     sync.WaitGroup
+		sem    = make(chan struct{}, workers)
+	)
+	for _, name := range names {
+		cfg, err := LoadRenewalConfig(dir, name)
+		if err != nil {
+			mu.Lock()
+			report.add(RenewResult{Name: name, Err: err})
+			mu.Unlock()
+			continue
+		}
+		cfg = defaults.inherit(cfg)
+		if !opts.matches(cfg) {
+			continue
+		}
+		if ok, err := opts.scheduled(dir, cfg, c.clock.Now()); err != nil || !ok {
+			if err == nil {
+				c.log.Debugf("%s is outside its renewal schedule", name)
+			}
+			mu.Lock()
+			report.add(RenewResult{Name: name, Err: err})
+			mu.Unlock()
+			continue
+		}
+		// A companion that failed earlier is issued without the
+		// certificate itself.
+		due := opts.due(dir, cfg, c.clock.Now())
+		companion := !due && cfg.DualKey && opts.due(dir, companionConfig(cfg), c.clock.Now())
+		if companion {
+			c.log.Debugf("companion of %s is due for renewal", name)
+		} else if !due {
+			c.log.Debugf("%s is not due for renewal", name)
+			mu.Lock()
+			report.add(RenewResult{Name: name})
+			mu.Unlock()
+			continue
+		}
+		if f, ok := opts.deferred(dir, name, c.clock.Now()); ok {
+			c.log.Warnf("%s is due for renewal but deferred by the freeze until %s: %s", name, f.End, f.Reason)
+			c.emit(EventRenewalDeferred, name, cfg.Domains, nil)
+			mu.Lock()
+			report.add(RenewResult{Name: name, Deferred: true})
+			mu.Unlock()
+			continue
+		}
+		wg.Add(1)
+		sem <- struct{}{}
+		go func(cfg *RenewalConfig, companion bool) {
+			defer func() {
+				<-sem
+				wg.Done()
+			}()
+			t := c.clock.Now()
+			var err error
+			if companion {
+				err = c.renewCompanion(ctx, dir, cfg)
+			} else {
+				err = c.issue(ctx, dir, cfg)
+			}
+			skipped := errors.Is(err, ErrLeaseHeld)
+			if skipped {
+				c.log.Debugf("%s is being renewed elsewhere", cfg.Name)
+				err = nil
+			}
+			mu.Lock()
+			defer mu.Unlock()
+			report.add(RenewResult{
+				Name:     cfg.Name,
+				Renewed:  err == nil && !skipped,
+				Skipped:  skipped,
+				Err:      err,
+				Duration: c.clock.Now().Sub(t),
+			})
+		}(cfg, companion)
+	}
+	wg.Wait()
+	c.announceExpiring(dir, report)
+	report.Elapsed = c.clock.Now().Sub(start)
+	c.log.Infof("renewed %d of %d certificates in %s, %d failed, %d deferred, %d skipped",
+		report.Renewed, len(report.Results), report.Elapsed, report.Failed, report.Deferred, report.Skipped)
+	return report, nil
+}
+
+// add records a result in the report. Callers must serialize access.
+func (r *RenewReport) add(res RenewResult) {
+	r.Results = append(r.Results, res)
+	if res.Renewed {
+		r.Renewed++
+	}
+	if res.Deferred {
+		r.Deferred++
+	}
+	if res.Skipped {
+		r.Skipped++
+	}
+	if res.Err != nil {
+		r.Failed++
+	}
+}
+
+// announceExpiring emits EventCertificateExpiring for the certificates of the
+// report that were not renewed and expire within ExpiringSoon.
+func (c *Client) announceExpiring(dir string, report *RenewReport) {
+	now := c.clock.Now()
+	for _, r := range report.Results {
+		if r.Renewed {
+			continue
+		}
+		chain, err := loadChain(dir, r.Name)
+		if err != nil || len(chain) == 0 {
+			continue
+		}
+		if chain[0].NotAfter.Sub(now) < ExpiringSoon {
+			c.log.Warnf("%s expires at %s", r.Name, chain[0].NotAfter)
+			c.emit(EventCertificateExpiring, r.Name, certNames(chain[0]), nil)
+		}
+	}
+}
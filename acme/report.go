@@ -0,0 +1,124 @@
+package acme
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+// Expiry describes when a certificate expires and when it is renewed.
+type Expiry struct {
+	Name     string    `json:"name"`
+	Domains  []string  `json:"domains"`
+	NotAfter time.Time `json:"notAfter"`
+	// RenewAt is the start of the renewal window.
+	RenewAt time.Time `json:"renewAt"`
+	// Error is set if the certificate could not be read.
+	Error string `json:"error,omitempty"`
+}
+
+// ExpiryReport returns the expiry of every certificate in dir, soonest
+// first. before is the renewal window and defaults to the RenewBefore of
+// each certificate, then to DefaultRenewBefore.
+// The result can be encoded as JSON or passed to WriteICS.
+func ExpiryReport(dir string, before time.Duration) ([]Expiry, error) {
+	names, err := Certificates(dir)
+	if err != nil {
+		return nil, err
+	}
+	defaults, err := LoadDefaults(dir)
+	if err != nil {
+		return nil, err
+	}
+	report := make([]Expiry, 0, len(names))
+	for _, name := range names {
+		e := Expiry{Name: name}
+		window := before
+		if cfg, err := LoadRenewalConfig(dir, name); err == nil {
+			cfg = defaults.inherit(cfg)
+			e.Domains = cfg.Domains
+			if window <= 0 {
+				window = cfg.RenewBefore
+			}
+		}
+		if window <= 0 {
+			window = DefaultRenewBefore
+		}
+		chain, err := loadChain(dir, name)
+		if err != nil {
+			e.Error = err.Error()
+		} else {
+			e.NotAfter = chain[0].NotAfter
+			e.RenewAt = e.NotAfter.Add(-window)
+		}
+		report = append(report, e)
+	}
+	sort.SliceStable(report, func(i, j int) bool {
+		return report[i].NotAfter.Before(report[j].NotAfter)
+	})
+	return report, nil
+}
+
+// WriteICS writes the report as an iCalendar feed with a renewal window
+// event and an expiry event per certificate, for subscribing to in a
+// calendar. Certificates that could not be read are left out.
+func WriteICS(w io.Writer, report []Expiry) error {
+	bw := bufio.NewWriter(w)
+	stamp := time.Now().UTC().Format(icsTime)
+	line := func(s string) {
+		// Lines longer than 75 octets are folded as RFC 5545 requires,
+		// without splitting a UTF-8 sequence.
+		for len(s) > 75 {
+			n := 75
+			for n > 1 && !utf8.RuneStart(s[n]) {
+				n--
+			}
+			bw.WriteString(s[:n] + "\r\n")
+			s = " " + s[n:]
+		}
+		bw.WriteString(s + "\r\n")
+	}
+	line("BEGIN:VCALENDAR")
+	line("VERSION:2.0")
+	line("PRODID:-//fireflyst//letsencrypt//EN")
+	line("X-WR-CALNAME:Certificate renewals")
+	for _, e := range report {
+		if e.Error != "" {
+			continue
+		}
+		desc := icsEscape(strings.Join(e.Domains, ", "))
+		for _, ev := range []struct {
+			uid, summary string
+			start, end   time.Time
+		}{
+			{"renew", "Renew " + e.Name, e.RenewAt, e.NotAfter},
+			{"expiry", e.Name + " expires", e.NotAfter, e.NotAfter.Add(time.Hour)},
+		} {
+			line("BEGIN:VEVENT")
+			line(fmt.Sprintf("UID:%s-%s-%d@letsencrypt", icsEscape(e.Name), ev.uid, e.NotAfter.Unix()))
+			line("DTSTAMP:" + stamp)
+			line("DTSTART:" + ev.start.UTC().Format(icsTime))
+			line("DTEND:" + ev.end.UTC().Format(icsTime))
+			line("SUMMARY:" + icsEscape(ev.summary))
+			line("DESCRIPTION:" + desc)
+			line("END:VEVENT")
+		}
+	}
+	line("END:VCALENDAR")
+	return bw.Flush()
+}
+
+// icsTime is the UTC date-time format of iCalendar.
+const icsTime = "20060102T150405Z"
+
+// icsEscape escapes an iCalendar text value.
+var icsEscape = strings.NewReplacer(
+	`\`, `\\`,
+	";", `\;`,
+	",", `\,`,
+	"\n", `\n`,
+).Replace
@@ -0,0 +1,112 @@
+package acme
+
+import (
+	"context"
+	"crypto"
+	"errors"
+	"fmt"
+	"os"
+	"path"
+
+	"golang.org/x/crypto/acme"
+)
+
+// RevocationReason is the reason given for revoking a certificate, one of
+// the CRLReason codes of RFC 5280 that RFC 8555 §7.6 accepts.
+type RevocationReason int
+
+// Revocation reasons. Let's Encrypt only accepts ReasonUnspecified,
+// ReasonKeyCompromise, ReasonAffiliationChanged, ReasonSuperseded and
+// ReasonCessationOfOperation. removeFromCRL (8) is left out, as it only
+// appears in delta CRLs and is never a reason for revoking.
+const (
+	ReasonUnspecified          RevocationReason = 0
+	ReasonKeyCompromise        RevocationReason = 1
+	ReasonCACompromise         RevocationReason = 2
+	ReasonAffiliationChanged   RevocationReason = 3
+	ReasonSuperseded           RevocationReason = 4
+	ReasonCessationOfOperation RevocationReason = 5
+	ReasonCertificateHold      RevocationReason = 6
+	ReasonPrivilegeWithdrawn   RevocationReason = 9
+	ReasonAACompromise         RevocationReason = 10
+)
+
+var ErrInvalidReason = errors.New("invalid revocation reason")
+
+// reasonNames are the names of the revocation reasons in RFC 5280.
+var reasonNames = map[RevocationReason]string{
+	ReasonUnspecified:          "unspecified",
+	ReasonKeyCompromise:        "keyCompromise",
+	ReasonCACompromise:         "cACompromise",
+	ReasonAffiliationChanged:   "affiliationChanged",
+	ReasonSuperseded:           "superseded",
+	ReasonCessationOfOperation: "cessationOfOperation",
+	ReasonCertificateHold:      "certificateHold",
+	ReasonPrivilegeWithdrawn:   "privilegeWithdrawn",
+	ReasonAACompromise:         "aACompromise",
+}
+
+func (r RevocationReason) String() string {
+	if n, ok := reasonNames[r]; ok {
+		return n
+	}
+	return fmt.Sprintf("RevocationReason(%d)", int(r))
+}
+
+// RevokeCertificate revokes the certificate name in dir with the account
+// key. The account must have issued the certificate or hold valid
+// authorizations for all of its names. The certificate is left in place
+// and becomes due, so the next RenewAll replaces it. With
+// ReasonKeyCompromise, the key is moved aside to <name>.key.compromised
+// and the replacement gets a new key even if ReuseKey is set.
+func (c *Client) RevokeCertificate(ctx context.Context, dir, name string, reason RevocationReason) error {
+	return c.revoke(ctx, dir, name, nil, reason)
+}
+
+// RevokeCertificateWithKey revokes the certificate name in dir with its
+// own private key, <name>.key, instead of the account key. This works for
+// any certificate whose key is at hand, e.g. one issued to another account
+// after the key was compromised.
+func (c *Client) RevokeCertificateWithKey(ctx context.Context, dir, name string, reason RevocationReason) error {
+	k, err := loadCertKey(dir, name+".key")
+	if err != nil {
+		return err
+	}
+	return c.revoke(ctx, dir, name, k, reason)
+}
+
+// revoke revokes the certificate name in dir, signing the request with key
+// or, if nil, the account key.
+func (c *Client) revoke(ctx context.Context, dir, name string, key crypto.Signer, reason RevocationReason) error {
+	if err := c.writable(); err != nil {
+		return err
+	}
+	if _, ok := reasonNames[reason]; !ok {
+		return fmt.Errorf("%w: %d", ErrInvalidReason, int(reason))
+	}
+	certs, err := loadChain(dir, name)
+	if err != nil {
+		return err
+	}
+	if len(certs) == 0 {
+		return ErrNoCertificate
+	}
+	if err := c.ca().RevokeCert(ctx, key, certs[0].Raw, acme.CRLReasonCode(reason)); err != nil {
+		return fmt.Errorf("revoking %s: %w", name, err)
+	}
+	c.log.Infof("revoked certificate %s (%s)", name, reason)
+	c.emit(EventCertificateRevoked, name, certNames(certs[0]), nil)
+	if reason == ReasonKeyCompromise {
+		p := path.Join(dir, name+".key")
+		if err := os.Rename(p, p+".compromised"); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+	}
+	err = Reconfigure(dir, name, func(cfg *RenewalConfig) {
+		cfg.Revoked = true
+	})
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return nil
+}
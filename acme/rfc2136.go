@@ -0,0 +1,226 @@
+package acme
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+	"math/rand"
+	"net"
+	"strings"
+	"time"
+
+	"golang.org/x/net/dns/dnsmessage"
+	"golang.org/x/net/publicsuffix"
+)
+
+// DNS constants of dynamic updates (RFC 2136) and TSIG (RFC 8945).
+const (
+	opcodeUpdate = 5
+	classNone    = 254
+	classAny     = 255
+	typeTSIG     = 250
+	tsigFudge    = 300
+)
+
+// TSIG algorithms supported by RFC2136.
+const (
+	TSIGHMACSHA256 = "hmac-sha256."
+	TSIGHMACSHA512 = "hmac-sha512."
+)
+
+var ErrUpdateRefused = errors.New("dns update refused")
+
+// RFC2136 is a DNSProvider sending dynamic updates (RFC 2136) signed with
+// TSIG to the primary nameserver of the zone, as supported by BIND, Knot
+// and PowerDNS.
+type RFC2136 struct {
+	// Nameserver is the host:port of the primary nameserver.
+	Nameserver string
+	// Zone is the zone of the records; if empty, the registrable domain
+	// of the record name is used.
+	Zone string
+	// TSIGKey is the name of the key and TSIGSecret its base64 encoded
+	// secret. TSIGAlgorithm defaults to TSIGHMACSHA256.
+	TSIGKey       string
+	TSIGSecret    string
+	TSIGAlgorithm string
+}
+
+// Propagation checks the record often: the update is applied by the
+// primary nameserver at once and only needs to reach the secondaries.
+func (p *RFC2136) Propagation() Propagation {
+	return Propagation{Poll: 5 * time.Second, Timeout: 5 * time.Minute}
+}
+
+// Present adds the TXT record.
+func (p *RFC2136) Present(ctx context.Context, name, value string) error {
+	return p.update(ctx, name, value, dnsmessage.ClassINET, challengeTTL)
+}
+
+// Cleanup removes the TXT record.
+func (p *RFC2136) Cleanup(ctx context.Context, name, value string) error {
+	return p.update(ctx, name, value, classNone, 0)
+}
+
+// update adds the TXT record name with value, or deletes it if class is
+// NONE (RFC 2136, 2.5.4).
+func (p *RFC2136) update(ctx context.Context, name, value string, class dnsmessage.Class, ttl uint32) error {
+	zone := p.Zone
+	if zone == "" {
+		var err error
+		if zone, err = publicsuffix.EffectiveTLDPlusOne(strings.TrimSuffix(name, ".")); err != nil {
+			return err
+		}
+	}
+	id := uint16(rand.Intn(1 << 16))
+	b := dnsmessage.NewBuilder(nil, dnsmessage.Header{ID: id, OpCode: opcodeUpdate})
+	if err := b.StartQuestions(); err != nil {
+		return err
+	}
+	zoneName, err := dnsmessage.NewName(fqdn(zone))
+	if err != nil {
+		return err
+	}
+	if err := b.Question(dnsmessage.Question{Name: zoneName, Type: dnsmessage.TypeSOA, Class: dnsmessage.ClassINET}); err != nil {
+		return err
+	}
+	if err := b.StartAuthorities(); err != nil {
+		return err
+	}
+	rrName, err := dnsmessage.NewName(fqdn(name))
+	if err != nil {
+		return err
+	}
+	h := dnsmessage.ResourceHeader{Name: rrName, Type: dnsmessage.TypeTXT, Class: class, TTL: ttl}
+	if err := b.TXTResource(h, dnsmessage.TXTResource{TXT: []string{value}}); err != nil {
+		return err
+	}
+	msg, err := b.Finish()
+	if err != nil {
+		return err
+	}
+	if p.TSIGKey != "" {
+		if msg, err = p.signTSIG(msg, id, time.Now()); err != nil {
+			return err
+		}
+	}
+	resp, err := exchangeTCP(ctx, p.Nameserver, msg)
+	if err != nil {
+		return err
+	}
+	var parser dnsmessage.Parser
+	rh, err := parser.Start(resp)
+	if err != nil {
+		return err
+	}
+	if rh.ID != id {
+		return fmt.Errorf("%s: response id mismatch", p.Nameserver)
+	}
+	if rh.RCode != dnsmessage.RCodeSuccess {
+		return fmt.Errorf("%w: %s: %s", ErrUpdateRefused, p.Nameserver, rh.RCode)
+	}
+	return nil
+}
+
+// signTSIG appends a TSIG record signing msg (RFC 8945, 4.3).
+func (p *RFC2136) signTSIG(msg []byte, id uint16, now time.Time) ([]byte, error) {
+	alg := p.TSIGAlgorithm
+	if alg == "" {
+		alg = TSIGHMACSHA256
+	}
+	var newHash func() hash.Hash
+	switch alg {
+	case TSIGHMACSHA256:
+		newHash = sha256.New
+	case TSIGHMACSHA512:
+		newHash = sha512.New
+	default:
+		return nil, fmt.Errorf("unsupported TSIG algorithm %q", alg)
+	}
+	secret, err := base64.StdEncoding.DecodeString(p.TSIGSecret)
+	if err != nil {
+		return nil, fmt.Errorf("invalid TSIG secret: %w", err)
+	}
+	keyName := wireName(p.TSIGKey)
+	algName := wireName(alg)
+	var signed [6]byte
+	binary.BigEndian.PutUint16(signed[0:], uint16(now.Unix()>>32))
+	binary.BigEndian.PutUint32(signed[2:], uint32(now.Unix()))
+
+	mac := hmac.New(newHash, secret)
+	mac.Write(msg)
+	mac.Write(keyName)
+	mac.Write([]byte{0, classAny, 0, 0, 0, 0})
+	mac.Write(algName)
+	mac.Write(signed[:])
+	mac.Write([]byte{tsigFudge >> 8, tsigFudge & 0xff, 0, 0, 0, 0})
+	sum := mac.Sum(nil)
+
+	rdata := append([]byte(nil), algName...)
+	rdata = append(rdata, signed[:]...)
+	rdata = append(rdata, tsigFudge>>8, tsigFudge&0xff, byte(len(sum)>>8), byte(len(sum)))
+	rdata = append(rdata, sum...)
+	rdata = append(rdata, byte(id>>8), byte(id), 0, 0, 0, 0)
+
+	out := append([]byte(nil), msg...)
+	out = append(out, keyName...)
+	out = append(out, 0, typeTSIG, 0, classAny, 0, 0, 0, 0, byte(len(rdata)>>8), byte(len(rdata)))
+	out = append(out, rdata...)
+	binary.BigEndian.PutUint16(out[10:], binary.BigEndian.Uint16(out[10:])+1)
+	return out, nil
+}
+
+// exchangeTCP sends a DNS message to server over TCP and returns the
+// response.
+func exchangeTCP(ctx context.Context, server string, msg []byte) ([]byte, error) {
+	var d net.Dialer
+	conn, err := d.DialContext(ctx, "tcp", server)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+	if deadline, ok := ctx.Deadline(); ok {
+		conn.SetDeadline(deadline)
+	}
+	if _, err := conn.Write(append([]byte{byte(len(msg) >> 8), byte(len(msg))}, msg...)); err != nil {
+		return nil, err
+	}
+	var n [2]byte
+	if _, err := io.ReadFull(conn, n[:]); err != nil {
+		return nil, err
+	}
+	resp := make([]byte, binary.BigEndian.Uint16(n[:]))
+	if _, err := io.ReadFull(conn, resp); err != nil {
+		return nil, err
+	}
+	return resp, nil
+}
+
+// fqdn returns name with a trailing dot.
+func fqdn(name string) string {
+	if strings.HasSuffix(name, ".") {
+		return name
+	}
+	return name + "."
+}
+
+// wireName encodes a domain name in canonical wire format: lower case and
+// uncompressed.
+func wireName(name string) []byte {
+	var b []byte
+	for _, label := range strings.Split(strings.TrimSuffix(strings.ToLower(name), "."), ".") {
+		if label == "" {
+			continue
+		}
+		b = append(b, byte(len(label)))
+		b = append(b, label...)
+	}
+	return append(b, 0)
+}
@@ -0,0 +1,292 @@
+package acme
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Route 53 API endpoint and the region its requests are signed for.
+const (
+	route53API    = "https://route53.amazonaws.com/2013-04-01"
+	route53Region = "us-east-1"
+)
+
+// Route53 is a DNSProvider for zones hosted by Amazon Route 53. The
+// credentials need the route53:ChangeResourceRecordSets and
+// route53:ListResourceRecordSets permissions, and
+// route53:ListHostedZonesByName unless HostedZoneID is set.
+type Route53 struct {
+	AccessKeyID     string
+	SecretAccessKey string
+	// SessionToken is set for temporary credentials.
+	SessionToken string
+	// HostedZoneID is the zone of the records; if empty, it is looked up
+	// by name among the public zones.
+	HostedZoneID string
+
+	mu    sync.Mutex
+	zones map[string]string
+}
+
+// route53Change is a ChangeResourceRecordSets request for a TXT record.
+type route53Change struct {
+	XMLName xml.Name        `xml:"https://route53.amazonaws.com/doc/2013-04-01/ ChangeResourceRecordSetsRequest"`
+	Action  string          `xml:"ChangeBatch>Changes>Change>Action"`
+	Name    string          `xml:"ChangeBatch>Changes>Change>ResourceRecordSet>Name"`
+	Type    string          `xml:"ChangeBatch>Changes>Change>ResourceRecordSet>Type"`
+	TTL     int             `xml:"ChangeBatch>Changes>Change>ResourceRecordSet>TTL"`
+	Records []route53Record `xml:"ChangeBatch>Changes>Change>ResourceRecordSet>ResourceRecords>ResourceRecord"`
+}
+
+// route53Record is a value of a record set.
+type route53Record struct {
+	Value string `xml:"Value"`
+}
+
+// Propagation returns the timing of the Route 53 profile.
+func (p *Route53) Propagation() Propagation {
+	return PropagationProfiles["route53"]
+}
+
+// Present adds the TXT record. Route 53 replaces record sets as a whole,
+// so the value is merged with the values currently at name, including
+// those written by other clients.
+func (p *Route53) Present(ctx context.Context, name, value string) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	values, _, err := p.records(ctx, name)
+	if err != nil {
+		return err
+	}
+	v := strconv.Quote(value)
+	for _, cur := range values {
+		if cur == v {
+			return nil
+		}
+	}
+	return p.change(ctx, "UPSERT", name, challengeTTL, append(values, v))
+}
+
+// Cleanup removes the TXT record, keeping the other values currently at
+// name.
+func (p *Route53) Cleanup(ctx context.Context, name, value string) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	values, ttl, err := p.records(ctx, name)
+	if err != nil {
+		return err
+	}
+	v := strconv.Quote(value)
+	var rest []string
+	for _, cur := range values {
+		if cur != v {
+			rest = append(rest, cur)
+		}
+	}
+	switch {
+	case len(rest) == len(values):
+		return nil
+	case len(rest) > 0:
+		return p.change(ctx, "UPSERT", name, challengeTTL, rest)
+	}
+	// A deletion must match the record set exactly.
+	return p.change(ctx, "DELETE", name, ttl, values)
+}
+
+// records returns the quoted values and the TTL of the TXT record set
+// name. Called with p.mu held.
+func (p *Route53) records(ctx context.Context, name string) ([]string, int, error) {
+	zone, err := p.zone(ctx, name)
+	if err != nil {
+		return nil, 0, err
+	}
+	var list struct {
+		Sets []struct {
+			Name   string   `xml:"Name"`
+			Type   string   `xml:"Type"`
+			TTL    int      `xml:"TTL"`
+			Values []string `xml:"ResourceRecords>ResourceRecord>Value"`
+		} `xml:"ResourceRecordSets>ResourceRecordSet"`
+	}
+	q := url.Values{"name": {name}, "type": {"TXT"}, "maxitems": {"1"}}
+	if err := p.do(ctx, "GET", "/hostedzone/"+zone+"/rrset?"+q.Encode(), nil, &list); err != nil {
+		return nil, 0, err
+	}
+	// The list starts at name and continues with the following sets.
+	if len(list.Sets) == 0 || list.Sets[0].Type != "TXT" ||
+		!strings.EqualFold(strings.TrimSuffix(list.Sets[0].Name, "."), strings.TrimSuffix(name, ".")) {
+		return nil, 0, nil
+	}
+	return list.Sets[0].Values, list.Sets[0].TTL, nil
+}
+
+// change applies action to the TXT record set name with ttl and the quoted
+// values. Called with p.mu held.
+func (p *Route53) change(ctx context.Context, action, name string, ttl int, values []string) error {
+	zone, err := p.zone(ctx, name)
+	if err != nil {
+		return err
+	}
+	ch := route53Change{Action: action, Name: name, Type: "TXT", TTL: ttl}
+	for _, v := range values {
+		ch.Records = append(ch.Records, route53Record{Value: v})
+	}
+	b, err := xml.Marshal(ch)
+	if err != nil {
+		return err
+	}
+	return p.do(ctx, "POST", "/hostedzone/"+zone+"/rrset", append([]byte(xml.Header), b...), nil)
+}
+
+// zone returns the ID of the public hosted zone of the record name, the
+// closest parent of name. Called with p.mu held.
+func (p *Route53) zone(ctx context.Context, name string) (string, error) {
+	if p.HostedZoneID != "" {
+		return p.HostedZoneID, nil
+	}
+	for d := strings.TrimSuffix(name, "."); strings.Contains(d, "."); d = d[strings.IndexByte(d, '.')+1:] {
+		if id, ok := p.zones[d]; ok {
+			return id, nil
+		}
+		var list struct {
+			Zones []struct {
+				ID      string `xml:"Id"`
+				Name    string `xml:"Name"`
+				Private bool   `xml:"Config>PrivateZone"`
+			} `xml:"HostedZones>HostedZone"`
+		}
+		q := url.Values{"dnsname": {d}, "maxitems": {"1"}}
+		if err := p.do(ctx, "GET", "/hostedzonesbyname?"+q.Encode(), nil, &list); err != nil {
+			return "", err
+		}
+		if len(list.Zones) > 0 && strings.EqualFold(list.Zones[0].Name, d+".") && !list.Zones[0].Private {
+			id := strings.TrimPrefix(list.Zones[0].ID, "/hostedzone/")
+			if p.zones == nil {
+				p.zones = make(map[string]string)
+			}
+			p.zones[d] = id
+			return id, nil
+		}
+	}
+	return "", fmt.Errorf("route53: no hosted zone for %s", name)
+}
+
+// do sends a signed API request with body and decodes the XML response
+// into out, if not nil.
+func (p *Route53) do(ctx context.Context, method, path string, body []byte, out interface{}) error {
+	req, err := http.NewRequest(method, route53API+path, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", "text/xml")
+	}
+	cred := awsCredentials{p.AccessKeyID, p.SecretAccessKey, p.SessionToken}
+	signAWS(req, body, time.Now(), cred, route53Region, "route53")
+	resp, err := http.DefaultClient.Do(req.WithContext(ctx))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	b, err := ioutil.ReadAll(io.LimitReader(resp.Body, 1<<20))
+	if err != nil {
+		return err
+	}
+	if resp.StatusCode >= 300 {
+		var e struct {
+			Code    string `xml:"Error>Code"`
+			Message string `xml:"Error>Message"`
+		}
+		if xml.Unmarshal(b, &e) == nil && e.Code != "" {
+			return fmt.Errorf("route53: %s %s: %s: %s", method, path, e.Code, e.Message)
+		}
+		return fmt.Errorf("route53: %s %s: unexpected status %s", method, path, resp.Status)
+	}
+	if out != nil {
+		return xml.Unmarshal(b, out)
+	}
+	return nil
+}
+
+// awsCredentials are the credentials of AWS API requests. SessionToken is
+// set for temporary credentials.
+type awsCredentials struct {
+	AccessKeyID     string
+	SecretAccessKey string
+	SessionToken    string
+}
+
+// signAWS adds an AWS Signature Version 4 for service in region to the
+// request.
+func signAWS(req *http.Request, body []byte, now time.Time, cred awsCredentials, region, service string) {
+	date := now.UTC().Format("20060102T150405Z")
+	day := date[:8]
+	req.Header.Set("X-Amz-Date", date)
+	headers := map[string]string{"host": req.URL.Host, "x-amz-date": date}
+	for _, h := range []string{"Content-Type", "X-Amz-Target"} {
+		if v := req.Header.Get(h); v != "" {
+			headers[strings.ToLower(h)] = v
+		}
+	}
+	if cred.SessionToken != "" {
+		req.Header.Set("X-Amz-Security-Token", cred.SessionToken)
+		headers["x-amz-security-token"] = cred.SessionToken
+	}
+	names := make([]string, 0, len(headers))
+	for k := range headers {
+		names = append(names, k)
+	}
+	sort.Strings(names)
+	var canonHeaders strings.Builder
+	for _, k := range names {
+		canonHeaders.WriteString(k + ":" + headers[k] + "\n")
+	}
+	signed := strings.Join(names, ";")
+	uri := req.URL.EscapedPath()
+	if uri == "" {
+		uri = "/"
+	}
+	canon := strings.Join([]string{
+		req.Method,
+		uri,
+		strings.Replace(req.URL.Query().Encode(), "+", "%20", -1),
+		canonHeaders.String(),
+		signed,
+		sha256Hex(body),
+	}, "\n")
+	scope := day + "/" + region + "/" + service + "/aws4_request"
+	toSign := "AWS4-HMAC-SHA256\n" + date + "\n" + scope + "\n" + sha256Hex([]byte(canon))
+	k := []byte("AWS4" + cred.SecretAccessKey)
+	for _, s := range []string{day, region, service, "aws4_request"} {
+		k = hmacSHA256(k, s)
+	}
+	req.Header.Set("Authorization", fmt.Sprintf("AWS4-HMAC-SHA256 Credential=%s/%s, SignedHeaders=%s, Signature=%s",
+		cred.AccessKeyID, scope, signed, hex.EncodeToString(hmacSHA256(k, toSign))))
+}
+
+// sha256Hex returns the hex encoded SHA-256 hash of b.
+func sha256Hex(b []byte) string {
+	sum := sha256.Sum256(b)
+	return hex.EncodeToString(sum[:])
+}
+
+// hmacSHA256 returns the HMAC-SHA256 of s with key.
+func hmacSHA256(key []byte, s string) []byte {
+	mac := hmac.New(sha256.New, key)
+	io.WriteString(mac, s)
+	return mac.Sum(nil)
+}
@@ -0,0 +1,180 @@
+package acme
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"os"
+	"path"
+	"strings"
+
+	"golang.org/x/crypto/ssh"
+)
+
+var ErrHostKeyMismatch = errors.New("ssh host key does not match")
+
+// SCP deploys a certificate to a host that cannot run the client itself,
+// copying the certificate and key over SSH with the scp protocol and then
+// running Command. Call Deploy from a WithEventHook hook on
+// EventCertificateIssued to deploy every issuance.
+type SCP struct {
+	// Addr is the host:port of the SSH server; the port defaults to 22.
+	Addr string
+	User string
+	// Signer authenticates the user, see ssh.ParsePrivateKey.
+	Signer ssh.Signer
+	// HostKey pins the host key of the server by its SHA256 fingerprint
+	// as printed by ssh-keygen -l, e.g. "SHA256:uNiVz...". It is required.
+	HostKey string
+	// CertPath and KeyPath are the remote paths of the certificate and
+	// key. The key is written with mode 0600.
+	CertPath string
+	KeyPath  string
+	// Command, if set, is run on the host after copying, e.g.
+	// "systemctl reload nginx".
+	Command string
+}
+
+// Deploy copies the certificate name from dir to the host.
+func (s *SCP) Deploy(ctx context.Context, dir, name string) error {
+	if s.HostKey == "" {
+		return fmt.Errorf("%s: no host key pinned", s.Addr)
+	}
+	client, err := s.dial(ctx)
+	if err != nil {
+		return err
+	}
+	defer client.Close()
+	done := make(chan struct{})
+	defer close(done)
+	go func() {
+		select {
+		case <-ctx.Done():
+			client.Close()
+		case <-done:
+		}
+	}()
+	for _, f := range []struct {
+		remote, ext string
+		mode        os.FileMode
+	}{
+		{s.CertPath, ".crt", 0644},
+		{s.KeyPath, ".key", 0600},
+	} {
+		if f.remote == "" {
+			continue
+		}
+		b, err := ioutil.ReadFile(path.Join(dir, name+f.ext))
+		if err != nil {
+			return err
+		}
+		if err := scpCopy(client, f.remote, f.mode, b); err != nil {
+			return fmt.Errorf("%s: copying %s: %w", s.Addr, f.remote, err)
+		}
+	}
+	if s.Command == "" {
+		return nil
+	}
+	session, err := client.NewSession()
+	if err != nil {
+		return err
+	}
+	defer session.Close()
+	if out, err := session.CombinedOutput(s.Command); err != nil {
+		return fmt.Errorf("%s: %s: %w: %s", s.Addr, s.Command, err, strings.TrimSpace(string(out)))
+	}
+	return nil
+}
+
+// dial connects to the host, verifying its host key.
+func (s *SCP) dial(ctx context.Context) (*ssh.Client, error) {
+	addr := s.Addr
+	if _, _, err := net.SplitHostPort(addr); err != nil {
+		addr = net.JoinHostPort(addr, "22")
+	}
+	var d net.Dialer
+	conn, err := d.DialContext(ctx, "tcp", addr)
+	if err != nil {
+		return nil, err
+	}
+	config := &ssh.ClientConfig{
+		User: s.User,
+		Auth: []ssh.AuthMethod{ssh.PublicKeys(s.Signer)},
+		HostKeyCallback: func(_ string, _ net.Addr, key ssh.PublicKey) error {
+			if fp := ssh.FingerprintSHA256(key); fp != s.HostKey {
+				return fmt.Errorf("%w: %s", ErrHostKeyMismatch, fp)
+			}
+			return nil
+		},
+	}
+	c, chans, reqs, err := ssh.NewClientConn(conn, addr, config)
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+	return ssh.NewClient(c, chans, reqs), nil
+}
+
+// scpCopy writes b to the remote file with mode using the sink side of
+// the scp protocol.
+func scpCopy(client *ssh.Client, remote string, mode os.FileMode, b []byte) error {
+	session, err := client.NewSession()
+	if err != nil {
+		return err
+	}
+	defer session.Close()
+	stdin, err := session.StdinPipe()
+	if err != nil {
+		return err
+	}
+	stdout, err := session.StdoutPipe()
+	if err != nil {
+		return err
+	}
+	if err := session.Start("scp -t " + shellQuote(remote)); err != nil {
+		return err
+	}
+	r := bufio.NewReader(stdout)
+	if err := scpAck(r); err != nil {
+		return err
+	}
+	if _, err := fmt.Fprintf(stdin, "C%04o %d %s\n", mode.Perm(), len(b), path.Base(remote)); err != nil {
+		return err
+	}
+	if err := scpAck(r); err != nil {
+		return err
+	}
+	if _, err := stdin.Write(append(b, 0)); err != nil {
+		return err
+	}
+	if err := scpAck(r); err != nil {
+		return err
+	}
+	stdin.Close()
+	return session.Wait()
+}
+
+// scpAck reads the response of the remote scp to the last message.
+func scpAck(r *bufio.Reader) error {
+	c, err := r.ReadByte()
+	if err != nil {
+		return err
+	}
+	if c == 0 {
+		return nil
+	}
+	msg, err := r.ReadString('\n')
+	if err != nil && err != io.EOF {
+		return err
+	}
+	return fmt.Errorf("scp: %s", strings.TrimSpace(msg))
+}
+
+// shellQuote quotes s for a POSIX shell.
+func shellQuote(s string) string {
+	return "'" + strings.Replace(s, "'", `'\''`, -1) + "'"
+}
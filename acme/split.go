@@ -0,0 +1,85 @@
+package acme
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// MaxSANs is the largest number of domain names Let's Encrypt allows in a
+// single certificate.
+const MaxSANs = 100
+
+// Grouping splits a list of domain names into the lists of the separate
+// certificates they are issued in.
+type Grouping func(domains []string) [][]string
+
+// SplitDomains returns a Grouping that sorts and deduplicates the domain
+// names and cuts them into groups of at most max names. The same list always
+// results in the same groups.
+func SplitDomains(max int) Grouping {
+	if max < 1 {
+		max = MaxSANs
+	}
+	return func(domains []string) [][]string {
+		d := make([]string, 0, len(domains))
+		seen := make(map[string]bool)
+		for _, s := range domains {
+			s = strings.ToLower(s)
+			if !seen[s] {
+				seen[s] = true
+				d = append(d, s)
+			}
+		}
+		sort.Strings(d)
+		var groups [][]string
+		for len(d) > max {
+			groups = append(groups, d[:max:max])
+			d = d[max:]
+		}
+		if len(d) > 0 {
+			groups = append(groups, d)
+		}
+		return groups
+	}
+}
+
+// splitConcurrency is how many certificates CreateSplit issues at once when
+// the client has no WithMaxConcurrentOrders limit.
+const splitConcurrency = 4
+
+// splitName returns the certificate name of the i-th of n groups.
+func splitName(name string, i, n int) string {
+	if n == 1 {
+		return name
+	}
+	return fmt.Sprintf("%s-%d", name, i+1)
+}
+
+// CreateSplit creates as many certificates as needed to cover the domain
+// names, grouped by group or by SplitDomains(MaxSANs) if group is nil. The
+// certificates are named name-1, name-2, ... unless a single one suffices.
+// At most as many certificates as WithMaxConcurrentOrders allows, or four
+// without it, are issued at once. The names of the
+// certificates are returned along with the first error.
+func (c *Client) CreateSplit(ctx context.Context, dir, name, chtype string, group Grouping, domains ...string) ([]string, error) {
+	if group == nil {
+		group = SplitDomains(MaxSANs)
+	}
+	groups := group(domains)
+	if len(groups) == 0 {
+		return nil, ErrNoDomains
+	}
+	reqs := make([]Request, len(groups))
+	names := make([]string, len(groups))
+	for i, g := range groups {
+		names[i] = splitName(name, i, len(groups))
+		reqs[i] = Request{Dir: dir, Name: names[i], Chtype: chtype, Domains: g}
+	}
+	workers := splitConcurrency
+	if c.orders != nil {
+		workers = cap(c.orders)
+	}
+	return names, c.CreateBatch(ctx, reqs, workers, nil)
+}
@@ -0,0 +1,88 @@
+package acme
+
+import (
+	"errors"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// listenFdsStart is the first file descriptor passed by systemd.
+const listenFdsStart = 3
+
+var ErrNoSystemdListener = errors.New("no listener passed by systemd")
+
+var (
+	systemdOnce      sync.Once
+	systemdListeners map[string][]net.Listener
+	systemdErr       error
+)
+
+// SystemdListeners returns the sockets passed to the process by systemd
+// socket activation (sd_listen_fds), keyed by their FileDescriptorName. Sockets
+// without a name are keyed by "unknown". The environment is only read once and
+// then cleared so that child processes do not inherit it.
+func SystemdListeners() (map[string][]net.Listener, error) {
+	systemdOnce.Do(func() {
+		systemdListeners, systemdErr = listenFds()
+	})
+	return systemdListeners, systemdErr
+}
+
+// listenFds converts the file descriptors passed by systemd into listeners.
+func listenFds() (map[string][]net.Listener, error) {
+	defer func() {
+		os.Unsetenv("LISTEN_PID")
+		os.Unsetenv("LISTEN_FDS")
+		os.Unsetenv("LISTEN_FDNAMES")
+	}()
+	pid, err := strconv.Atoi(os.Getenv("LISTEN_PID"))
+	if err != nil || pid != os.Getpid() {
+		return nil, nil
+	}
+	n, err := strconv.Atoi(os.Getenv("LISTEN_FDS"))
+	if err != nil || n <= 0 {
+		return nil, nil
+	}
+	names := strings.Split(os.Getenv("LISTEN_FDNAMES"), ":")
+	listeners := make(map[string][]net.Listener)
+	for i := 0; i < n; i++ {
+		name := "unknown"
+		if i < len(names) && names[i] != "" {
+			name = names[i]
+		}
+		f := os.NewFile(uintptr(listenFdsStart+i), name)
+		l, err := net.FileListener(f)
+		f.Close()
+		if err != nil {
+			return nil, err
+		}
+		listeners[name] = append(listeners[name], l)
+	}
+	return listeners, nil
+}
+
+// SystemdListener returns the first socket passed by systemd with the provided
+// name, e.g. "http" for the HTTP-01 server or "tls-alpn" for the TLS-ALPN-01
+// server. The unit should set FileDescriptorName= accordingly. The sockets
+// are served with http01.Solver's Listener and NewListenerFrom:
+//
+//	l, err := acme.SystemdListener("http")
+//	...
+//	c, err := acme.New(ctx, dir, "account", "", acme.WithHTTPSolver(&http01.Solver{Listener: l}))
+//	...
+//	l, err = acme.SystemdListener("tls-alpn")
+//	...
+//	tl, err := c.NewListenerFrom(ctx, l, dir, "example", acme.ChallengeTLSALPN, "example.com")
+func SystemdListener(name string) (net.Listener, error) {
+	listeners, err := SystemdListeners()
+	if err != nil {
+		return nil, err
+	}
+	if len(listeners[name]) == 0 {
+		return nil, ErrNoSystemdListener
+	}
+	return listeners[name][0], nil
+}
@@ -0,0 +1,117 @@
+package acme
+
+import (
+	"context"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+const (
+	// DefaultPollInterval is how often challenge self-checks are retried.
+	DefaultPollInterval = 10 * time.Second
+	// DefaultMaxRetryAfter bounds the Retry-After values honored from the CA.
+	DefaultMaxRetryAfter = time.Minute
+)
+
+// WithPollInterval sets how often the challenge self-checks (HTTP file and
+// DNS TXT record) are retried, and how often orders and authorizations are
+// polled when the CA sends no Retry-After, rounded up to whole seconds. It
+// must be positive; New fails otherwise.
+func WithPollInterval(d time.Duration) Option {
+	return func(c *Client) {
+		c.pollInterval = d
+	}
+}
+
+// WithMaxRetryAfter caps the Retry-After delay honored when polling the CA,
+// protecting against pathological server values.
+func WithMaxRetryAfter(d time.Duration) Option {
+	return func(c *Client) {
+		c.maxRetryAfter = d
+	}
+}
+
+// WithDeadline bounds the total time a single issuance may take. Zero, the
+// default, means no deadline beyond the caller's context.
+func WithDeadline(d time.Duration) Option {
+	return func(c *Client) {
+		c.deadline = d
+	}
+}
+
+// withDeadline applies the issuance deadline, if any, to ctx.
+func (c *Client) withDeadline(ctx context.Context) (context.Context, context.CancelFunc) {
+	if c.deadline <= 0 {
+		return context.WithCancel(ctx)
+	}
+	return c.withTimeout(ctx, c.deadline)
+}
+
+// withTimeout works like context.WithTimeout but measures d on the clock of
+// the client. With a clock other than the system clock, ctx.Err reports
+// context.Canceled once d passes, with context.DeadlineExceeded as the
+// cause.
+func (c *Client) withTimeout(ctx context.Context, d time.Duration) (context.Context, context.CancelFunc) {
+	if _, ok := c.clock.(systemClock); ok {
+		return context.WithTimeout(ctx, d)
+	}
+	ctx, cancel := context.WithCancelCause(ctx)
+	expired := c.clock.After(d)
+	go func() {
+		select {
+		case <-expired:
+			cancel(context.DeadlineExceeded)
+		case <-ctx.Done():
+		}
+	}()
+	return ctx, func() { cancel(context.Canceled) }
+}
+
+// wait blocks for the poll interval or until the context is done.
+func (c *Client) wait(ctx context.Context) error {
+	select {
+	case <-c.clock.After(c.pollInterval):
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// retryAfterTransport rewrites Retry-After headers longer than max, and
+// adds one of poll to successful responses without, which sets the
+// interval at which the acme package polls orders and authorizations.
+type retryAfterTransport struct {
+	next  http.RoundTripper
+	max   time.Duration
+	poll  time.Duration
+	clock Clock
+}
+
+// RoundTrip implements http.RoundTripper.
+func (t *retryAfterTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	resp, err := t.next.RoundTrip(req)
+	if err != nil {
+		return resp, err
+	}
+	v := resp.Header.Get("Retry-After")
+	if v == "" {
+		if t.poll > 0 && req.Method == "POST" && resp.StatusCode == http.StatusOK {
+			resp.Header.Set("Retry-After", strconv.Itoa(int((t.poll+time.Second-1)/time.Second)))
+		}
+		return resp, nil
+	}
+	if t.max <= 0 {
+		return resp, nil
+	}
+	var d time.Duration
+	if n, err := strconv.Atoi(v); err == nil {
+		d = time.Duration(n) * time.Second
+	} else if at, err := http.ParseTime(v); err == nil {
+		d = at.Sub(t.clock.Now())
+	}
+	if d > t.max {
+		resp.Header.Set("Retry-After", strconv.Itoa(int(t.max/time.Second)))
+	}
+	return resp, nil
+}
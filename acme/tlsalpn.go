@@ -0,0 +1,121 @@
+package acme
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"fmt"
+	"net"
+	"strings"
+	"sync"
+
+	"golang.org/x/crypto/acme"
+)
+
+// TLSALPNChallenge returns the tls-alpn-01 challenge of the authorization.
+func TLSALPNChallenge(auth *acme.Authorization) (*acme.Challenge, error) {
+	for _, c := range auth.Challenges {
+		if c.Type == "tls-alpn-01" {
+			return c, nil
+		}
+	}
+	return nil, ErrNoChallenges
+}
+
+// alpnCerts holds the tls-alpn-01 certificates of the challenges being
+// solved, by domain name.
+type alpnCerts struct {
+	mu sync.RWMutex
+	m  map[string]*tls.Certificate
+}
+
+// put makes a certificate available for its domain name.
+func (a *alpnCerts) put(domain string, cert *tls.Certificate) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if a.m == nil {
+		a.m = make(map[string]*tls.Certificate)
+	}
+	a.m[strings.ToLower(domain)] = cert
+}
+
+// remove forgets the certificate of a domain name once its challenge is
+// done.
+func (a *alpnCerts) remove(domain string) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	delete(a.m, strings.ToLower(domain))
+}
+
+// get returns the certificate for a domain name.
+func (a *alpnCerts) get(domain string) (*tls.Certificate, bool) {
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+	cert, ok := a.m[strings.ToLower(domain)]
+	return cert, ok
+}
+
+// SolveTLSALPN serves the tls-alpn-01 certificate for the challenge through
+// GetCertificate, waits until it is served for domain on port 443 and asks
+// the CA to validate it. The certificate is removed when SolveTLSALPN
+// returns. Unless a server on port 443 uses GetCertificate of c, nothing
+// answers the handshakes and SolveTLSALPN waits until ctx is done.
+func (c *Client) SolveTLSALPN(ctx context.Context, chal *acme.Challenge, domain string) error {
+	c.log.Debugf("attempting TLS-ALPN challenge on %s", domain)
+	cert, err := c.ca().TLSALPN01ChallengeCert(chal.Token, domain)
+	if err != nil {
+		return err
+	}
+	c.alpn.put(domain, &cert)
+	defer c.alpn.remove(domain)
+	for !servesALPN(ctx, domain, cert.Certificate[0]) {
+		if err := c.wait(ctx); err != nil {
+			return err
+		}
+	}
+	return c.accept(ctx, chal)
+}
+
+// servesALPN reports whether domain answers a tls-alpn-01 handshake with
+// the certificate der.
+func servesALPN(ctx context.Context, domain string, der []byte) bool {
+	d := tls.Dialer{
+		NetDialer: &net.Dialer{Timeout: dialTimeout},
+		Config: &tls.Config{
+			ServerName:         domain,
+			NextProtos:         []string{acme.ALPNProto},
+			InsecureSkipVerify: true,
+		},
+	}
+	conn, err := d.DialContext(ctx, "tcp", net.JoinHostPort(domain, "443"))
+	if err != nil {
+		return false
+	}
+	defer conn.Close()
+	state := conn.(*tls.Conn).ConnectionState()
+	return state.NegotiatedProtocol == acme.ALPNProto &&
+		len(state.PeerCertificates) > 0 && bytes.Equal(state.PeerCertificates[0].Raw, der)
+}
+
+// GetCertificate returns a tls.Config.GetCertificate function that answers
+// tls-alpn-01 validation handshakes with the challenge certificates of
+// this client and passes every other handshake to next, so the challenge
+// can be solved by a server that only listens on port 443. The
+// configuration must also offer acme.ALPNProto in NextProtos:
+//
+//	config := acme.DefaultTLSConfig(c.GetCertificate(getCertificate))
+//	config.NextProtos = append(config.NextProtos, "acme-tls/1")
+func (c *Client) GetCertificate(next func(*tls.ClientHelloInfo) (*tls.Certificate, error)) func(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+	return func(hello *tls.ClientHelloInfo) (*tls.Certificate, error) {
+		if len(hello.SupportedProtos) == 1 && hello.SupportedProtos[0] == acme.ALPNProto {
+			if cert, ok := c.alpn.get(strings.TrimSuffix(hello.ServerName, ".")); ok {
+				return cert, nil
+			}
+			return nil, fmt.Errorf("no tls-alpn-01 challenge for %q", hello.ServerName)
+		}
+		if next == nil {
+			return nil, ErrNoServerName
+		}
+		return next(hello)
+	}
+}
@@ -0,0 +1,108 @@
+package acme
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/asn1"
+	"encoding/binary"
+	"io/ioutil"
+	"os"
+	"path"
+	"time"
+
+	"golang.org/x/crypto/ocsp"
+)
+
+// sctListOID is the certificate extension embedding the signed certificate
+// timestamps (RFC 6962 section 3.3).
+var sctListOID = asn1.ObjectIdentifier{1, 3, 6, 1, 4, 1, 11129, 2, 4, 2}
+
+// LoadCertificate reads the certificate name and its key from dir into a
+// tls.Certificate ready to be served: the leaf is parsed, the OCSP staple
+// written by RefreshStaple is attached if it is still valid, and the
+// signed certificate timestamps embedded in the leaf are populated.
+func LoadCertificate(dir, name string) (*tls.Certificate, error) {
+	cert, err := tls.LoadX509KeyPair(path.Join(dir, name+".crt"), path.Join(dir, name+".key"))
+	if err != nil {
+		return nil, err
+	}
+	if cert.Leaf == nil {
+		if cert.Leaf, err = x509.ParseCertificate(cert.Certificate[0]); err != nil {
+			return nil, err
+		}
+	}
+	if len(cert.Certificate) > 1 {
+		staple, err := loadStaple(dir, name, cert.Leaf, cert.Certificate[1])
+		if err != nil {
+			return nil, err
+		}
+		cert.OCSPStaple = staple
+	}
+	cert.SignedCertificateTimestamps = embeddedSCTs(cert.Leaf)
+	return &cert, nil
+}
+
+// LoadCertificates reads the certificate name and its companion
+// certificates, see RenewalConfig.DualKey, with LoadCertificate. The
+// certificate itself comes first.
+func LoadCertificates(dir, name string) ([]*tls.Certificate, error) {
+	var certs []*tls.Certificate
+	for _, n := range []string{name, name + rsaSuffix, name + ecdsaSuffix} {
+		cert, err := LoadCertificate(dir, n)
+		if n != name && os.IsNotExist(err) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		certs = append(certs, cert)
+	}
+	return certs, nil
+}
+
+// loadStaple returns the OCSP response stored for the certificate, or nil
+// if there is none or it is not a current good response for leaf.
+func loadStaple(dir, name string, leaf *x509.Certificate, issuerDER []byte) ([]byte, error) {
+	b, err := ioutil.ReadFile(path.Join(dir, name+".ocsp"))
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	issuer, err := x509.ParseCertificate(issuerDER)
+	if err != nil {
+		return nil, err
+	}
+	r, err := ocsp.ParseResponseForCert(b, leaf, issuer)
+	if err != nil || r.Status != ocsp.Good || time.Now().After(r.NextUpdate) {
+		return nil, nil
+	}
+	return b, nil
+}
+
+// embeddedSCTs returns the signed certificate timestamps embedded in the
+// leaf, if any.
+func embeddedSCTs(leaf *x509.Certificate) [][]byte {
+	for _, ext := range leaf.Extensions {
+		if !ext.Id.Equal(sctListOID) {
+			continue
+		}
+		var list []byte
+		if _, err := asn1.Unmarshal(ext.Value, &list); err != nil || len(list) < 2 {
+			return nil
+		}
+		list = list[2:]
+		var scts [][]byte
+		for len(list) >= 2 {
+			n := int(binary.BigEndian.Uint16(list))
+			if len(list) < 2+n {
+				return nil
+			}
+			scts = append(scts, list[2:2+n])
+			list = list[2+n:]
+		}
+		return scts
+	}
+	return nil
+}
@@ -0,0 +1,129 @@
+package acme
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+
+	"github.com/sirupsen/logrus"
+)
+
+// requestIDHeader carries the operation ID on every request to the CA.
+const requestIDHeader = "X-Request-Id"
+
+// caRequestHeaders are the response headers a CA identifies a transaction
+// or account by. Let's Encrypt support asks for the Boulder-Requester value.
+var caRequestHeaders = []string{"Boulder-Requester", "X-Request-Id", "Request-Id"}
+
+// WithUserAgent adds ua to the User-Agent of every request to the CA, e.g.
+// the name and version of the program embedding the client.
+func WithUserAgent(ua string) Option {
+	return func(c *Client) {
+		c.userAgent = ua
+	}
+}
+
+// operation correlates the requests made for a single issuance.
+type operation struct {
+	id string
+
+	mu  sync.Mutex
+	ids []string
+}
+
+// opKey is the context key of the operation.
+type opKey struct{}
+
+// ContextWithOperationID sets the ID sent with the requests made for ctx.
+// Issuances without one get a random ID.
+func ContextWithOperationID(ctx context.Context, id string) context.Context {
+	return context.WithValue(ctx, opKey{}, &operation{id: id})
+}
+
+// operation returns the operation of ctx, starting a new one if there is
+// none.
+func (c *Client) operation(ctx context.Context) (context.Context, *operation) {
+	if op, ok := ctx.Value(opKey{}).(*operation); ok {
+		return ctx, op
+	}
+	b := make([]byte, 8)
+	rand.Read(b)
+	op := &operation{id: hex.EncodeToString(b)}
+	return context.WithValue(ctx, opKey{}, op), op
+}
+
+// add records a request ID returned by the CA.
+func (op *operation) add(id string) {
+	op.mu.Lock()
+	defer op.mu.Unlock()
+	for _, v := range op.ids {
+		if v == id {
+			return
+		}
+	}
+	op.ids = append(op.ids, id)
+}
+
+// wrap attaches the operation to err.
+func (op *operation) wrap(err error) error {
+	if err == nil {
+		return nil
+	}
+	op.mu.Lock()
+	defer op.mu.Unlock()
+	return &OperationError{ID: op.id, CARequests: append([]string(nil), op.ids...), Err: err}
+}
+
+// OperationError is returned by a failed issuance. It identifies the
+// operation and the CA's transactions, for reference in support requests.
+type OperationError struct {
+	ID         string
+	CARequests []string
+	Err        error
+}
+
+func (e *OperationError) Error() string {
+	if len(e.CARequests) == 0 {
+		return fmt.Sprintf("%s (operation %s)", e.Err, e.ID)
+	}
+	return fmt.Sprintf("%s (operation %s, CA %s)", e.Err, e.ID, strings.Join(e.CARequests, ", "))
+}
+
+// Unwrap returns the underlying error.
+func (e *OperationError) Unwrap() error {
+	return e.Err
+}
+
+// traceTransport sends the operation ID with each request and records the
+// CA's request IDs.
+type traceTransport struct {
+	next http.RoundTripper
+	log  *logrus.Entry
+}
+
+// RoundTrip implements http.RoundTripper.
+func (t *traceTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	op, ok := req.Context().Value(opKey{}).(*operation)
+	if !ok {
+		return t.next.RoundTrip(req)
+	}
+	req = req.Clone(req.Context())
+	req.Header.Set(requestIDHeader, op.id)
+	resp, err := t.next.RoundTrip(req)
+	if err != nil {
+		return resp, err
+	}
+	var ids []string
+	for _, h := range caRequestHeaders {
+		if v := resp.Header.Get(h); v != "" {
+			op.add(h + "=" + v)
+			ids = append(ids, h+"="+v)
+		}
+	}
+	t.log.Debugf("[%s] %s %s: %s %s", op.id, req.Method, req.URL, resp.Status, strings.Join(ids, " "))
+	return resp, nil
+}
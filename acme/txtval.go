@@ -1,63 +1,223 @@
 package acme
 
 import (
+	"context"
 	"encoding/json"
-	"io"
+	"errors"
+	"fmt"
+	"io/ioutil"
 	"net/http"
+	"strings"
 )
 
-type Mone struct {
-	Code int `json:"code"`
-	Error error `json:"error"`
-	Data Mtwo `json:"data"`
+// dnsQueryURL is the myssl.com API used to check records from outside the
+// local network, formatted with the record type and name.
+const dnsQueryURL = "https://myssl.com/api/v1/tools/dns_query?qtype=%d&qmode=-1&host=%s"
+
+// DNS record types queried through dnsQueryURL.
+const (
+	typeA    = 1
+	typeTXT  = 16
+	typeAAAA = 28
+	typeCAA  = 257
+)
+
+var ErrNoTxtRecord = errors.New("no TXT record found")
+
+// dnsQueryResponse is the response of the dns_query API, with results keyed
+// by the region of the resolver.
+type dnsQueryResponse struct {
+	Code  int             `json:"code"`
+	Error json.RawMessage `json:"error"`
+	Data  dnsQueryData    `json:"data"`
 }
 
-type Mtwo struct {
-	Ca []Mthree `json:"01"`
-	Hk []Mthree `json:"852"`
-	Us []Mthree `json:"86"`
+type dnsQueryData struct {
+	Ca []dnsQueryResult `json:"01"`
+	Hk []dnsQueryResult `json:"852"`
+	Cn []dnsQueryResult `json:"86"`
 }
 
-type Mthree struct {
-	Answer Mfour `json:"answer"`
+type dnsQueryResult struct {
+	Answer dnsQueryAnswer `json:"answer"`
 }
 
-type Mfour struct {
-	Timeconsume string `json:"time_consume"`
-	Records []E `json:"records"`
-	Error string `json:"error"`
+type dnsQueryAnswer struct {
+	Timeconsume string           `json:"time_consume"`
+	Records     []dnsQueryRecord `json:"records"`
+	Error       string           `json:"error"`
 }
 
-type E struct {
-	Ttl int `json:"ttl"`
+type dnsQueryRecord struct {
+	Ttl   int    `json:"ttl"`
 	Value string `json:"value"`
 }
 
-func TxtChange(domain string)(res string){
-	url := "https://myssl.com/api/v1/tools/dns_query?qtype=16&host=" + "_acme-challenge." + domain + "&qmode=-1"
-	resp , err := http.Get(url)
-	if err != nil{
-		return res
+// LookupTXT returns the value of the _acme-challenge TXT record of domain as
+// seen by public resolvers.
+func LookupTXT(ctx context.Context, domain string) (string, error) {
+	return lookupTXT(ctx, "_acme-challenge."+domain)
+}
+
+// lookupTXT returns the value of the TXT record name as seen by public
+// resolvers.
+func lookupTXT(ctx context.Context, name string) (string, error) {
+	b, err := dnsQuery(ctx, typeTXT, name)
+	if err != nil {
+		return "", err
 	}
-	defer resp.Body.Close()
-	var jsonstr string
-	buf := make([]byte, 2*1024)
-	for {
-		n, err := resp.Body.Read(buf)
-		if n == 0 {
-			if err != io.EOF {
-				return res
+	return parseTxtResponse(b)
+}
+
+// Resolvers of the dns_query API reported in TXTResult.
+const (
+	ResolverNorthAmerica = "north-america"
+	ResolverHongKong     = "hong-kong"
+	ResolverChina        = "china"
+)
+
+// TXTResult holds the values of a TXT record seen by a single resolver and
+// the expected values it did not see.
+type TXTResult struct {
+	Resolver string
+	Values   []string
+	Missing  []string
+	// Error is the resolver's error, if the lookup failed.
+	Error string
+}
+
+// TXTMismatchError is returned by VerifyTXT when a resolver does not see
+// all expected values.
+type TXTMismatchError struct {
+	Name    string
+	Want    []string
+	Results []TXTResult
+}
+
+func (e *TXTMismatchError) Error() string {
+	var failed []string
+	for _, r := range e.Results {
+		switch {
+		case r.Error != "":
+			failed = append(failed, fmt.Sprintf("%s: %s", r.Resolver, r.Error))
+		case len(r.Missing) > 0:
+			failed = append(failed, fmt.Sprintf("%s: missing %s, got %q", r.Resolver, strings.Join(r.Missing, ", "), r.Values))
+		}
+	}
+	if len(failed) == 0 {
+		return fmt.Sprintf("TXT %s: no resolver answered", e.Name)
+	}
+	return fmt.Sprintf("TXT %s: %s", e.Name, strings.Join(failed, "; "))
+}
+
+// VerifyTXT checks that every value in want is among the values of the TXT
+// record name seen by each public resolver, and returns what each resolver
+// saw. If a resolver fails or lacks a value, or none answered, the error is
+// a *TXTMismatchError with the same results.
+func VerifyTXT(ctx context.Context, name string, want ...string) ([]TXTResult, error) {
+	b, err := dnsQuery(ctx, typeTXT, name)
+	if err != nil {
+		return nil, err
+	}
+	results, err := parseResolvers(b)
+	if err != nil {
+		return nil, err
+	}
+	return checkTXT(name, want, results)
+}
+
+// checkTXT records the values of want missing from each result and returns
+// a *TXTMismatchError unless every resolver saw all of them.
+func checkTXT(name string, want []string, results []TXTResult) ([]TXTResult, error) {
+	ok := len(results) > 0
+	for i := range results {
+		r := &results[i]
+		for _, v := range want {
+			if !containsAll(r.Values, []string{v}) {
+				r.Missing = append(r.Missing, v)
 			}
-			break
 		}
-		jsonstr += string(buf[:n])
+		if r.Error != "" || len(r.Missing) > 0 {
+			ok = false
+		}
+	}
+	if !ok {
+		return results, &TXTMismatchError{Name: name, Want: want, Results: results}
+	}
+	return results, nil
+}
+
+// dnsQuery returns the raw dns_query response for the records of type qtype
+// at name.
+func dnsQuery(ctx context.Context, qtype int, name string) ([]byte, error) {
+	req, err := http.NewRequest("GET", fmt.Sprintf(dnsQueryURL, qtype, name), nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := http.DefaultClient.Do(req.WithContext(ctx))
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	return ioutil.ReadAll(resp.Body)
+}
+
+// parseTxtResponse extracts the first TXT record value from a dns_query
+// response.
+func parseTxtResponse(b []byte) (string, error) {
+	values, err := parseRecords(b)
+	if err != nil {
+		return "", err
+	}
+	if len(values) == 0 {
+		return "", ErrNoTxtRecord
+	}
+	return values[0], nil
+}
+
+// parseResolvers extracts the record values seen by each resolver that
+// answered from a dns_query response.
+func parseResolvers(b []byte) ([]TXTResult, error) {
+	var r dnsQueryResponse
+	if err := json.Unmarshal(b, &r); err != nil {
+		return nil, err
+	}
+	var results []TXTResult
+	for _, res := range []struct {
+		resolver string
+		answers  []dnsQueryResult
+	}{
+		{ResolverNorthAmerica, r.Data.Ca},
+		{ResolverHongKong, r.Data.Hk},
+		{ResolverChina, r.Data.Cn},
+	} {
+		if len(res.answers) == 0 {
+			continue
+		}
+		a := res.answers[0].Answer
+		tr := TXTResult{Resolver: res.resolver, Error: a.Error}
+		for _, rec := range a.Records {
+			tr.Values = append(tr.Values, rec.Value)
+		}
+		results = append(results, tr)
 	}
+	return results, nil
+}
 
-	var  contrast Mone
-	err = json.Unmarshal([]byte(jsonstr), &contrast)
-	if err != nil{
-		return res
+// parseRecords extracts the record values seen by the resolver in China
+// from a dns_query response.
+func parseRecords(b []byte) ([]string, error) {
+	var r dnsQueryResponse
+	if err := json.Unmarshal(b, &r); err != nil {
+		return nil, err
+	}
+	cn := r.Data.Cn
+	if len(cn) == 0 {
+		return nil, nil
 	}
-	res = contrast.Data.Us[0].Answer.Records[0].Value
-	return res
-}
\ No newline at end of file
+	values := make([]string, len(cn[0].Answer.Records))
+	for i, rec := range cn[0].Answer.Records {
+		values[i] = rec.Value
+	}
+	return values, nil
+}
@@ -0,0 +1,214 @@
+package acme
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"mime"
+	"net/http"
+	"net/url"
+
+	"golang.org/x/crypto/acme"
+)
+
+var ErrNoncompliant = errors.New("noncompliant server response")
+
+// WithStrict rejects server responses that do not comply with RFC 8555:
+// missing required fields, illegal statuses, and URLs that are relative or on
+// a different origin than the directory. This is useful with unknown private
+// ACME implementations.
+func WithStrict() Option {
+	return func(c *Client) {
+		c.strict = true
+	}
+}
+
+var (
+	authzStatuses = map[string]bool{
+		acme.StatusPending:     true,
+		acme.StatusValid:       true,
+		acme.StatusInvalid:     true,
+		acme.StatusDeactivated: true,
+		acme.StatusExpired:     true,
+		acme.StatusRevoked:     true,
+	}
+	challengeStatuses = map[string]bool{
+		acme.StatusPending:    true,
+		acme.StatusProcessing: true,
+		acme.StatusValid:      true,
+		acme.StatusInvalid:    true,
+	}
+	orderStatuses = map[string]bool{
+		acme.StatusPending:    true,
+		acme.StatusReady:      true,
+		acme.StatusProcessing: true,
+		acme.StatusValid:      true,
+		acme.StatusInvalid:    true,
+	}
+)
+
+// noncompliant returns an error wrapping ErrNoncompliant.
+func noncompliant(format string, args ...interface{}) error {
+	return fmt.Errorf("%w: %s", ErrNoncompliant, fmt.Sprintf(format, args...))
+}
+
+// directoryURL returns the directory the client talks to.
+func (c *Client) directoryURL() string {
+	if c.ca().DirectoryURL != "" {
+		return c.ca().DirectoryURL
+	}
+	return acme.LetsEncryptURL
+}
+
+// WithAllowedHosts allows URLs returned by the CA to point at the provided
+// hosts in addition to the directory host, e.g. a separate CDN for
+// certificate downloads.
+func WithAllowedHosts(hosts ...string) Option {
+	return func(c *Client) {
+		c.allowedHosts = append(c.allowedHosts, hosts...)
+	}
+}
+
+// WithInsecureURLs allows URLs returned by the CA to use plain HTTP. It is
+// only meant for test CAs such as Pebble.
+func WithInsecureURLs() Option {
+	return func(c *Client) {
+		c.insecureURLs = true
+	}
+}
+
+// validateURL checks that u, returned by the CA, is an absolute HTTPS URL on
+// the directory host or one of the allowed hosts. It is applied to every URL
+// before it is followed, regardless of strict mode.
+func (c *Client) validateURL(field, u string) error {
+	dir, err := url.Parse(c.directoryURL())
+	if err != nil {
+		return err
+	}
+	p, err := url.Parse(u)
+	if err != nil {
+		return noncompliant("%s: %s", field, err)
+	}
+	if !p.IsAbs() || p.Host == "" {
+		return noncompliant("%s %q is not absolute", field, u)
+	}
+	if p.Scheme != "https" && !(c.insecureURLs && p.Scheme == "http") {
+		return noncompliant("%s %q does not use https", field, u)
+	}
+	if p.Host == dir.Host {
+		return nil
+	}
+	for _, h := range c.allowedHosts {
+		if p.Host == h || p.Hostname() == h {
+			return nil
+		}
+	}
+	return noncompliant("%s %q is not on the directory origin", field, u)
+}
+
+// certURLTransport validates the certificate URL of the orders returned by
+// the CA, so that it is checked before the certificate is downloaded from
+// it. CreateOrderCert follows the URL without returning the order first.
+type certURLTransport struct {
+	next     http.RoundTripper
+	validate func(field, u string) error
+}
+
+func (t *certURLTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	resp, err := t.next.RoundTrip(req)
+	if err != nil || req.Method != "POST" || (resp.StatusCode != http.StatusOK && resp.StatusCode != http.StatusCreated) {
+		return resp, err
+	}
+	if ct, _, _ := mime.ParseMediaType(resp.Header.Get("Content-Type")); ct != "application/json" {
+		return resp, nil
+	}
+	b, err := ioutil.ReadAll(resp.Body)
+	resp.Body.Close()
+	if err != nil {
+		return nil, err
+	}
+	var o struct {
+		Certificate string `json:"certificate"`
+	}
+	if json.Unmarshal(b, &o) == nil && o.Certificate != "" {
+		if err := t.validate("certificate url", o.Certificate); err != nil {
+			return nil, err
+		}
+	}
+	resp.Body = ioutil.NopCloser(bytes.NewReader(b))
+	return resp, nil
+}
+
+// checkAuthorization validates an authorization in strict mode.
+func (c *Client) checkAuthorization(a *acme.Authorization) error {
+	if !c.strict {
+		return nil
+	}
+	if !authzStatuses[a.Status] {
+		return noncompliant("authorization status %q", a.Status)
+	}
+	if a.Identifier.Value == "" {
+		return noncompliant("authorization has no identifier")
+	}
+	if a.URI != "" {
+		if err := c.validateURL("authorization url", a.URI); err != nil {
+			return err
+		}
+	}
+	if len(a.Challenges) == 0 && a.Status == acme.StatusPending {
+		return noncompliant("pending authorization has no challenges")
+	}
+	for _, ch := range a.Challenges {
+		if err := c.checkChallenge(ch); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// checkChallenge validates a challenge in strict mode.
+func (c *Client) checkChallenge(ch *acme.Challenge) error {
+	if !c.strict {
+		return nil
+	}
+	if ch.Type == "" {
+		return noncompliant("challenge has no type")
+	}
+	if !challengeStatuses[ch.Status] {
+		return noncompliant("%s challenge status %q", ch.Type, ch.Status)
+	}
+	if (ch.Type == "http-01" || ch.Type == "dns-01") && ch.Token == "" {
+		return noncompliant("%s challenge has no token", ch.Type)
+	}
+	return c.validateURL(ch.Type+" challenge url", ch.URI)
+}
+
+// checkOrder validates an order in strict mode.
+func (c *Client) checkOrder(o *acme.Order) error {
+	if !c.strict {
+		return nil
+	}
+	if !orderStatuses[o.Status] {
+		return noncompliant("order status %q", o.Status)
+	}
+	if len(o.Identifiers) == 0 {
+		return noncompliant("order has no identifiers")
+	}
+	if len(o.AuthzURLs) == 0 {
+		return noncompliant("order has no authorizations")
+	}
+	for _, u := range o.AuthzURLs {
+		if err := c.validateURL("authorization url", u); err != nil {
+			return err
+		}
+	}
+	if err := c.validateURL("finalize url", o.FinalizeURL); err != nil {
+		return err
+	}
+	if o.Status == acme.StatusValid {
+		return c.validateURL("certificate url", o.CertURL)
+	}
+	return nil
+}
@@ -0,0 +1,67 @@
+package acme
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+
+	"golang.org/x/crypto/acme"
+)
+
+// userActionRequired is the problem type a CA returns when the account holder
+// must act outside ACME, e.g. confirm a contact address (RFC 8555, 7.3.3).
+const userActionRequired = "urn:ietf:params:acme:error:userActionRequired"
+
+// VerificationRequired reports whether the CA holds the account until its
+// contacts are verified, e.g. by following a link sent by email.
+func (a *Account) VerificationRequired() bool {
+	return a.Status == acme.StatusPending
+}
+
+// UserActionURL returns the page the account holder has to visit if err
+// reports that the CA requires action outside ACME, such as verifying a
+// contact address.
+func UserActionURL(err error) (string, bool) {
+	var p *acme.Error
+	if !errors.As(err, &p) || p.ProblemType != userActionRequired {
+		return "", false
+	}
+	return p.Instance, true
+}
+
+// WaitVerified waits until the CA no longer holds the account for contact
+// verification, refreshing it every poll interval. While waiting it logs
+// what the account holder has to do. It returns an error if the account ends
+// up in a state other than valid.
+func (c *Client) WaitVerified(ctx context.Context) (*Account, error) {
+	told := false
+	for {
+		a, err := c.RefreshAccount(ctx)
+		url, pending := UserActionURL(err)
+		switch {
+		case pending:
+		case err != nil:
+			return nil, err
+		case a.VerificationRequired():
+		case a.Status != acme.StatusValid:
+			return a, fmt.Errorf("account is %s", a.Status)
+		default:
+			return a, nil
+		}
+		if !told {
+			told = true
+			msg := "the CA requires the account contacts to be verified"
+			if c.account != nil && len(c.account.Contact) > 0 {
+				msg += ": check the inbox of " + strings.Join(c.account.Contact, ", ")
+			}
+			if url != "" {
+				msg += ", or visit " + url
+			}
+			c.log.Warnf("%s; waiting", msg)
+		}
+		if err := c.wait(ctx); err != nil {
+			return nil, err
+		}
+	}
+}
@@ -0,0 +1,64 @@
+// Command letsencrypt-agent serves http-01 challenges on edge and load
+// balancer nodes for a central issuer using acme.WithDelegation. It
+// registers with the issuer's acme.AgentRegistryHandler and serves the
+// challenge tokens pushed to it on port 80. Under systemd socket activation,
+// it serves the socket named "http" instead of listening itself.
+//
+//	LETSENCRYPT_AGENT_SECRET=... letsencrypt-agent \
+//		-name edge-1 -url http://10.0.0.5/tasks \
+//		-registry https://issuer.internal/agents
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"net"
+	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
+
+	"github.com/fireflyst/letsencrypt/acme"
+	"github.com/sirupsen/logrus"
+)
+
+func main() {
+	hostname, _ := os.Hostname()
+	var (
+		listen   = flag.String("listen", ":80", "address to serve challenges and tasks on without a systemd socket")
+		name     = flag.String("name", hostname, "name of this agent")
+		url      = flag.String("url", "", "URL the issuer posts tasks to")
+		registry = flag.String("registry", "", "URL of the issuer's agent registry")
+	)
+	flag.Parse()
+	secret := os.Getenv("LETSENCRYPT_AGENT_SECRET")
+	if *url == "" || *registry == "" || secret == "" {
+		flag.Usage()
+		logrus.Fatal("-url, -registry and LETSENCRYPT_AGENT_SECRET are required")
+	}
+	a := &acme.Agent{
+		Name:     *name,
+		URL:      *url,
+		Registry: *registry,
+		Secret:   []byte(secret),
+	}
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	l, err := acme.SystemdListener("http")
+	if errors.Is(err, acme.ErrNoSystemdListener) {
+		l, err = net.Listen("tcp", *listen)
+	}
+	if err != nil {
+		logrus.Fatal(err)
+	}
+	srv := &http.Server{Handler: a}
+	go func() {
+		<-ctx.Done()
+		srv.Close()
+	}()
+	go a.Run(ctx)
+	if err := srv.Serve(l); err != nil && err != http.ErrServerClosed {
+		logrus.Fatal(err)
+	}
+}
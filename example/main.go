@@ -0,0 +1,36 @@
+package main
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/fireflyst/letsencrypt/acme"
+)
+
+func main() {
+	domains := []string{"example.com", "www.example.com"}
+	dir := "test"
+	name := dir
+
+	ctx := context.Background()
+	c, err := acme.New(ctx, dir, "account", "test@example.com")
+	//// add the dns records automatically
+	//c, err := acme.New(ctx, dir, "account", "test@example.com",
+	//	acme.WithDNSProvider(&acme.Cloudflare{APIToken: os.Getenv("CF_API_TOKEN")}))
+	if err != nil {
+		fmt.Println(err)
+		return
+	}
+
+	//dns changes
+	err = c.Create(ctx, dir, name, acme.ChallengeDNS, domains...)
+	if err != nil {
+		fmt.Println(err)
+	}
+
+	////http changes
+	//err = c.Create(ctx, dir, name, acme.ChallengeHTTP, domains...)
+	//if err != nil {
+	//	fmt.Println(err)
+	//}
+}
@@ -0,0 +1,15 @@
+module github.com/fireflyst/letsencrypt
+
+go 1.25.0
+
+require (
+	github.com/sirupsen/logrus v1.9.4
+	golang.org/x/crypto v0.54.0
+	golang.org/x/net v0.57.0
+	golang.org/x/sync v0.22.0
+)
+
+require (
+	golang.org/x/sys v0.47.0 // indirect
+	golang.org/x/text v0.40.0 // indirect
+)